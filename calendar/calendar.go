@@ -0,0 +1,248 @@
+// Package calendar tells business days from weekends and bank holidays, and moves the
+// dates that fall on neither to a business day.
+package calendar
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCalendar = errors.New("invalid holiday calendar")
+
+// Policy is what happens to a date that is not a business day.
+type Policy string
+
+const (
+	Previous Policy = "PREVIOUS" // the business day before it
+	Next     Policy = "NEXT"     // the business day after it
+	None     Policy = "NONE"     // the date is kept
+)
+
+// ParsePolicy parses PREVIOUS, NEXT or NONE.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case Previous, Next, None:
+		return p, nil
+	}
+	return "", fmt.Errorf("business day policy must be PREVIOUS, NEXT or NONE, not %q", s)
+}
+
+// maxShift caps how many days Adjust moves a date, so a calendar without business days
+// still ends.
+const maxShift = 366
+
+// Holiday is a day banks are closed.
+type Holiday struct {
+	Date time.Time
+	Name string
+}
+
+// Calendar holds the bank holidays; every other Monday to Friday is a business day. A nil
+// Calendar has no holidays. It is safe for concurrent use once built.
+type Calendar struct {
+	holidays map[string]string
+}
+
+const dateLayout = "2006-01-02"
+
+// New builds a calendar from holidays. Only the date of a holiday counts, its time of day
+// and location are ignored.
+func New(holidays []Holiday) *Calendar {
+	c := &Calendar{holidays: make(map[string]string, len(holidays))}
+	for _, h := range holidays {
+		c.holidays[h.Date.Format(dateLayout)] = h.Name
+	}
+	return c
+}
+
+// Holiday returns the name of the holiday on the date of t.
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	name, ok := c.holidays[t.Format(dateLayout)]
+	return name, ok
+}
+
+// IsBusinessDay reports whether the date of t is a weekday that is not a holiday.
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := c.Holiday(t)
+	return !holiday
+}
+
+// Adjust moves t to a business day by policy, keeping its time of day. A t on a business
+// day, or with the None policy, is returned as it is.
+func (c *Calendar) Adjust(t time.Time, p Policy) time.Time {
+	step := 1
+	switch p {
+	case Previous:
+		step = -1
+	case Next:
+	default:
+		return t
+	}
+	day := t
+	for range maxShift {
+		if c.IsBusinessDay(day) {
+			return day
+		}
+		day = day.AddDate(0, 0, step)
+	}
+	return t
+}
+
+// Load reads a calendar from an iCalendar (.ics) or JSON file, chosen by its extension.
+//
+// Every all-day VEVENT of an iCalendar file is a holiday, from its DTSTART up to its DTEND,
+// named by its SUMMARY. JSON is an array of {"date": "2025-04-14", "name": "Songkran"}.
+func Load(path string) (*Calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var holidays []Holiday
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ics", ".ical":
+		holidays, err = ReadICal(f)
+	case ".json":
+		holidays, err = ReadJSON(f)
+	default:
+		return nil, fmt.Errorf("%s: holiday files must be .ics or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return New(holidays), nil
+}
+
+// ReadJSON reads holidays from a JSON array of {"date": "2025-04-14", "name": "Songkran"}.
+func ReadJSON(r io.Reader) ([]Holiday, error) {
+	var rows []struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rows); err != nil {
+		return nil, err
+	}
+
+	holidays := make([]Holiday, 0, len(rows))
+	for i, row := range rows {
+		date, err := time.Parse(dateLayout, strings.TrimSpace(row.Date))
+		if err != nil {
+			return nil, fmt.Errorf("%w: holiday %d: date %q must be YYYY-MM-DD", ErrInvalidCalendar, i+1, row.Date)
+		}
+		holidays = append(holidays, Holiday{Date: date, Name: row.Name})
+	}
+	return holidays, nil
+}
+
+// ReadICal reads the holidays of an iCalendar file, one per day its events cover. Recurring
+// events are not supported: holiday calendars list each year on its own.
+func ReadICal(r io.Reader) ([]Holiday, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var holidays []Holiday
+	var event map[string]string
+	events := 0
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not NAME:VALUE", ErrInvalidCalendar, line)
+		}
+		// parameters such as ;VALUE=DATE do not change how a date is read
+		name, _, _ = strings.Cut(name, ";")
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = map[string]string{}
+			events++
+		case name == "END" && value == "VEVENT":
+			days, err := eventHolidays(event)
+			if err != nil {
+				return nil, fmt.Errorf("event %d: %w", events, err)
+			}
+			holidays = append(holidays, days...)
+			event = nil
+		case event != nil:
+			event[name] = value
+		}
+	}
+	return holidays, nil
+}
+
+// unfold joins the lines of an iCalendar file that RFC 5545 folds onto the next line, which
+// starts with a space or a tab, and drops blank lines.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "":
+		case (line[0] == ' ' || line[0] == '\t') && len(lines) > 0:
+			lines[len(lines)-1] += line[1:]
+		default:
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func eventHolidays(event map[string]string) ([]Holiday, error) {
+	if _, ok := event["RRULE"]; ok {
+		return nil, fmt.Errorf("%w: recurring events are not supported", ErrInvalidCalendar)
+	}
+	start, err := parseICalDate(event["DTSTART"])
+	if err != nil {
+		return nil, err
+	}
+	// DTEND is the day after the last one; without it the event is a single day
+	end := start.AddDate(0, 0, 1)
+	if value, ok := event["DTEND"]; ok {
+		if end, err = parseICalDate(value); err != nil {
+			return nil, err
+		}
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("%w: event ends before it starts", ErrInvalidCalendar)
+	}
+
+	name := unescape(event["SUMMARY"])
+	var holidays []Holiday
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		holidays = append(holidays, Holiday{Date: day, Name: name})
+	}
+	return holidays, nil
+}
+
+// parseICalDate reads the date of an iCalendar DATE or DATE-TIME value.
+func parseICalDate(value string) (time.Time, error) {
+	date, _, _ := strings.Cut(value, "T")
+	t, err := time.Parse("20060102", date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q is not a date", ErrInvalidCalendar, value)
+	}
+	return t, nil
+}
+
+var unescaper = strings.NewReplacer(`\\`, `\`, `\,`, `,`, `\;`, `;`, `\n`, " ", `\N`, " ")
+
+func unescape(text string) string {
+	return unescaper.Replace(text)
+}
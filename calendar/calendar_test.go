@@ -0,0 +1,145 @@
+package calendar
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// thai holds the bank holidays around Songkran 2025 and the turn of 2026 and 2027. Songkran
+// falls on a Sunday in 2025, so the Wednesday after it is a substitution day.
+const thai = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example Bank//Holidays//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:songkran-2025@example.com\r\n" +
+	"DTSTART;VALUE=DATE:20250413\r\n" +
+	"DTEND;VALUE=DATE:20250416\r\n" +
+	"SUMMARY:Songkran Festival\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20250416\r\n" +
+	"SUMMARY:Substitution for Songkran\r\n" +
+	"  Festival\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20251231\r\n" +
+	"DTEND;VALUE=DATE:20260102\r\n" +
+	"SUMMARY:New Year's Eve\\, New Year's Day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20261231T000000Z\r\n" +
+	"DTEND:20270102T000000Z\r\n" +
+	"SUMMARY:New Year's Eve\\, New Year's Day\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestAdjust(t *testing.T) {
+	c, err := Load(writeFile(t, "holidays.ics", thai))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		date   string
+		policy Policy
+		want   string
+	}{
+		{"BusinessDayStays", "2025-04-11 09:00", Previous, "2025-04-11 09:00"},
+		{"SongkranBack", "2025-04-15 09:00", Previous, "2025-04-11 09:00"},
+		{"SongkranForward", "2025-04-14 09:00", Next, "2025-04-17 09:00"},
+		{"SubstitutionDayForward", "2025-04-16 09:00", Next, "2025-04-17 09:00"},
+		{"SongkranKept", "2025-04-14 09:00", None, "2025-04-14 09:00"},
+		{"NewYearsEveBack", "2025-12-31 09:00", Previous, "2025-12-30 09:00"},
+		{"NewYearsEveForward", "2025-12-31 09:00", Next, "2026-01-02 09:00"},
+		{"IntoTheWeekendAfterNewYear", "2026-12-31 09:00", Next, "2027-01-04 09:00"},
+		{"BackAcrossTheYear", "2027-01-01 09:00", Previous, "2026-12-30 09:00"},
+		{"Weekend", "2025-04-12 09:00", Next, "2025-04-17 09:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, at(tt.want), c.Adjust(at(tt.date), tt.policy))
+		})
+	}
+}
+
+func TestHoliday(t *testing.T) {
+	holidays, err := ReadICal(strings.NewReader(thai))
+	assert.NoError(t, err)
+	cal := New(holidays)
+
+	name, ok := cal.Holiday(at("2025-04-16 15:00"))
+	assert.True(t, ok)
+	assert.Equal(t, "Substitution for Songkran Festival", name)
+	name, _ = cal.Holiday(at("2026-01-01 00:00"))
+	assert.Equal(t, "New Year's Eve, New Year's Day", name)
+
+	assert.False(t, cal.IsBusinessDay(at("2025-04-14 09:00")))
+	assert.False(t, cal.IsBusinessDay(at("2025-04-19 09:00")))
+	assert.True(t, cal.IsBusinessDay(at("2025-04-17 09:00")))
+
+	// without a calendar only weekends are closed
+	var none *Calendar
+	assert.True(t, none.IsBusinessDay(at("2025-04-14 09:00")))
+	assert.Equal(t, at("2025-04-14 09:00"), none.Adjust(at("2025-04-12 09:00"), Next))
+}
+
+func TestLoad(t *testing.T) {
+	c, err := Load(writeFile(t, "holidays.json", `[{"date": "2025-04-14", "name": "Songkran"}, {"date": "2025-12-31", "name": "New Year's Eve"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, at("2025-12-30 09:00"), c.Adjust(at("2025-12-31 09:00"), Previous))
+
+	_, err = Load(writeFile(t, "holidays.json", `[{"date": "14/04/2025"}]`))
+	assert.ErrorIs(t, err, ErrInvalidCalendar)
+	_, err = Load(writeFile(t, "holidays.json", `[{"day": "2025-04-14"}]`))
+	assert.ErrorContains(t, err, "unknown field")
+	_, err = Load(writeFile(t, "holidays.ics", "BEGIN:VEVENT\nDTSTART;VALUE=DATE:20250101\nRRULE:FREQ=YEARLY\nEND:VEVENT\n"))
+	assert.ErrorContains(t, err, "event 1: invalid holiday calendar: recurring events are not supported")
+	_, err = Load(writeFile(t, "holidays.ics", "BEGIN:VEVENT\nDTSTART;VALUE=DATE:20250102\nDTEND;VALUE=DATE:20250101\nEND:VEVENT\n"))
+	assert.ErrorIs(t, err, ErrInvalidCalendar)
+	_, err = Load(writeFile(t, "holidays.csv", "2025-04-14"))
+	assert.ErrorContains(t, err, "must be .ics or .json")
+}
+
+func TestThaiHolidays(t *testing.T) {
+	f, err := os.Open("../holidays/th.json")
+	assert.NoError(t, err)
+	defer f.Close()
+	holidays, err := ReadJSON(f)
+	assert.NoError(t, err)
+
+	// banks close on weekdays only, a holiday on a weekend is substituted by one
+	for _, h := range holidays {
+		assert.NotContains(t, []time.Weekday{time.Saturday, time.Sunday}, h.Date.Weekday(), h.Date.Format(dateLayout))
+	}
+	c := New(holidays)
+	assert.Equal(t, at("2025-04-17 09:00"), c.Adjust(at("2025-04-14 09:00"), Next))
+	name, ok := c.Holiday(at("2026-04-13 09:00"))
+	assert.True(t, ok)
+	assert.Equal(t, "Songkran Festival", name)
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("NEXT")
+	assert.NoError(t, err)
+	assert.Equal(t, Next, p)
+	_, err = ParsePolicy("next")
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 )
@@ -36,6 +37,46 @@ type Config struct {
 	Email      string `env:"FIREBASE_CLIENT_EMAIL"`
 	PrivateKey string `env:"FIREBASE_PRIVATE_KEY"`
 	PORT       string `env:"SERVER_PORT"`
+
+	// ResetDB deletes the database on startup, which loses every balance, transfer and
+	// schedule. It is meant for development only
+	ResetDB bool `env:"RESET_DB"`
+
+	SchedulerInterval time.Duration `env:"SCHEDULER_INTERVAL" envDefault:"1m"`
+	IdempotencyTTL    time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	ScheduleHoldLead  time.Duration `env:"SCHEDULE_HOLD_LEAD" envDefault:"24h"`
+
+	// A scheduled transfer that fails for want of funds or a recipient is tried again
+	// ScheduleRetries times, waiting ScheduleRetryBackoff and twice as long after every try,
+	// as long as it stays on the same business day. A schedule is paused once
+	// ScheduleSuspendAfter runs in a row have failed, 0 never pauses it
+	ScheduleRetries      int           `env:"SCHEDULE_RETRIES" envDefault:"3"`
+	ScheduleRetryBackoff time.Duration `env:"SCHEDULE_RETRY_BACKOFF" envDefault:"30m"`
+	ScheduleSuspendAfter int           `env:"SCHEDULE_SUSPEND_AFTER" envDefault:"3"`
+
+	RemoteConfigInterval time.Duration `env:"REMOTE_CONFIG_INTERVAL" envDefault:"1m"`
+
+	// FeatureProvider is one of "firebase", "file" or "memory". With "firebase" and a
+	// FeatureFile, flags in the file override the ones from Remote Config.
+	FeatureProvider string `env:"FEATURE_PROVIDER" envDefault:"firebase"`
+	FeatureFile     string `env:"FEATURE_FILE"`
+
+	// StatementFont and StatementBoldFont are TrueType fonts with Thai glyphs for PDF statements
+	StatementFont     string `env:"STATEMENT_FONT" envDefault:"/usr/share/fonts/noto/NotoSansThai-Regular.ttf"`
+	StatementBoldFont string `env:"STATEMENT_FONT_BOLD" envDefault:"/usr/share/fonts/noto/NotoSansThai-Bold.ttf"`
+
+	// FXRatesFile is a JSON or CSV table of dated exchange rates, without it transfers
+	// between accounts in different currencies are refused
+	FXRatesFile string `env:"FX_RATES_FILE"`
+
+	// HolidayFile is an iCalendar or JSON list of bank holidays, scheduled transfers move off
+	// them by their business day policy. It defaults to the Thai bank holidays shipped in
+	// holidays/
+	HolidayFile string `env:"HOLIDAY_FILE" envDefault:"holidays/th.json"`
+
+	// BusinessTimezone is where schedules run, business days fall and statement months
+	// start. Timestamps are stored in UTC whatever it is
+	BusinessTimezone string `env:"BUSINESS_TIMEZONE" envDefault:"Asia/Bangkok"`
 }
 
 var (
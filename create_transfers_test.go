@@ -7,8 +7,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"demo/idgen"
+
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	_ "modernc.org/sqlite"
@@ -67,7 +71,7 @@ func TestCreateTransfer(t *testing.T) {
 		reqBody := `{
 			"fromAccount": "12345",
 			"toAccount": "54321",
-			"toBank": "Bank B",
+			"toBank": "KTB",
 			"amount": 200,
 			"currency": "USD",
 			"note": "Payment for services"
@@ -88,7 +92,7 @@ func TestCreateTransfer(t *testing.T) {
 		err = json.Unmarshal(w.Body.Bytes(), &resp)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, resp.TransactionID)
-		assert.Equal(t, "TRANSFERRED", resp.Status)
+		assert.Equal(t, "COMPLETED", resp.Status)
 		assert.NotEmpty(t, resp.TransferredAt)
 
 		// Verify account balances after transfer
@@ -120,7 +124,7 @@ func TestCreateTransfer(t *testing.T) {
 		reqBody := `{
 			"fromAccount": "12345",
 			"toAccount": "54321",
-			"toBank": "Bank B",
+			"toBank": "KTB",
 			"amount": 2000,
 			"currency": "USD",
 			"note": "Payment for services"
@@ -135,7 +139,215 @@ func TestCreateTransfer(t *testing.T) {
 		r.ServeHTTP(w, req)
 
 		// Assert the response
-		assert.Equal(t, http.StatusBadRequest, w.Code)
-		assert.JSONEq(t, `{"error":"insufficient balance"}`, w.Body.String())
+		assertError(t, w, http.StatusUnprocessableEntity, codeInsufficientFunds, "insufficient balance")
+	})
+	t.Run("UnknownRecipientRollsBack", func(t *testing.T) {
+		// Setup test database
+		db, cleanup, err := setupTestDBTransfers("unknown_recipient_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		// Initialize the handler with the test DB
+		handler := &Handler{db: db}
+
+		// Setup Gin router and routes
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+
+		reqBody := `{
+			"fromAccount": "12345",
+			"toAccount": "99999",
+			"toBank": "KTB",
+			"amount": 200,
+			"currency": "USD"
+		}`
+
+		req, err := http.NewRequest(http.MethodPost, "/accounts/12345/transfers", strings.NewReader(reqBody))
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assertError(t, w, http.StatusUnprocessableEntity, codeRecipientNotFound, "recipient account not found")
+
+		// Nothing from the failed transfer is left behind
+		var balance int64
+		err = db.QueryRow("SELECT balance FROM accounts WHERE account_number = '12345'").Scan(&balance)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1000), balance)
+
+		var legs int
+		err = db.QueryRow("SELECT COUNT(*) FROM transactions").Scan(&legs)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, legs)
 	})
+
+	t.Run("ConcurrentTransfersNeverOverdraw", func(t *testing.T) {
+		// Setup test database
+		db, cleanup, err := setupTestDBTransfers("concurrent_transfers_db")
+		assert.NoError(t, err)
+		defer cleanup()
+		// sqlite allows a single writer, same as in main
+		db.SetMaxOpenConns(1)
+
+		// Initialize the handler with the test DB
+		handler := &Handler{db: db}
+
+		// Setup Gin router and routes
+		r := gin.New()
+		r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+
+		// 300 transfers of 10 in both directions: 12345 can afford 100 of its own plus
+		// whatever 54321 sends back, 54321 can afford 50 of its own plus what it receives
+		const workers = 300
+		var wg sync.WaitGroup
+		var ok, insufficient atomic.Int64
+		for i := 0; i < workers; i++ {
+			from, to := "12345", "54321"
+			if i%3 == 0 {
+				from, to = to, from
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reqBody := fmt.Sprintf(`{"fromAccount":"%s","toAccount":"%s","toBank":"KTB","amount":10,"currency":"USD"}`, from, to)
+				req, _ := http.NewRequest(http.MethodPost, "/accounts/"+from+"/transfers", strings.NewReader(reqBody))
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				switch w.Code {
+				case http.StatusOK:
+					ok.Add(1)
+				case http.StatusUnprocessableEntity:
+					insufficient.Add(1)
+				default:
+					t.Errorf("unexpected status %d: %s", w.Code, w.Body.String())
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(workers), ok.Load()+insufficient.Load())
+
+		var negative int
+		err = db.QueryRow("SELECT COUNT(*) FROM accounts WHERE balance < 0").Scan(&negative)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, negative)
+
+		// Money is neither created nor lost, and every successful transfer has two legs
+		var total int64
+		err = db.QueryRow("SELECT SUM(balance) FROM accounts").Scan(&total)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1500), total)
+
+		var legs int64
+		err = db.QueryRow("SELECT COUNT(*) FROM transactions").Scan(&legs)
+		assert.NoError(t, err)
+		assert.Equal(t, 2*ok.Load(), legs)
+	})
+
+	t.Run("GeneratedIDCollisionsAreRetried", func(t *testing.T) {
+		// Setup test database
+		db, cleanup, err := setupTestDBTransfers("id_collision_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		// TXNTAKEN is a transfer already, TXNLEGACY only has legs left from old data
+		_, err = db.Exec(`
+			INSERT INTO transfers (transaction_id, from_account, to_account, amount, currency, status, created_at, updated_at)
+			VALUES ('TXNTAKEN', '12345', '54321', 1, 'USD', 'COMPLETED', '2025-01-01T00:00:00Z', '2025-01-01T00:00:00Z')`)
+		assert.NoError(t, err)
+		_, err = db.Exec(`
+			INSERT INTO transactions (transaction_id, account_number, from_account, to_account, amount, currency, transferred_at)
+			VALUES ('TXNLEGACY', '12345', '12345', '54321', -1, 'USD', '2025-01-01T00:00:00Z')`)
+		assert.NoError(t, err)
+
+		ids := []string{"TXNTAKEN", "TXNLEGACY", "TXNFRESH"}
+		handler := &Handler{db: db, newID: func(prefix string) string {
+			if prefix != "TXN" {
+				return idgen.New(prefix)
+			}
+			id := ids[0]
+			ids = ids[1:]
+			return id
+		}}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+
+		reqBody := `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD"}`
+		req, err := http.NewRequest(http.MethodPost, "/accounts/12345/transfers", strings.NewReader(reqBody))
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp := TransferResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "TXNFRESH", resp.TransactionID)
+
+		var legs int
+		err = db.QueryRow("SELECT COUNT(*) FROM transactions WHERE transaction_id = 'TXNFRESH'").Scan(&legs)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, legs)
+
+		got, err := handler.getTransfer(db, "TXNFRESH")
+		assert.NoError(t, err)
+		assert.Equal(t, TransferCompleted, got.Status)
+		_, err = handler.getTransfer(db, "TXNLEGACY")
+		assert.ErrorIs(t, err, errTransferNotFound)
+	})
+}
+
+func TestCreateTransferAmount(t *testing.T) {
+	db, cleanup, err := setupTestDBTransfers("transfer_amount_db")
+	assert.NoError(t, err)
+	defer cleanup()
+
+	handler := &Handler{db: db}
+	r := gin.Default()
+	r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+
+	body := func(amount, currency string) string {
+		b := `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":` + amount
+		if currency != "" {
+			b += `,"currency":"` + currency + `"`
+		}
+		return b + `}`
+	}
+
+	// every form of 1.50 USD moves the same 150 cents
+	accepted := map[string]string{
+		"MinorUnits":  body(`150`, "USD"),
+		"Decimal":     body(`"1.50"`, "USD"),
+		"Object":      body(`{"minorUnits":150,"currency":"USD"}`, ""),
+		"ObjectValue": body(`{"value":"1.5"}`, "USD"),
+	}
+	balance := int64(1000)
+	for name, req := range accepted {
+		w := postWithKey(r, "/accounts/12345/transfers", "", req)
+		assert.Equal(t, http.StatusOK, w.Code, name)
+		balance -= 150
+		assert.Equal(t, balance, balanceOf(t, db, "12345"), name)
+	}
+
+	rejected := map[string]struct{ body, field, code string }{
+		"Missing":        {`{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","currency":"USD"}`, "amount", fieldRequired},
+		"Zero":           {body(`0`, "USD"), "amount", fieldNotPositive},
+		"Fractional":     {body(`1.5`, "USD"), "amount", fieldInvalidAmount},
+		"TooPrecise":     {body(`"1.505"`, "USD"), "amount", fieldInvalidAmount},
+		"Disagree":       {body(`{"minorUnits":150,"value":"1.51"}`, "USD"), "amount", fieldInvalidAmount},
+		"OtherCurrency":  {body(`{"minorUnits":150,"currency":"THB"}`, "USD"), "amount", fieldInvalidAmount},
+		"NoCurrency":     {body(`150`, ""), "currency", fieldRequired},
+		"UnknownField":   {body(`{"amount":150,"currency":"USD"}`, ""), "amount", fieldInvalidAmount},
+		"OutOfRange":     {body(`99999999999999999999`, "USD"), "amount", fieldInvalidAmount},
+		"ObjectNoAmount": {body(`{"currency":"USD"}`, ""), "amount", fieldInvalidAmount},
+	}
+	for name, tt := range rejected {
+		w := postWithKey(r, "/accounts/12345/transfers", "", tt.body)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, name)
+		resp := assertError(t, w, http.StatusUnprocessableEntity, codeValidationFailed, "invalid request")
+		if assert.Len(t, resp.Fields, 1, name) {
+			assert.Equal(t, tt.field, resp.Fields[0].Field, name)
+			assert.Equal(t, tt.code, resp.Fields[0].Code, name)
+		}
+	}
+	assert.Equal(t, balance, balanceOf(t, db, "12345"))
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"demo/idgen"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stable error codes. Clients branch on these, the app also uses some of them to hide
+// options that are switched off remotely, so they never change once released.
+const (
+	codeBadRequest              = "BAD_REQUEST"
+	codeValidationFailed        = "VALIDATION_FAILED"
+	codeNotFound                = "NOT_FOUND"
+	codeMethodNotAllowed        = "METHOD_NOT_ALLOWED"
+	codeInternal                = "INTERNAL"
+	codeAccountNotFound         = "ACCOUNT_NOT_FOUND"
+	codeRecipientNotFound       = "RECIPIENT_NOT_FOUND"
+	codeTransferNotFound        = "TRANSFER_NOT_FOUND"
+	codeStatementNotFound       = "STATEMENT_NOT_FOUND"
+	codeScheduleNotFound        = "SCHEDULE_NOT_FOUND"
+	codeInvalidScheduleStatus   = "INVALID_SCHEDULE_STATUS"
+	codeInsufficientFunds       = "INSUFFICIENT_FUNDS"
+	codeInvalidAmount           = "INVALID_AMOUNT"
+	codeInvalidCurrency         = "INVALID_CURRENCY"
+	codeInvalidCursor           = "INVALID_CURSOR"
+	codeTransferLimitExceeded   = "TRANSFER_LIMIT_EXCEEDED"
+	codeScheduleOnceDisabled    = "SCHEDULE_ONCE_DISABLED"
+	codeScheduleMonthlyDisabled = "SCHEDULE_MONTHLY_DISABLED"
+	codeCurrencyMismatch        = "CURRENCY_MISMATCH"
+	codeFXRateUnavailable       = "FX_RATE_UNAVAILABLE"
+	codeNotReversible           = "NOT_REVERSIBLE"
+	codeAlreadyReversed         = "ALREADY_REVERSED"
+	codeRefundTooLarge          = "REFUND_TOO_LARGE"
+	codeIdempotencyKeyReused    = "IDEMPOTENCY_KEY_REUSED"
+	codeIdempotencyInProgress   = "IDEMPOTENCY_IN_PROGRESS"
+)
+
+// Domain errors. They are returned and wrapped like any other error; handlers pass them to
+// abortWithError, which answers with their status and code.
+var (
+	errAccountNotFound         = newError(http.StatusNotFound, codeAccountNotFound, "account not found")
+	errRecipientNotFound       = newError(http.StatusUnprocessableEntity, codeRecipientNotFound, "recipient account not found")
+	errInsufficientBalance     = newError(http.StatusUnprocessableEntity, codeInsufficientFunds, "insufficient balance")
+	errInvalidAmount           = newError(http.StatusUnprocessableEntity, codeInvalidAmount, "invalid amount")
+	errInvalidCurrency         = newError(http.StatusUnprocessableEntity, codeInvalidCurrency, "invalid currency")
+	errCurrencyMismatch        = newError(http.StatusUnprocessableEntity, codeCurrencyMismatch, "currency does not match the sender account")
+	errLimitExceeded           = newError(http.StatusUnprocessableEntity, codeTransferLimitExceeded, "transfer amount exceeds limit")
+	errScheduleOnceDisabled    = newError(http.StatusForbidden, codeScheduleOnceDisabled, "one-time schedules are disabled")
+	errScheduleMonthlyDisabled = newError(http.StatusForbidden, codeScheduleMonthlyDisabled, "monthly schedules are disabled")
+	errNoRate                  = newError(http.StatusUnprocessableEntity, codeFXRateUnavailable, "no exchange rate to the recipient currency")
+	errTransferNotFound        = newError(http.StatusNotFound, codeTransferNotFound, "transfer not found")
+	errStatementNotFound       = newError(http.StatusNotFound, codeStatementNotFound, "statement not found")
+	errScheduleNotFound        = newError(http.StatusNotFound, codeScheduleNotFound, "schedule not found")
+	errScheduleStatus          = newError(http.StatusConflict, codeInvalidScheduleStatus, "schedule can not change status")
+	errNotReversible           = newError(http.StatusConflict, codeNotReversible, "only completed transfers can be reversed")
+	errAlreadyReversed         = newError(http.StatusConflict, codeAlreadyReversed, "transfer already reversed")
+	errRefundTooLarge          = newError(http.StatusUnprocessableEntity, codeRefundTooLarge, "reversal amount exceeds refundable amount")
+	errIdempotencyKeyReused    = newError(http.StatusConflict, codeIdempotencyKeyReused, "idempotency key was used with a different request")
+	errIdempotencyInProgress   = newError(http.StatusConflict, codeIdempotencyInProgress, "request with this idempotency key is in progress")
+	errInvalidCursor           = newError(http.StatusBadRequest, codeInvalidCursor, "invalid cursor")
+	errRouteNotFound           = newError(http.StatusNotFound, codeNotFound, "not found")
+	errMethodNotAllowed        = newError(http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed")
+)
+
+// Error is an error as clients get it: an HTTP status, a stable code and a message.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func newError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// badRequest is a 400 for a request that can not be understood, such as malformed JSON or
+// an unknown query parameter value.
+func badRequest(format string, args ...any) *Error {
+	return newError(http.StatusBadRequest, codeBadRequest, fmt.Sprintf(format, args...))
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// withMessage returns a copy of e that tells clients message instead.
+func (e *Error) withMessage(message string) *Error {
+	return newError(e.Status, e.Code, message)
+}
+
+// errorBody is the envelope every error response is wrapped in.
+type errorBody struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"requestId"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	// TransactionID points to the FAILED transfer recorded for a transfer that could not be made
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+// abortWithError answers err in the error envelope and stops the handler chain. A domain
+// error carries its own status, code and message, a ValidationError its fields. Anything
+// else is a 500 telling the client msg; the error itself is logged, never sent.
+func abortWithError(c *gin.Context, err error, msg string) {
+	body := errorBody{Code: codeInternal, Message: msg, RequestID: requestID(c)}
+	status := http.StatusInternalServerError
+
+	var e *Error
+	var v *ValidationError
+	switch {
+	case errors.As(err, &v):
+		status, body.Code, body.Message, body.Fields = http.StatusUnprocessableEntity, codeValidationFailed, "invalid request", v.Fields
+	case errors.As(err, &e):
+		status, body.Code, body.Message = e.Status, e.Code, e.Message
+	default:
+		log.Printf("Error: request %s: %v", body.RequestID, err)
+	}
+
+	var f *failedTransferError
+	if errors.As(err, &f) {
+		body.TransactionID = f.transactionID
+	}
+
+	_ = c.Error(err)
+	c.AbortWithStatusJSON(status, gin.H{"error": body})
+}
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "requestId"
+	// maxRequestIDSize caps a request ID taken from the client
+	maxRequestIDSize = 128
+)
+
+// requestID returns the ID of the request c is handling, making one up when the
+// RequestErrors middleware did not run.
+func requestID(c *gin.Context) string {
+	if id := c.GetString(requestIDKey); id != "" {
+		return id
+	}
+	id := idgen.New("REQ")
+	c.Set(requestIDKey, id)
+	c.Header(requestIDHeader, id)
+	return id
+}
+
+// RequestErrors gives every request an ID, taken from the X-Request-ID header when the client
+// sent one, and echoes it back. Errors a handler attached with c.Error but did not answer
+// are rendered in the error envelope once the handler returns.
+func RequestErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDSize {
+			id = idgen.New("REQ")
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+
+		c.Next()
+
+		if len(c.Errors) > 0 && !c.Writer.Written() {
+			abortWithError(c, c.Errors.Last().Err, "internal error")
+		}
+	}
+}
+
+// recoverWithError answers a panicking handler with a 500 in the error envelope.
+func recoverWithError(c *gin.Context, recovered any) {
+	abortWithError(c, fmt.Errorf("panic: %v", recovered), "internal error")
+}
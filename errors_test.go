@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// assertError checks that w is an error envelope with status, code and message, tagged with
+// the request ID echoed in the X-Request-ID header, and returns it.
+func assertError(t *testing.T, w *httptest.ResponseRecorder, status int, code, message string) errorBody {
+	t.Helper()
+	var resp struct {
+		Error errorBody `json:"error"`
+	}
+	assert.Equal(t, status, w.Code, w.Body.String())
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	assert.Equal(t, code, resp.Error.Code)
+	assert.Equal(t, message, resp.Error.Message)
+	assert.NotEmpty(t, resp.Error.RequestID)
+	assert.Equal(t, w.Header().Get(requestIDHeader), resp.Error.RequestID)
+	return resp.Error
+}
+
+func serve(r http.Handler, method, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	db, cleanup, err := setupTestDBGetTransactions("errors_db")
+	assert.NoError(t, err)
+	defer cleanup()
+	r := setupRouter(&Handler{db: db})
+
+	t.Run("UnknownAccount", func(t *testing.T) {
+		for _, path := range []string{"/accounts/unknown/balances", "/accounts/unknown/transactions", "/accounts/unknown/schedules", "/accounts/unknown/holds"} {
+			w := serve(r, http.MethodGet, path, nil)
+			assertError(t, w, http.StatusNotFound, codeAccountNotFound, "account not found")
+		}
+	})
+
+	t.Run("UnknownTransfer", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/transfers/TXN0", nil)
+		assertError(t, w, http.StatusNotFound, codeTransferNotFound, "transfer not found")
+	})
+
+	t.Run("BadQuery", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/accounts/12345/transactions?limit=0", nil)
+		assertError(t, w, http.StatusBadRequest, codeBadRequest, "limit must be between 1 and 500")
+	})
+
+	t.Run("NoRoute", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/nowhere", nil)
+		assertError(t, w, http.StatusNotFound, codeNotFound, "not found")
+	})
+
+	t.Run("MethodNotAllowed", func(t *testing.T) {
+		w := serve(r, http.MethodDelete, "/transfers/TXN0", nil)
+		assertError(t, w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed")
+	})
+
+	t.Run("RequestIDEchoed", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/accounts/unknown/balances", map[string]string{requestIDHeader: "client-42"})
+		body := assertError(t, w, http.StatusNotFound, codeAccountNotFound, "account not found")
+		assert.Equal(t, "client-42", body.RequestID)
+
+		w = serve(r, http.MethodGet, "/health", map[string]string{requestIDHeader: strings.Repeat("x", maxRequestIDSize+1)})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, strings.HasPrefix(w.Header().Get(requestIDHeader), "REQ"))
+	})
+}
+
+func TestErrorMiddleware(t *testing.T) {
+	r := gin.New()
+	r.Use(RequestErrors(), gin.CustomRecovery(recoverWithError))
+	r.GET("/panic", func(*gin.Context) { panic("boom") })
+	r.GET("/unanswered", func(c *gin.Context) { _ = c.Error(errTransferNotFound) })
+	r.GET("/internal", func(c *gin.Context) {
+		abortWithError(c, errors.New("sql: database is closed"), "unable to do it")
+	})
+
+	w := serve(r, http.MethodGet, "/panic", nil)
+	assertError(t, w, http.StatusInternalServerError, codeInternal, "internal error")
+	assert.NotContains(t, w.Body.String(), "boom")
+
+	w = serve(r, http.MethodGet, "/unanswered", nil)
+	assertError(t, w, http.StatusNotFound, codeTransferNotFound, "transfer not found")
+
+	w = serve(r, http.MethodGet, "/internal", nil)
+	assertError(t, w, http.StatusInternalServerError, codeInternal, "unable to do it")
+	assert.NotContains(t, w.Body.String(), "sql")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"demo/fx"
+	"demo/money"
+)
+
+// quote converts t to toCurrency, the currency of its recipient, at the rate effective at
+// stamp and sets the quoted rate and converted amount on t. A transfer within one currency
+// is left as it is, and so is one that already carries its conversion, such as a reversal
+// refunding at the rate of the original.
+func (h *Handler) quote(t *Transfer, toCurrency, stamp string) error {
+	if toCurrency == t.Amount.Currency {
+		return nil
+	}
+	if t.Converted != nil {
+		if t.Converted.Currency != toCurrency {
+			return fmt.Errorf("%w: converted to %s but the recipient account is in %s", errCurrencyMismatch, t.Converted.Currency, toCurrency)
+		}
+		return nil
+	}
+	if h.rates == nil {
+		return fmt.Errorf("%w: %w from %s to %s: no rate table loaded", errNoRate, fx.ErrNoRate, t.Amount.Currency, toCurrency)
+	}
+
+	at, err := parseTime(stamp)
+	if err != nil {
+		return err
+	}
+	q, err := h.rates.Quote(t.Amount.Minor, t.Amount.Currency, toCurrency, at)
+	if errors.Is(err, fx.ErrNoRate) {
+		return fmt.Errorf("%w: %w", errNoRate, err)
+	}
+	if err != nil {
+		return err
+	}
+	if q.Converted <= 0 {
+		return fmt.Errorf("%w: %s %s is nothing in %s", errInvalidAmount, t.Amount, t.Amount.Currency, toCurrency)
+	}
+	converted := money.New(q.Converted, toCurrency)
+	t.ExchangeRate = q.Rate.String()
+	t.Converted = &converted
+	return nil
+}
+
+// isCurrencyError reports whether err means the transfer can not be made in its currency.
+func isCurrencyError(err error) bool {
+	return errors.Is(err, errCurrencyMismatch) || errors.Is(err, fx.ErrNoRate)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"demo/fx"
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupFXRouter adds a THB account to the USD accounts of setupTestDBTransfers and, unless
+// rates is nil, a USD to THB rate table.
+func setupFXRouter(t *testing.T, dbName string, rates *fx.Table) (*Handler, *gin.Engine, func()) {
+	db, cleanup, err := setupTestDBTransfers(dbName)
+	assert.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO accounts (branch, account_number, account_name, balance, currency) VALUES ('Bangkok', '77777', 'Somchai', 100000, 'THB')`)
+	assert.NoError(t, err)
+
+	handler := &Handler{db: db, rates: rates}
+	assert.NoError(t, handler.postOpeningBalances("2025-01-01T00:00:00Z"))
+
+	r := gin.Default()
+	r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+	r.POST("/transfers/:transactionId/reversals", handler.CreateReversal)
+	return handler, r, cleanup
+}
+
+func usdTHB(t *testing.T) *fx.Table {
+	rate, ok := new(big.Rat).SetString("35.125")
+	assert.True(t, ok)
+	table, err := fx.NewTable([]fx.Rate{{From: "USD", To: "THB", Rate: rate, EffectiveFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}})
+	assert.NoError(t, err)
+	return table
+}
+
+func TestTransferCurrency(t *testing.T) {
+	t.Run("InvalidCurrency", func(t *testing.T) {
+		_, r, cleanup := setupFXRouter(t, "fx_invalid_db", nil)
+		defer cleanup()
+
+		for _, currency := range []string{"usd", "ABC", "XAU"} {
+			w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":100,"currency":"`+currency+`"}`)
+			resp := assertError(t, w, http.StatusUnprocessableEntity, codeValidationFailed, "invalid request")
+			assert.Equal(t, []FieldError{{"currency", fieldInvalidCurrency, "invalid currency"}}, resp.Fields, currency)
+		}
+	})
+
+	t.Run("CurrencyOfAnotherAccount", func(t *testing.T) {
+		handler, r, cleanup := setupFXRouter(t, "fx_mismatch_db", usdTHB(t))
+		defer cleanup()
+
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"77777","toBank":"KTB","amount":100,"currency":"THB"}`)
+		assertError(t, w, http.StatusUnprocessableEntity, codeCurrencyMismatch, "currency does not match the sender account")
+		assert.Equal(t, int64(1000), balanceOf(t, handler.db, "12345"))
+	})
+
+	t.Run("NoRate", func(t *testing.T) {
+		handler, r, cleanup := setupFXRouter(t, "fx_norate_db", nil)
+		defer cleanup()
+
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"77777","toBank":"KTB","amount":100,"currency":"USD"}`)
+		assertError(t, w, http.StatusUnprocessableEntity, codeFXRateUnavailable, "no exchange rate to the recipient currency")
+		assert.Equal(t, int64(1000), balanceOf(t, handler.db, "12345"))
+		assert.Equal(t, int64(100000), balanceOf(t, handler.db, "77777"))
+	})
+
+	t.Run("CrossCurrency", func(t *testing.T) {
+		handler, r, cleanup := setupFXRouter(t, "fx_cross_db", usdTHB(t))
+		defer cleanup()
+
+		// 3.33 USD at 35.125 is 116.96625 THB, rounded to satang
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"77777","toBank":"KTB","amount":333,"currency":"USD"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp := TransferResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "35.125", resp.ExchangeRate)
+		assert.Equal(t, &money.Money{Minor: 11697, Currency: "THB"}, resp.Converted)
+
+		assert.Equal(t, int64(667), balanceOf(t, handler.db, "12345"))
+		assert.Equal(t, int64(111697), balanceOf(t, handler.db, "77777"))
+
+		rows, err := handler.db.Query(`
+			SELECT account_number, amount, currency, exchange_rate, converted_amount, converted_currency
+			FROM transactions WHERE transaction_id = $1 ORDER BY amount`, resp.TransactionID)
+		assert.NoError(t, err)
+		defer rows.Close()
+		type leg struct {
+			Account, Currency, Rate, ConvertedCurrency string
+			Amount, Converted                          int64
+		}
+		var legs []leg
+		for rows.Next() {
+			var l leg
+			assert.NoError(t, rows.Scan(&l.Account, &l.Amount, &l.Currency, &l.Rate, &l.Converted, &l.ConvertedCurrency))
+			legs = append(legs, l)
+		}
+		assert.Equal(t, []leg{
+			{Account: "12345", Amount: -333, Currency: "USD", Rate: "35.125", Converted: 11697, ConvertedCurrency: "THB"},
+			{Account: "77777", Amount: 11697, Currency: "THB", Rate: "35.125", Converted: 11697, ConvertedCurrency: "THB"},
+		}, legs)
+
+		transfer, err := handler.getTransfer(handler.db, resp.TransactionID)
+		assert.NoError(t, err)
+		assert.Equal(t, "35.125", transfer.ExchangeRate)
+		assert.Equal(t, money.New(333, "USD"), transfer.Amount)
+		assert.Equal(t, &money.Money{Minor: 11697, Currency: "THB"}, transfer.Converted)
+
+		report, err := handler.checkLedger()
+		assert.NoError(t, err)
+		assert.True(t, report.OK(), "%+v", report)
+	})
+
+	t.Run("ReversalRefundsAtTheOriginalRate", func(t *testing.T) {
+		handler, r, cleanup := setupFXRouter(t, "fx_reversal_db", usdTHB(t))
+		defer cleanup()
+
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"77777","toBank":"KTB","amount":333,"currency":"USD"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp := TransferResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		// a third of 116.97 THB is 38.99 THB for 1.11 USD
+		w = postWithKey(r, "/transfers/"+resp.TransactionID+"/reversals", "", `{"amount":111}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		reversal := ReversalResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reversal))
+		assert.Equal(t, money.New(111, "USD"), reversal.Amount)
+		assert.Equal(t, money.New(222, "USD"), reversal.RefundableAmount)
+		assert.Equal(t, int64(778), balanceOf(t, handler.db, "12345"))
+		assert.Equal(t, int64(111697-3899), balanceOf(t, handler.db, "77777"))
+
+		refund, err := handler.getTransfer(handler.db, reversal.TransactionID)
+		assert.NoError(t, err)
+		assert.Equal(t, money.New(3899, "THB"), refund.Amount)
+		assert.Equal(t, &money.Money{Minor: 111, Currency: "USD"}, refund.Converted)
+		assert.Equal(t, "0.0284697509", refund.ExchangeRate)
+
+		// the last refund gives back the rest of the converted amount
+		w = postWithKey(r, "/transfers/"+resp.TransactionID+"/reversals", "", `{}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int64(1000), balanceOf(t, handler.db, "12345"))
+		assert.Equal(t, int64(100000), balanceOf(t, handler.db, "77777"))
+
+		report, err := handler.checkLedger()
+		assert.NoError(t, err)
+		assert.True(t, report.OK(), "%+v", report)
+	})
+}
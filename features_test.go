@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"demo/firebase"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// withRemoteConfig swaps in a remote config holding params for the duration of the test.
+func withRemoteConfig(t *testing.T, params map[string]string) {
+	previous := firebase.AllConfigs()
+	rc := firebase.RemoteConfig{Parameters: map[string]firebase.Parameter{}}
+	for name, value := range params {
+		rc.Parameters[name] = firebase.Parameter{DefaultValue: firebase.DefaultValue{Value: value}}
+	}
+	firebase.SetRemoteConfig(rc)
+	t.Cleanup(func() { firebase.SetRemoteConfig(previous) })
+}
+
+func TestTransferLimit(t *testing.T) {
+	transfer := func(amount, currency string) string {
+		return `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":` + amount + `,"currency":"` + currency + `"}`
+	}
+
+	tests := []struct {
+		name   string
+		limit  string
+		amount string
+		code   int
+	}{
+		{"NoLimitConfigured", "", "900", http.StatusOK},
+		{"WithinDefaultLimit", "300", "300", http.StatusOK},
+		{"AboveDefaultLimit", "300", "301", http.StatusUnprocessableEntity},
+		{"CurrencyOverride", `{"default":1000,"currency":{"USD":100}}`, "200", http.StatusUnprocessableEntity},
+		{"AccountTypeOverrideWins", `{"default":100,"currency":{"USD":100},"accountType":{"Current":500}}`, "200", http.StatusOK},
+		// a limit that does not parse refuses transfers rather than lifting the limit
+		{"InvalidLimit", "lots", "1", http.StatusInternalServerError},
+		{"InvalidLimitObject", `{"default":"lots"}`, "1", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cleanup, err := setupTestDBTransfers("transfer_limit_" + tt.name)
+			assert.NoError(t, err)
+			defer cleanup()
+			_, err = db.Exec(`UPDATE accounts SET type = 'Current'`)
+			assert.NoError(t, err)
+			withRemoteConfig(t, map[string]string{"transfer_limit": tt.limit})
+
+			handler := &Handler{db: db}
+			r := gin.Default()
+			r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+
+			w := postWithKey(r, "/accounts/12345/transfers", "", transfer(tt.amount, "USD"))
+			switch tt.code {
+			case http.StatusUnprocessableEntity:
+				assertError(t, w, tt.code, codeTransferLimitExceeded, "transfer amount exceeds limit")
+			case http.StatusInternalServerError:
+				assertError(t, w, tt.code, codeInternal, "unable to create transfer")
+				assert.Equal(t, int64(1000), balanceOf(t, db, "12345"))
+			default:
+				assert.Equal(t, tt.code, w.Code)
+			}
+		})
+	}
+
+	t.Run("UsesLiveConfig", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("transfer_limit_live")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+
+		withRemoteConfig(t, map[string]string{"transfer_limit": "100"})
+		assert.Equal(t, http.StatusUnprocessableEntity, postWithKey(r, "/accounts/12345/transfers", "", transfer("200", "USD")).Code)
+
+		withRemoteConfig(t, map[string]string{"transfer_limit": "1000"})
+		assert.Equal(t, http.StatusOK, postWithKey(r, "/accounts/12345/transfers", "", transfer("200", "USD")).Code)
+	})
+
+	t.Run("Schedules", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "transfer_limit_schedules")
+		defer cleanup()
+		withRemoteConfig(t, map[string]string{"transfer_limit": "300", "enable_schedule_once": "true"})
+
+		schedule := func(amount string) string {
+			return `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":` + amount + `,"currency":"USD","schedule":"ONCE","startDate":"2030-01-01 09:00:00"}`
+		}
+		w := postWithKey(r, "/accounts/12345/schedules", "", schedule("301"))
+		assertError(t, w, http.StatusUnprocessableEntity, codeTransferLimitExceeded, "transfer amount exceeds limit")
+
+		w = postWithKey(r, "/accounts/12345/schedules", "", schedule("300"))
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var created ScheduleResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		path := "/accounts/12345/schedules/" + created.ScheduleID
+
+		w = sendJSON(r, http.MethodPatch, path, `{"amount":301}`)
+		assertError(t, w, http.StatusUnprocessableEntity, codeTransferLimitExceeded, "transfer amount exceeds limit")
+		var amount int64
+		assert.NoError(t, handler.db.QueryRow(`SELECT amount FROM schedules WHERE schedule_id = $1`, created.ScheduleID).Scan(&amount))
+		assert.Equal(t, int64(300), amount)
+
+		// other changes are not held to a limit lowered since
+		withRemoteConfig(t, map[string]string{"transfer_limit": "100"})
+		assert.Equal(t, http.StatusOK, sendJSON(r, http.MethodPatch, path, `{"note":"Rent"}`).Code)
+	})
+}
+
+func TestScheduleToggles(t *testing.T) {
+	schedule := func(kind string) string {
+		return `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":100,"currency":"USD",` +
+			`"schedule":"` + kind + `","startDate":"2030-01-01 09:00:00"}`
+	}
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		schedule string
+		code     int
+		errCode  string
+		message  string
+	}{
+		{"OnceEnabled", map[string]string{"enable_schedule_once": "true"}, "ONCE", http.StatusOK, "", ""},
+		{"OnceDisabled", map[string]string{"enable_schedule_once": "false", "enable_schedule_monthly": "true"}, "ONCE", http.StatusForbidden,
+			codeScheduleOnceDisabled, "one-time schedules are disabled"},
+		{"MonthlyEnabled", map[string]string{"enable_schedule_monthly": "true"}, "MONTHLY", http.StatusOK, "", ""},
+		{"MonthlyDisabled", map[string]string{"enable_schedule_once": "true", "enable_schedule_monthly": "false"}, "MONTHLY", http.StatusForbidden,
+			codeScheduleMonthlyDisabled, "monthly schedules are disabled"},
+		{"OnceWithoutConfig", map[string]string{}, "ONCE", http.StatusOK, "", ""},
+		{"MonthlyWithoutConfig", map[string]string{}, "MONTHLY", http.StatusOK, "", ""},
+		{"DailyWithMonthlyDisabled", map[string]string{"enable_schedule_monthly": "false"}, "DAILY", http.StatusOK, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cleanup, err := setupTestDBTransfers("schedule_toggle_" + tt.name)
+			assert.NoError(t, err)
+			defer cleanup()
+			withRemoteConfig(t, tt.params)
+
+			handler := &Handler{db: db}
+			r := gin.Default()
+			r.POST("/accounts/:accountNumber/schedules", handler.CreateSchedules)
+
+			w := postWithKey(r, "/accounts/12345/schedules", "", schedule(tt.schedule))
+			if tt.errCode != "" {
+				assertError(t, w, tt.code, tt.errCode, tt.message)
+			} else {
+				assert.Equal(t, tt.code, w.Code)
+			}
+
+			var count int
+			err = db.QueryRow("SELECT COUNT(*) FROM schedules").Scan(&count)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code == http.StatusOK, count == 1)
+		})
+	}
+
+	t.Run("MonthlyRolledOutToBranch", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("schedule_toggle_branch")
+		assert.NoError(t, err)
+		defer cleanup()
+		_, err = db.Exec(`UPDATE accounts SET branch = 'Kalasin' WHERE account_number = '54321'`)
+		assert.NoError(t, err)
+
+		previous := firebase.AllConfigs()
+		defer firebase.SetRemoteConfig(previous)
+		firebase.SetRemoteConfig(firebase.RemoteConfig{
+			Conditions: []firebase.Condition{{Name: "kalasin", Expression: "account.branch == 'Kalasin'"}},
+			Parameters: map[string]firebase.Parameter{
+				"enable_schedule_monthly": {
+					DefaultValue:      firebase.DefaultValue{Value: "false"},
+					ConditionalValues: map[string]firebase.DefaultValue{"kalasin": {Value: "true"}},
+				},
+			},
+		})
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/schedules", handler.CreateSchedules)
+
+		w := postWithKey(r, "/accounts/12345/schedules", "", schedule("MONTHLY"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		body := `{"fromAccount":"54321","toAccount":"12345","toBank":"KTB","amount":100,"currency":"USD",` +
+			`"schedule":"MONTHLY","startDate":"2030-01-01 09:00:00"}`
+		w = postWithKey(r, "/accounts/54321/schedules", "", body)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
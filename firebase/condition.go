@@ -0,0 +1,378 @@
+package firebase
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Context is what condition expressions are evaluated against.
+type Context struct {
+	AccountNumber string
+	AccountType   string
+	Branch        string
+}
+
+// ValueOf returns the value of parameter name in rc for ctx. Conditions are tried in the
+// order of rc.Conditions and the first true one with a conditional value for the parameter
+// wins; otherwise the default value is used. A condition that fails to parse is false.
+func ValueOf(rc RemoteConfig, name string, ctx Context) string {
+	p, ok := rc.Parameters[name]
+	if !ok {
+		return ""
+	}
+
+	for _, cond := range rc.Conditions {
+		v, ok := p.ConditionalValues[cond.Name]
+		if !ok {
+			continue
+		}
+		match, err := EvaluateCondition(cond.Expression, ctx)
+		if err != nil {
+			log.Printf("firebase: condition %q: %v", cond.Name, err)
+			continue
+		}
+		if match {
+			return v.Value
+		}
+	}
+	return p.DefaultValue.Value
+}
+
+// IsEnabledFor reports whether flag name of the current provider is on for ctx.
+func IsEnabledFor(name string, ctx Context) bool {
+	return ValueOf(AllConfigs(), name, ctx) == "true"
+}
+
+// ValueFor returns parameter name of the current provider for ctx.
+func ValueFor(name string, ctx Context) string {
+	return ValueOf(AllConfigs(), name, ctx)
+}
+
+// EvaluateCondition evaluates a condition expression against ctx. The supported subset of
+// the Remote Config condition language is:
+//
+//	percent <= 10                         rollout keyed by account number
+//	percent('seed') between 0 and 10      rollout with its own seed
+//	account.type == 'Savings'             also !=, and account.branch, account.number
+//	account.branch in ['Kalasin', 'Udon']
+//	true, false, !expr, (expr), expr && expr, expr || expr
+func EvaluateCondition(expression string, ctx Context) (bool, error) {
+	p := &parser{tokens: tokenize(expression)}
+	e, err := p.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if !p.done() {
+		return false, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return e.eval(ctx), nil
+}
+
+// Percent returns where accountNumber falls in a rollout for seed, in [0, 100).
+func Percent(seed, accountNumber string) float64 {
+	sum := sha256.Sum256([]byte(seed + "." + accountNumber))
+	micro := binary.BigEndian.Uint64(sum[:8]) % 100_000_000
+	return float64(micro) / 1_000_000
+}
+
+type expr interface {
+	eval(ctx Context) bool
+}
+
+type andExpr struct{ left, right expr }
+
+func (e andExpr) eval(ctx Context) bool { return e.left.eval(ctx) && e.right.eval(ctx) }
+
+type orExpr struct{ left, right expr }
+
+func (e orExpr) eval(ctx Context) bool { return e.left.eval(ctx) || e.right.eval(ctx) }
+
+type notExpr struct{ e expr }
+
+func (e notExpr) eval(ctx Context) bool { return !e.e.eval(ctx) }
+
+type constExpr bool
+
+func (e constExpr) eval(Context) bool { return bool(e) }
+
+type percentExpr struct {
+	seed     string
+	op       string
+	low, top float64
+}
+
+func (e percentExpr) eval(ctx Context) bool {
+	if ctx.AccountNumber == "" {
+		return false
+	}
+	x := Percent(e.seed, ctx.AccountNumber)
+	switch e.op {
+	case "<":
+		return x < e.low
+	case "<=":
+		return x <= e.low
+	case ">":
+		return x > e.low
+	case ">=":
+		return x >= e.low
+	case "between":
+		return x > e.low && x <= e.top
+	}
+	return false
+}
+
+type attrExpr struct {
+	attr   string
+	op     string
+	values []string
+}
+
+func (e attrExpr) eval(ctx Context) bool {
+	var v string
+	switch e.attr {
+	case "account.number":
+		v = ctx.AccountNumber
+	case "account.type":
+		v = ctx.AccountType
+	case "account.branch":
+		v = ctx.Branch
+	}
+
+	found := false
+	for _, want := range e.values {
+		if strings.EqualFold(v, want) {
+			found = true
+			break
+		}
+	}
+	if e.op == "!=" {
+		return !found
+	}
+	return found
+}
+
+type token struct {
+	kind string // ident, string, number, op
+	text string
+}
+
+func tokenize(s string) []token {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(s[i+1:], s[i])
+			if j < 0 {
+				tokens = append(tokens, token{"op", s[i:]})
+				return tokens
+			}
+			tokens = append(tokens, token{"string", s[i+1 : i+1+j]})
+			i += j + 2
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{"number", s[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{"ident", s[i:j]})
+			i = j
+		default:
+			op := s[i : i+1]
+			if i+1 < len(s) {
+				switch s[i : i+2] {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = s[i : i+2]
+				}
+			}
+			tokens = append(tokens, token{"op", op})
+			i += len(op)
+		}
+	}
+	return tokens
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) accept(text string) bool {
+	if !p.done() && p.peek().text == text && p.peek().kind != "string" {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %q, got %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.accept("!") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	}
+	if p.accept("(") {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+
+	t := p.next()
+	if t.kind != "ident" {
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	switch t.text {
+	case "true":
+		return constExpr(true), nil
+	case "false":
+		return constExpr(false), nil
+	case "percent":
+		return p.parsePercent()
+	case "account.number", "account.type", "account.branch":
+		return p.parseAttr(t.text)
+	}
+	return nil, fmt.Errorf("unknown condition %q", t.text)
+}
+
+func (p *parser) parsePercent() (expr, error) {
+	e := percentExpr{}
+	if p.accept("(") {
+		seed := p.next()
+		if seed.kind != "string" {
+			return nil, fmt.Errorf("expected percent seed, got %q", seed.text)
+		}
+		e.seed = seed.text
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	op := p.next()
+	var err error
+	switch op.text {
+	case "<", "<=", ">", ">=":
+		e.op = op.text
+		e.low, err = p.number()
+	case "between":
+		e.op = op.text
+		if e.low, err = p.number(); err != nil {
+			return nil, err
+		}
+		if err = p.expect("and"); err != nil {
+			return nil, err
+		}
+		e.top, err = p.number()
+	default:
+		err = fmt.Errorf("unexpected %q after percent", op.text)
+	}
+	return e, err
+}
+
+func (p *parser) number() (float64, error) {
+	t := p.next()
+	if t.kind != "number" {
+		return 0, fmt.Errorf("expected number, got %q", t.text)
+	}
+	return strconv.ParseFloat(t.text, 64)
+}
+
+func (p *parser) parseAttr(attr string) (expr, error) {
+	e := attrExpr{attr: attr}
+	op := p.next()
+	switch op.text {
+	case "==", "!=":
+		e.op = op.text
+		v := p.next()
+		if v.kind != "string" {
+			return nil, fmt.Errorf("expected string, got %q", v.text)
+		}
+		e.values = []string{v.text}
+	case "in":
+		e.op = op.text
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		for !p.accept("]") {
+			v := p.next()
+			if v.kind != "string" {
+				return nil, fmt.Errorf("expected string, got %q", v.text)
+			}
+			e.values = append(e.values, v.text)
+			if !p.accept(",") && p.peek().text != "]" {
+				return nil, fmt.Errorf("expected \",\" or \"]\", got %q", p.peek().text)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected %q after %s", op.text, attr)
+	}
+	return e, nil
+}
@@ -0,0 +1,105 @@
+package firebase
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	kalasin := Context{AccountNumber: "111-111-111", AccountType: "Savings", Branch: "Kalasin"}
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"True", "true", true},
+		{"Not", "!false", true},
+		{"BranchEquals", "account.branch == 'Kalasin'", true},
+		{"BranchEqualsIgnoresCase", `account.branch == "kalasin"`, true},
+		{"BranchNotEquals", "account.branch != 'Kalasin'", false},
+		{"BranchIn", "account.branch in ['Udon', 'Kalasin']", true},
+		{"BranchNotIn", "account.branch in ['Udon', 'Bangkok']", false},
+		{"TypeAndBranch", "account.type == 'Savings' && account.branch == 'Udon'", false},
+		{"TypeOrBranch", "account.type == 'Savings' || account.branch == 'Udon'", true},
+		{"Precedence", "false && false || true", true},
+		{"Parentheses", "false && (false || true)", false},
+		{"PercentAll", "percent <= 100", true},
+		{"PercentNone", "percent < 0", false},
+		{"PercentBetween", "percent('rollout') between 0 and 100", true},
+		{"AccountNumber", "account.number in ['111-111-111']", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvaluateCondition(tt.expression, kalasin)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, bad := range []string{"", "percent", "percent <= x", "account.branch = 'x'", "account.branch in ['x'", "(true", "true true", "device.os == 'ios'"} {
+		t.Run("Invalid "+bad, func(t *testing.T) {
+			_, err := EvaluateCondition(bad, kalasin)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPercentRollout(t *testing.T) {
+	in := 0
+	for i := 0; i < 10000; i++ {
+		ctx := Context{AccountNumber: fmt.Sprintf("%03d-%03d-%03d", i/1000000, i/1000%1000, i%1000)}
+		ok, err := EvaluateCondition("percent <= 10", ctx)
+		assert.NoError(t, err)
+		if ok {
+			in++
+		}
+	}
+	assert.InDelta(t, 1000, in, 150)
+
+	// the same account always lands in the same bucket, different seeds shuffle buckets
+	assert.Equal(t, Percent("", "111-111-111"), Percent("", "111-111-111"))
+	assert.NotEqual(t, Percent("a", "111-111-111"), Percent("b", "111-111-111"))
+
+	// without an account there is nothing to roll out to
+	ok, err := EvaluateCondition("percent <= 100", Context{})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestValueOf(t *testing.T) {
+	rc := RemoteConfig{
+		Conditions: []Condition{
+			{Name: "kalasin", Expression: "account.branch == 'Kalasin'"},
+			{Name: "broken", Expression: "account.branch =="},
+			{Name: "savings", Expression: "account.type == 'Savings'"},
+		},
+		Parameters: map[string]Parameter{
+			"enable_schedule_monthly": {
+				DefaultValue: DefaultValue{Value: "false"},
+				ConditionalValues: map[string]DefaultValue{
+					"broken":  {Value: "broken"},
+					"savings": {Value: "savings"},
+					"kalasin": {Value: "true"},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, "true", ValueOf(rc, "enable_schedule_monthly", Context{Branch: "Kalasin", AccountType: "Savings"}))
+	assert.Equal(t, "savings", ValueOf(rc, "enable_schedule_monthly", Context{Branch: "Udon", AccountType: "Savings"}))
+	assert.Equal(t, "false", ValueOf(rc, "enable_schedule_monthly", Context{Branch: "Udon"}))
+	assert.Equal(t, "", ValueOf(rc, "unknown", Context{}))
+
+	ft := FeaturesFor(rc, Context{Branch: "Kalasin"})
+	assert.True(t, ft.EnableScheduleMonthly)
+	assert.False(t, Features(rc).EnableScheduleMonthly)
+
+	// a switch remote config does not have is on
+	assert.True(t, ft.EnableScheduleOnce)
+	assert.True(t, Features(rc).EnableScheduleOnce)
+	assert.True(t, FeaturesFor(RemoteConfig{}, Context{}).EnableScheduleMonthly)
+}
@@ -1,5 +1,15 @@
 package firebase
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// featureToggle holds the switches and limits the API reads from remote config. A schedule
+// switch is on unless remote config has it, so a missing parameter or a config that was not
+// fetched yet does not turn schedules off.
 type featureToggle struct {
 	EnableScheduleMonthly bool
 	EnableScheduleOnce    bool
@@ -7,7 +17,7 @@ type featureToggle struct {
 }
 
 func Features(rc RemoteConfig) featureToggle {
-	var ft featureToggle
+	ft := featureToggle{EnableScheduleMonthly: true, EnableScheduleOnce: true}
 	for key, value := range rc.Parameters {
 		switch key {
 		case "enable_schedule_monthly":
@@ -20,3 +30,67 @@ func Features(rc RemoteConfig) featureToggle {
 	}
 	return ft
 }
+
+// FeaturesFor is Features with conditional values evaluated against ctx.
+func FeaturesFor(rc RemoteConfig, ctx Context) featureToggle {
+	return featureToggle{
+		EnableScheduleMonthly: switchOn(rc, "enable_schedule_monthly", ctx),
+		EnableScheduleOnce:    switchOn(rc, "enable_schedule_once", ctx),
+		TransferLimit:         ValueOf(rc, "transfer_limit", ctx),
+	}
+}
+
+// switchOn reports whether switch name is on for ctx, which it is when rc does not have it.
+func switchOn(rc RemoteConfig, name string, ctx Context) bool {
+	if _, ok := rc.Parameters[name]; !ok {
+		return true
+	}
+	return ValueOf(rc, name, ctx) == "true"
+}
+
+// TransferLimit is the maximum amount of a single transfer in minor units.
+// A limit of zero means no limit.
+//
+// The transfer_limit parameter is either a plain number, which applies to every transfer,
+// or a JSON object with overrides:
+//
+//	{"default": 5000000, "currency": {"USD": 100000}, "accountType": {"Savings": 2000000}}
+type TransferLimit struct {
+	Default     int64            `json:"default"`
+	Currency    map[string]int64 `json:"currency,omitempty"`
+	AccountType map[string]int64 `json:"accountType,omitempty"`
+}
+
+// ParseTransferLimit parses the value of the transfer_limit parameter.
+func ParseTransferLimit(value string) (TransferLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return TransferLimit{}, nil
+	}
+
+	if strings.HasPrefix(value, "{") {
+		var l TransferLimit
+		if err := json.Unmarshal([]byte(value), &l); err != nil {
+			return TransferLimit{}, fmt.Errorf("invalid transfer limit: %w", err)
+		}
+		return l, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return TransferLimit{}, fmt.Errorf("invalid transfer limit: %w", err)
+	}
+	return TransferLimit{Default: n}, nil
+}
+
+// For returns the limit of a transfer in currency from an account of accountType.
+// An account type override wins over a currency override, which wins over the default.
+func (l TransferLimit) For(currency, accountType string) int64 {
+	if v, ok := l.AccountType[accountType]; ok {
+		return v
+	}
+	if v, ok := l.Currency[currency]; ok {
+		return v
+	}
+	return l.Default
+}
@@ -0,0 +1,190 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Provider serves feature flags and parameters in the Remote Config template format.
+type Provider interface {
+	IsEnabled(name string) bool
+	Value(name string) string
+	AllConfigs() RemoteConfig
+}
+
+var (
+	providerMu sync.RWMutex
+	provider   Provider = remote
+)
+
+// SetProvider replaces the provider behind the package level IsEnabled, Value and AllConfigs.
+func SetProvider(p Provider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+// CurrentProvider returns the provider set by SetProvider, the Remote provider by default.
+func CurrentProvider() Provider {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	return provider
+}
+
+func isEnabled(rc RemoteConfig, name string) bool {
+	return value(rc, name) == "true"
+}
+
+func value(rc RemoteConfig, name string) string {
+	v, ok := rc.Parameters[name]
+	if !ok {
+		return ""
+	}
+
+	return v.DefaultValue.Value
+}
+
+// Memory is a provider holding a template in memory that can be replaced at any time.
+type Memory struct {
+	mu sync.RWMutex
+	rc RemoteConfig
+}
+
+func NewMemory(rc RemoteConfig) *Memory {
+	return &Memory{rc: rc}
+}
+
+// Set swaps in rc as a whole.
+func (m *Memory) Set(rc RemoteConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rc = rc
+}
+
+func (m *Memory) AllConfigs() RemoteConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.rc
+}
+
+func (m *Memory) IsEnabled(name string) bool {
+	return isEnabled(m.AllConfigs(), name)
+}
+
+func (m *Memory) Value(name string) string {
+	return value(m.AllConfigs(), name)
+}
+
+// File is a provider reading a template from a JSON or YAML file. Watch reloads the file
+// whenever it changes; a file that fails to parse leaves the last good template in place.
+type File struct {
+	Memory
+	path    string
+	modTime time.Time
+}
+
+// NewFile loads the template at path. Files ending in .yaml or .yml are read as YAML,
+// anything else as JSON.
+func NewFile(path string) (*File, error) {
+	f := &File{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload reads the file again if it changed since the last load.
+func (f *File) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	rc, err := parseTemplate(f.path, b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+
+	f.Set(rc)
+	f.modTime = info.ModTime()
+	return nil
+}
+
+// Watch checks the file for changes every interval until ctx is cancelled.
+func (f *File) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.Reload(); err != nil {
+				log.Printf("firebase: unable to reload feature file: %v", err)
+			}
+		}
+	}
+}
+
+func parseTemplate(path string, b []byte) (RemoteConfig, error) {
+	var rc RemoteConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// decode into plain maps first so the json field names of RemoteConfig apply
+		var doc any
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return rc, err
+		}
+		var err error
+		if b, err = json.Marshal(doc); err != nil {
+			return rc, err
+		}
+	}
+
+	err := json.Unmarshal(b, &rc)
+	return rc, err
+}
+
+// Layered combines providers, a parameter defined by an earlier provider overrides the
+// same parameter from a later one. Layered(file, Remote()) forces flags locally.
+type Layered []Provider
+
+func (l Layered) AllConfigs() RemoteConfig {
+	merged := RemoteConfig{Parameters: map[string]Parameter{}}
+	for i := len(l) - 1; i >= 0; i-- {
+		rc := l[i].AllConfigs()
+		for name, p := range rc.Parameters {
+			merged.Parameters[name] = p
+		}
+		merged.Conditions = append(merged.Conditions, rc.Conditions...)
+		if rc.Version.VersionNumber != "" {
+			merged.Version = rc.Version
+		}
+	}
+	return merged
+}
+
+func (l Layered) IsEnabled(name string) bool {
+	return isEnabled(l.AllConfigs(), name)
+}
+
+func (l Layered) Value(name string) string {
+	return value(l.AllConfigs(), name)
+}
@@ -0,0 +1,110 @@
+package firebase
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonTemplate = `{
+	"parameters": {
+		"enable_schedule_once": {"defaultValue": {"value": "true"}, "valueType": "BOOLEAN"},
+		"transfer_limit": {"defaultValue": {"value": "5000"}, "valueType": "NUMBER"}
+	}
+}`
+
+const yamlTemplate = `
+parameters:
+  enable_schedule_monthly:
+    defaultValue:
+      value: "true"
+    valueType: BOOLEAN
+  transfer_limit:
+    defaultValue:
+      value: "100"
+`
+
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestFileProvider(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "features.json")
+		writeFile(t, path, jsonTemplate, time.Now())
+
+		f, err := NewFile(path)
+		assert.NoError(t, err)
+		assert.True(t, f.IsEnabled("enable_schedule_once"))
+		assert.False(t, f.IsEnabled("enable_schedule_monthly"))
+		assert.Equal(t, "5000", f.Value("transfer_limit"))
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "features.yaml")
+		writeFile(t, path, yamlTemplate, time.Now())
+
+		f, err := NewFile(path)
+		assert.NoError(t, err)
+		assert.True(t, f.IsEnabled("enable_schedule_monthly"))
+		assert.Equal(t, "100", f.Value("transfer_limit"))
+		assert.Equal(t, "BOOLEAN", f.AllConfigs().Parameters["enable_schedule_monthly"].ValueType)
+	})
+
+	t.Run("ReloadsOnChangeAndKeepsLastGood", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "features.json")
+		start := time.Now().Add(-time.Hour)
+		writeFile(t, path, jsonTemplate, start)
+
+		f, err := NewFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "5000", f.Value("transfer_limit"))
+
+		writeFile(t, path, `{"parameters":{"transfer_limit":{"defaultValue":{"value":"10"}}}}`, start.Add(time.Minute))
+		assert.NoError(t, f.Reload())
+		assert.Equal(t, "10", f.Value("transfer_limit"))
+
+		writeFile(t, path, `{"parameters":`, start.Add(2*time.Minute))
+		assert.Error(t, f.Reload())
+		assert.Equal(t, "10", f.Value("transfer_limit"))
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		_, err := NewFile(filepath.Join(t.TempDir(), "missing.json"))
+		assert.Error(t, err)
+	})
+}
+
+func TestLayeredProvider(t *testing.T) {
+	local := NewMemory(RemoteConfig{Parameters: map[string]Parameter{
+		"enable_schedule_monthly": {DefaultValue: DefaultValue{Value: "true"}},
+	}})
+	rc := NewMemory(RemoteConfig{
+		Parameters: map[string]Parameter{
+			"enable_schedule_monthly": {DefaultValue: DefaultValue{Value: "false"}},
+			"transfer_limit":          {DefaultValue: DefaultValue{Value: "300"}},
+		},
+		Version: Version{VersionNumber: "7"},
+	})
+
+	p := Layered{local, rc}
+	assert.True(t, p.IsEnabled("enable_schedule_monthly"))
+	assert.Equal(t, "300", p.Value("transfer_limit"))
+	assert.Equal(t, "", p.Value("unknown"))
+	assert.Equal(t, "7", p.AllConfigs().Version.VersionNumber)
+}
+
+func TestSetProvider(t *testing.T) {
+	defer SetProvider(CurrentProvider())
+
+	SetProvider(NewMemory(RemoteConfig{Parameters: map[string]Parameter{
+		"enable_schedule_once": {DefaultValue: DefaultValue{Value: "true"}},
+	}}))
+	assert.True(t, IsEnabled("enable_schedule_once"))
+	assert.True(t, IsDisabled("enable_schedule_monthly"))
+	assert.Len(t, AllConfigs().Parameters, 1)
+}
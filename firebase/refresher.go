@@ -0,0 +1,150 @@
+package firebase
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Status describes the outcome of the latest Remote Config fetches.
+type Status struct {
+	Version             string    `json:"version"`
+	LastAttempt         time.Time `json:"lastAttempt"`
+	LastSuccess         time.Time `json:"lastSuccess"`
+	LastError           string    `json:"lastError,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+}
+
+var (
+	statusMu sync.RWMutex
+	status   Status
+)
+
+// FetchStatus returns the status recorded by the running Refresher.
+func FetchStatus() Status {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	return status
+}
+
+// Refresher keeps the Remote provider in sync with Firebase Remote Config.
+// It polls ListVersion and downloads the template only when a newer VersionNumber is
+// published. On errors the last good config is kept and polling backs off.
+type Refresher struct {
+	// Target receives the downloaded template, defaults to the Remote provider.
+	Target *Memory
+	// BaseURL is the Remote Config API root, defaults to the Firebase endpoint.
+	BaseURL    string
+	Client     *http.Client
+	Interval   time.Duration
+	MaxBackoff time.Duration
+
+	tokenSource oauth2.TokenSource
+	projectID   string
+}
+
+func NewRefresher(tokenSource oauth2.TokenSource, projectID string, interval time.Duration) *Refresher {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Refresher{
+		Target:      remote,
+		BaseURL:     firebaseURL,
+		Client:      http.DefaultClient,
+		Interval:    interval,
+		MaxBackoff:  10 * interval,
+		tokenSource: tokenSource,
+		projectID:   projectID,
+	}
+}
+
+// Run fetches the config right away and then keeps polling until ctx is cancelled.
+func (r *Refresher) Run(ctx context.Context) {
+	for {
+		wait := r.Interval
+		if err := r.Refresh(); err != nil {
+			log.Printf("firebase: unable to refresh remote config: %v", err)
+			wait = r.backoff(FetchStatus().ConsecutiveFailures)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Refresh checks the latest published version and swaps in the new template if it is
+// newer than the one being served.
+func (r *Refresher) Refresh() error {
+	err := r.refresh()
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status.LastAttempt = time.Now()
+	if err != nil {
+		status.LastError = err.Error()
+		status.ConsecutiveFailures++
+		return err
+	}
+	status.LastSuccess = status.LastAttempt
+	status.LastError = ""
+	status.ConsecutiveFailures = 0
+	status.Version = r.Target.AllConfigs().Version.VersionNumber
+	return nil
+}
+
+func (r *Refresher) refresh() error {
+	token, err := r.tokenSource.Token()
+	if err != nil {
+		return err
+	}
+
+	current := r.Target.AllConfigs().Version.VersionNumber
+	if current != "" {
+		versions, err := listVersion(r.Client, r.BaseURL, *token, r.projectID)
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 || !newerVersion(versions[0].VersionNumber, current) {
+			return nil
+		}
+	}
+
+	conf, err := getRemoteConfig(r.Client, r.BaseURL, *token, r.projectID)
+	if err != nil {
+		return err
+	}
+	r.Target.Set(conf)
+	return nil
+}
+
+// backoff doubles the poll interval for every consecutive failure, up to MaxBackoff.
+func (r *Refresher) backoff(failures int) time.Duration {
+	wait := r.Interval
+	for i := 1; i < failures && wait < r.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if r.MaxBackoff > 0 && wait > r.MaxBackoff {
+		wait = r.MaxBackoff
+	}
+	return wait
+}
+
+// newerVersion reports whether version number a was published after b.
+func newerVersion(a, b string) bool {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	if errA != nil || errB != nil {
+		return a != b
+	}
+	return x > y
+}
@@ -0,0 +1,146 @@
+package firebase
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// fakeRemoteConfig serves the two Remote Config endpoints used by the Refresher.
+type fakeRemoteConfig struct {
+	mu        sync.Mutex
+	template  RemoteConfig
+	fail      bool
+	downloads int
+}
+
+func (f *fakeRemoteConfig) publish(version, limit string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.template = RemoteConfig{
+		Parameters: map[string]Parameter{"transfer_limit": {DefaultValue: DefaultValue{Value: limit}}},
+		Version:    Version{VersionNumber: version},
+	}
+}
+
+func (f *fakeRemoteConfig) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if f.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/demo/remoteConfig":
+		f.downloads++
+		json.NewEncoder(w).Encode(f.template)
+	case "/demo/remoteConfig:listVersions":
+		json.NewEncoder(w).Encode(map[string]any{"versions": []Version{f.template.Version}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestRefresher(t *testing.T, fake *fakeRemoteConfig) *Refresher {
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	SetRemoteConfig(RemoteConfig{})
+	statusMu.Lock()
+	status = Status{}
+	statusMu.Unlock()
+
+	r := NewRefresher(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"}), "demo", time.Second)
+	r.BaseURL = srv.URL
+	r.Client = srv.Client()
+	return r
+}
+
+func TestRefresher(t *testing.T) {
+	t.Run("DownloadsOnlyNewerVersions", func(t *testing.T) {
+		fake := &fakeRemoteConfig{}
+		fake.publish("1", "100")
+		r := newTestRefresher(t, fake)
+
+		assert.NoError(t, r.Refresh())
+		assert.Equal(t, "100", Value("transfer_limit"))
+		assert.Equal(t, 1, fake.downloads)
+
+		// same version, nothing to download
+		assert.NoError(t, r.Refresh())
+		assert.Equal(t, 1, fake.downloads)
+
+		fake.publish("2", "200")
+		assert.NoError(t, r.Refresh())
+		assert.Equal(t, "200", Value("transfer_limit"))
+		assert.Equal(t, 2, fake.downloads)
+		assert.Equal(t, "2", FetchStatus().Version)
+	})
+
+	t.Run("KeepsLastGoodConfigOnError", func(t *testing.T) {
+		fake := &fakeRemoteConfig{}
+		fake.publish("1", "100")
+		r := newTestRefresher(t, fake)
+		assert.NoError(t, r.Refresh())
+
+		fake.fail = true
+		fake.publish("2", "200")
+		assert.Error(t, r.Refresh())
+		assert.Error(t, r.Refresh())
+
+		assert.Equal(t, "100", Value("transfer_limit"))
+		st := FetchStatus()
+		assert.Equal(t, "1", st.Version)
+		assert.Equal(t, 2, st.ConsecutiveFailures)
+		assert.Contains(t, st.LastError, "503")
+		assert.True(t, st.LastSuccess.Before(st.LastAttempt) || st.LastSuccess.Equal(st.LastAttempt))
+
+		fake.fail = false
+		assert.NoError(t, r.Refresh())
+		assert.Equal(t, "200", Value("transfer_limit"))
+		assert.Equal(t, 0, FetchStatus().ConsecutiveFailures)
+		assert.Empty(t, FetchStatus().LastError)
+	})
+
+	t.Run("BacksOffUpToMax", func(t *testing.T) {
+		r := &Refresher{Interval: time.Second, MaxBackoff: 5 * time.Second}
+		assert.Equal(t, time.Second, r.backoff(1))
+		assert.Equal(t, 2*time.Second, r.backoff(2))
+		assert.Equal(t, 4*time.Second, r.backoff(3))
+		assert.Equal(t, 5*time.Second, r.backoff(4))
+		assert.Equal(t, 5*time.Second, r.backoff(10))
+	})
+
+	t.Run("ConcurrentReadsDuringSwap", func(t *testing.T) {
+		fake := &fakeRemoteConfig{}
+		r := newTestRefresher(t, fake)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				fake.publish(time.Now().Format("150405000000"), "1")
+				r.Refresh()
+			}()
+			go func() {
+				defer wg.Done()
+				IsEnabled("enable_schedule_once")
+				Value("transfer_limit")
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -2,6 +2,7 @@ package firebase
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -19,9 +20,10 @@ type RemoteConfig struct {
 
 // Parameter represents a single Remote Config parameter.
 type Parameter struct {
-	DefaultValue DefaultValue `json:"defaultValue"`
-	Description  string       `json:"description,omitempty"`
-	ValueType    string       `json:"valueType"`
+	DefaultValue      DefaultValue            `json:"defaultValue"`
+	ConditionalValues map[string]DefaultValue `json:"conditionalValues,omitempty"`
+	Description       string                  `json:"description,omitempty"`
+	ValueType         string                  `json:"valueType"`
 }
 
 // DefaultValue represents the default value of a parameter.
@@ -52,23 +54,27 @@ type Condition struct {
 	TagColor   string `json:"tagColor,omitempty"`
 }
 
-var remoteConfig RemoteConfig
+// remote is the template downloaded from Firebase Remote Config, kept fresh by a Refresher.
+var remote = NewMemory(RemoteConfig{})
 
+// Remote returns the provider serving the Firebase Remote Config template.
+func Remote() *Memory {
+	return remote
+}
+
+// AllConfigs returns the config snapshot of the current provider. The snapshot is
+// replaced as a whole on updates and must not be modified by the caller.
 func AllConfigs() RemoteConfig {
-	return remoteConfig
+	return CurrentProvider().AllConfigs()
 }
 
+// SetRemoteConfig replaces the Firebase Remote Config template.
 func SetRemoteConfig(rf RemoteConfig) {
-	remoteConfig = rf
+	remote.Set(rf)
 }
 
 func IsEnabled(name string) bool {
-	v, ok := remoteConfig.Parameters[name]
-	if !ok {
-		return false
-	}
-
-	return v.DefaultValue.Value == "true"
+	return CurrentProvider().IsEnabled(name)
 }
 
 func IsDisabled(name string) bool {
@@ -76,37 +82,41 @@ func IsDisabled(name string) bool {
 }
 
 func Value(name string) string {
-	v, ok := remoteConfig.Parameters[name]
-	if !ok {
-		return ""
-	}
-
-	return v.DefaultValue.Value
+	return CurrentProvider().Value(name)
 }
 
 func GetRemoteConfig(token oauth2.Token, projectID string) (RemoteConfig, error) {
-	url := firebaseURL + "/" + projectID + "/remoteConfig"
+	return getRemoteConfig(http.DefaultClient, firebaseURL, token, projectID)
+}
+
+func ListVersion(token oauth2.Token, projectID string) ([]Version, error) {
+	return listVersion(http.DefaultClient, firebaseURL, token, projectID)
+}
+
+func getRemoteConfig(client *http.Client, baseURL string, token oauth2.Token, projectID string) (RemoteConfig, error) {
+	url := baseURL + "/" + projectID + "/remoteConfig"
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return RemoteConfig{}, err
 	}
 	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		return RemoteConfig{}, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return RemoteConfig{}, fmt.Errorf("get remote config: unexpected status %s", resp.Status)
+	}
 
 	config := RemoteConfig{}
 	err = json.NewDecoder(resp.Body).Decode(&config)
 	return config, err
 }
 
-func ListVersion(token oauth2.Token, projectID string) ([]Version, error) {
-	client := &http.Client{}
-	url := firebaseURL + "/" + projectID + "/remoteConfig:listVersions?pageSize=1"
+func listVersion(client *http.Client, baseURL string, token oauth2.Token, projectID string) ([]Version, error) {
+	url := baseURL + "/" + projectID + "/remoteConfig:listVersions?pageSize=1"
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -117,6 +127,9 @@ func ListVersion(token oauth2.Token, projectID string) ([]Version, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list versions: unexpected status %s", resp.Status)
+	}
 
 	vers := struct {
 		Versions      []Version `json:"versions"`
@@ -0,0 +1,74 @@
+// Package fx converts amounts between currencies.
+//
+// Amounts are integers in the minor units of their currency as defined by ISO 4217, so
+// 1 USD is 100 and 1 JPY is 1. Rates are exact decimals and a converted amount is rounded
+// once, to the minor units of the target currency.
+package fx
+
+import (
+	"errors"
+	"math/big"
+
+	"demo/money"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrOverflow        = errors.New("converted amount out of range")
+)
+
+// Convert converts amount, in minor units of from, to minor units of to at rate, the price
+// of one unit of from in units of to. The result is rounded half away from zero.
+func Convert(amount int64, from, to string, rate *big.Rat) (int64, error) {
+	fromUnits, ok := money.MinorUnits(from)
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	toUnits, ok := money.MinorUnits(to)
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+
+	v := new(big.Rat).SetInt64(amount)
+	v.Mul(v, rate)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(toUnits-fromUnits))), nil))
+	if toUnits >= fromUnits {
+		v.Mul(v, scale)
+	} else {
+		v.Quo(v, scale)
+	}
+	return round(v)
+}
+
+// round rounds v half away from zero to an int64.
+func round(v *big.Rat) (int64, error) {
+	num := new(big.Int).Abs(v.Num())
+	q, r := new(big.Int).QuoRem(num, v.Denom(), new(big.Int))
+	if r.Lsh(r, 1).Cmp(v.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if v.Sign() < 0 {
+		q.Neg(q)
+	}
+	if !q.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return q.Int64(), nil
+}
+
+// Prorate returns part/whole of total, rounded half away from zero, for splitting a
+// converted amount the same way as the amount it was converted from.
+func Prorate(total, part, whole int64) (int64, error) {
+	if whole == 0 {
+		return 0, ErrOverflow
+	}
+	v := new(big.Rat).SetFrac(big.NewInt(part), big.NewInt(whole))
+	return round(v.Mul(v, new(big.Rat).SetInt64(total)))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,64 @@
+package fx
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rat(s string) *big.Rat {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		panic(s)
+	}
+	return r
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		from, to string
+		rate     string
+		want     int64
+	}{
+		{"SameUnits", 10000, "USD", "THB", "35.125", 351250},
+		{"RoundsHalfUp", 1, "USD", "THB", "35.5", 36},
+		{"RoundsDown", 1, "USD", "THB", "35.49", 35},
+		{"NegativeRoundsAwayFromZero", -1, "USD", "THB", "35.5", -36},
+		{"ToNoMinorUnits", 10050, "USD", "JPY", "150.3", 15105},
+		{"FromNoMinorUnits", 1000, "JPY", "THB", "0.2271", 22710},
+		{"ToThreeMinorUnits", 10000, "USD", "KWD", "0.30755", 30755},
+		{"FromThreeMinorUnits", 1000, "KWD", "USD", "3.2515", 325},
+		{"HalfAtThreeMinorUnits", 5, "KWD", "JPY", "1", 0},
+		{"HalfToEvenIsNotUsed", 25, "THB", "USD", "0.1", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Convert(tt.amount, tt.from, tt.to, rat(tt.rate))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := Convert(1, "USD", "ABC", rat("1"))
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+	_, err = Convert(math.MaxInt64, "JPY", "KWD", rat("1000"))
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestProrate(t *testing.T) {
+	got, err := Prorate(351250, 5000, 10000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(175625), got)
+
+	got, err = Prorate(100, 1, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(33), got)
+
+	got, err = Prorate(math.MaxInt64, math.MaxInt64, math.MaxInt64)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), got)
+}
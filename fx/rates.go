@@ -0,0 +1,272 @@
+package fx
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"demo/money"
+)
+
+var (
+	ErrNoRate      = errors.New("no exchange rate")
+	ErrInvalidRate = errors.New("invalid exchange rate")
+)
+
+// inverseDecimals is how many decimals a rate derived from the opposite pair is quoted with.
+const inverseDecimals = 10
+
+// Rate is the price of one unit of From in units of To, from EffectiveFrom until the next
+// rate of the same pair takes effect.
+type Rate struct {
+	From          string
+	To            string
+	Rate          *big.Rat
+	EffectiveFrom time.Time
+}
+
+// String renders the rate as a decimal.
+func (r Rate) String() string {
+	return FormatRate(r.Rate)
+}
+
+type pair struct{ from, to string }
+
+// Table holds dated exchange rates. It is safe for concurrent use once built.
+type Table struct {
+	rates map[pair][]Rate
+}
+
+// NewTable builds a table from rates. Every rate must be positive and between two known,
+// different currencies; a pair can have one rate per effective time.
+func NewTable(rates []Rate) (*Table, error) {
+	t := &Table{rates: map[pair][]Rate{}}
+	for _, r := range rates {
+		switch {
+		case !money.Valid(r.From) || !money.Valid(r.To):
+			return nil, fmt.Errorf("%w: %s/%s", ErrUnknownCurrency, r.From, r.To)
+		case r.From == r.To:
+			return nil, fmt.Errorf("%w: %s/%s converts to itself", ErrInvalidRate, r.From, r.To)
+		case r.Rate == nil || r.Rate.Sign() <= 0:
+			return nil, fmt.Errorf("%w: %s/%s must be positive", ErrInvalidRate, r.From, r.To)
+		}
+		p := pair{r.From, r.To}
+		t.rates[p] = append(t.rates[p], r)
+	}
+	for p, rs := range t.rates {
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].EffectiveFrom.Before(rs[j].EffectiveFrom) })
+		for i := 1; i < len(rs); i++ {
+			if rs[i].EffectiveFrom.Equal(rs[i-1].EffectiveFrom) {
+				return nil, fmt.Errorf("%w: %s/%s has two rates effective %s", ErrInvalidRate, p.from, p.to, rs[i].EffectiveFrom.Format(time.RFC3339))
+			}
+		}
+	}
+	return t, nil
+}
+
+// Rate returns the rate from one currency to another effective at. Without a rate for the
+// pair the inverse of the opposite pair is used, quoted with a fixed number of decimals.
+func (t *Table) Rate(from, to string, at time.Time) (Rate, error) {
+	if r, ok := t.effective(pair{from, to}, at); ok {
+		return r, nil
+	}
+	if r, ok := t.effective(pair{to, from}, at); ok {
+		if inverse := Invert(r.Rate); inverse.Sign() > 0 {
+			return Rate{From: from, To: to, Rate: inverse, EffectiveFrom: r.EffectiveFrom}, nil
+		}
+	}
+	return Rate{}, fmt.Errorf("%w from %s to %s at %s", ErrNoRate, from, to, at.Format(time.RFC3339))
+}
+
+func (t *Table) effective(p pair, at time.Time) (Rate, bool) {
+	rs := t.rates[p]
+	// the first rate that takes effect after at, the one before it applies
+	i := sort.Search(len(rs), func(i int) bool { return rs[i].EffectiveFrom.After(at) })
+	if i == 0 {
+		return Rate{}, false
+	}
+	return rs[i-1], true
+}
+
+// Quote is amount of From converted to To at a quoted rate.
+type Quote struct {
+	Rate      Rate
+	Amount    int64
+	Converted int64
+}
+
+// Quote converts amount of from to to at the rate effective at.
+func (t *Table) Quote(amount int64, from, to string, at time.Time) (Quote, error) {
+	r, err := t.Rate(from, to, at)
+	if err != nil {
+		return Quote{}, err
+	}
+	converted, err := Convert(amount, from, to, r.Rate)
+	if err != nil {
+		return Quote{}, err
+	}
+	return Quote{Rate: r, Amount: amount, Converted: converted}, nil
+}
+
+// Invert returns the rate of the opposite pair, 1/r quoted with a fixed number of decimals.
+func Invert(r *big.Rat) *big.Rat {
+	inverse, _ := new(big.Rat).SetString(new(big.Rat).Inv(r).FloatString(inverseDecimals))
+	return inverse
+}
+
+// FormatRate renders r as a decimal.
+func FormatRate(r *big.Rat) string {
+	return decimal(r)
+}
+
+// ParseRate parses a rate written as a decimal such as "35.125".
+func ParseRate(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, "/eE") {
+		return nil, fmt.Errorf("%w: %q is not a decimal", ErrInvalidRate, s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not a decimal", ErrInvalidRate, s)
+	}
+	return r, nil
+}
+
+// parseEffective accepts a date, taken as midnight UTC, or an RFC3339 time.
+func parseEffective(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if at, err := time.Parse("2006-01-02", s); err == nil {
+		return at, nil
+	}
+	at, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("effective date %q must be YYYY-MM-DD or RFC3339", s)
+	}
+	return at, nil
+}
+
+// Load reads a rate table from a JSON or CSV file, chosen by its extension.
+//
+// JSON is an array of {"from": "USD", "to": "THB", "rate": "35.125", "effectiveFrom": "2025-01-01"};
+// CSV has the columns from,to,rate,effective_from with a header row.
+func Load(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rates []Rate
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		rates, err = readJSON(f)
+	case ".csv":
+		rates, err = readCSV(f)
+	default:
+		return nil, fmt.Errorf("%s: rate files must be .json or .csv", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t, err := NewTable(rates)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+func readJSON(r io.Reader) ([]Rate, error) {
+	var rows []struct {
+		From          string `json:"from"`
+		To            string `json:"to"`
+		Rate          string `json:"rate"`
+		EffectiveFrom string `json:"effectiveFrom"`
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rows); err != nil {
+		return nil, err
+	}
+
+	rates := make([]Rate, 0, len(rows))
+	for i, row := range rows {
+		rate, err := parseRow(row.From, row.To, row.Rate, row.EffectiveFrom)
+		if err != nil {
+			return nil, fmt.Errorf("rate %d: %w", i+1, err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+func readCSV(r io.Reader) ([]Rate, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 4
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	rates := make([]Rate, 0, len(records)-1)
+	for i, rec := range records[1:] {
+		rate, err := parseRow(rec[0], rec[1], rec[2], rec[3])
+		if err != nil {
+			// count the header, lines are 1-based
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+func parseRow(from, to, rate, effectiveFrom string) (Rate, error) {
+	r, err := ParseRate(rate)
+	if err != nil {
+		return Rate{}, err
+	}
+	at, err := parseEffective(effectiveFrom)
+	if err != nil {
+		return Rate{}, err
+	}
+	return Rate{From: strings.TrimSpace(from), To: strings.TrimSpace(to), Rate: r, EffectiveFrom: at}, nil
+}
+
+// decimal renders r with as many decimals as it needs, r must be a terminating decimal.
+func decimal(r *big.Rat) string {
+	if r == nil {
+		return ""
+	}
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	// a terminating decimal has a denominator of the form 2^a*5^b, needing max(a, b) decimals
+	d := new(big.Int).Set(r.Denom())
+	digits := 0
+	for d.Cmp(big.NewInt(1)) != 0 && digits < 64 {
+		var m big.Int
+		switch {
+		case m.Mod(d, big.NewInt(10)).Sign() == 0:
+			d.Quo(d, big.NewInt(10))
+		case m.Mod(d, big.NewInt(2)).Sign() == 0:
+			d.Quo(d, big.NewInt(2))
+		case m.Mod(d, big.NewInt(5)).Sign() == 0:
+			d.Quo(d, big.NewInt(5))
+		default:
+			return strings.TrimRight(strings.TrimRight(r.FloatString(inverseDecimals), "0"), ".")
+		}
+		digits++
+	}
+	return r.FloatString(digits)
+}
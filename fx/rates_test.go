@@ -0,0 +1,125 @@
+package fx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(s string) time.Time {
+	at, err := time.Parse("2006-01-02 15:04:05", s)
+	if err != nil {
+		panic(err)
+	}
+	return at
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestTableRate(t *testing.T) {
+	table, err := NewTable([]Rate{
+		{From: "USD", To: "THB", Rate: rat("36"), EffectiveFrom: date("2025-02-01 00:00:00")},
+		{From: "USD", To: "THB", Rate: rat("35.125"), EffectiveFrom: date("2025-01-01 00:00:00")},
+	})
+	assert.NoError(t, err)
+
+	r, err := table.Rate("USD", "THB", date("2025-01-31 23:59:59"))
+	assert.NoError(t, err)
+	assert.Equal(t, "35.125", r.String())
+
+	r, err = table.Rate("USD", "THB", date("2025-02-01 00:00:00"))
+	assert.NoError(t, err)
+	assert.Equal(t, "36", r.String())
+
+	// the opposite pair is inverted and quoted with fixed decimals
+	r, err = table.Rate("THB", "USD", date("2025-02-15 00:00:00"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0277777778", r.String())
+	assert.Equal(t, date("2025-02-01 00:00:00"), r.EffectiveFrom)
+
+	_, err = table.Rate("USD", "THB", date("2024-12-31 23:59:59"))
+	assert.ErrorIs(t, err, ErrNoRate)
+	_, err = table.Rate("USD", "EUR", date("2025-02-01 00:00:00"))
+	assert.ErrorIs(t, err, ErrNoRate)
+}
+
+func TestTableQuote(t *testing.T) {
+	table, err := NewTable([]Rate{{From: "USD", To: "JPY", Rate: rat("150.255"), EffectiveFrom: date("2025-01-01 00:00:00")}})
+	assert.NoError(t, err)
+
+	q, err := table.Quote(1999, "USD", "JPY", date("2025-03-01 00:00:00"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1999), q.Amount)
+	// 19.99 * 150.255 = 3003.59745, JPY has no minor units
+	assert.Equal(t, int64(3004), q.Converted)
+	assert.Equal(t, "150.255", q.Rate.String())
+}
+
+func TestNewTableRejectsInvalidRates(t *testing.T) {
+	on := date("2025-01-01 00:00:00")
+	tests := map[string][]Rate{
+		"UnknownCurrency": {{From: "USD", To: "ABC", Rate: rat("1"), EffectiveFrom: on}},
+		"SameCurrency":    {{From: "USD", To: "USD", Rate: rat("1"), EffectiveFrom: on}},
+		"ZeroRate":        {{From: "USD", To: "THB", Rate: rat("0"), EffectiveFrom: on}},
+		"NegativeRate":    {{From: "USD", To: "THB", Rate: rat("-35"), EffectiveFrom: on}},
+		"SameEffectiveFrom": {
+			{From: "USD", To: "THB", Rate: rat("35"), EffectiveFrom: on},
+			{From: "USD", To: "THB", Rate: rat("36"), EffectiveFrom: on},
+		},
+	}
+	for name, rates := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewTable(rates)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	at := date("2025-01-15 12:00:00")
+
+	t.Run("JSON", func(t *testing.T) {
+		path := writeFile(t, "rates.json", `[
+			{"from": "USD", "to": "THB", "rate": "35.125", "effectiveFrom": "2025-01-01"},
+			{"from": "EUR", "to": "THB", "rate": "37.5", "effectiveFrom": "2025-01-15T12:00:00Z"}
+		]`)
+		table, err := Load(path)
+		assert.NoError(t, err)
+
+		r, err := table.Rate("EUR", "THB", at)
+		assert.NoError(t, err)
+		assert.Equal(t, "37.5", r.String())
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		path := writeFile(t, "rates.csv", "from,to,rate,effective_from\nUSD,THB,35.125,2025-01-01\nUSD,THB,34.9,2025-01-16\n")
+		table, err := Load(path)
+		assert.NoError(t, err)
+
+		r, err := table.Rate("USD", "THB", at)
+		assert.NoError(t, err)
+		assert.Equal(t, "35.125", r.String())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		files := map[string]string{
+			"rates.json": `[{"from": "USD", "to": "THB", "rate": "1e3", "effectiveFrom": "2025-01-01"}]`,
+			"dates.json": `[{"from": "USD", "to": "THB", "rate": "35", "effectiveFrom": "01/01/2025"}]`,
+			"rates.csv":  "from,to,rate,effective_from\nUSD,THB,abc,2025-01-01\n",
+			"rates.txt":  "",
+		}
+		for name, content := range files {
+			_, err := Load(writeFile(t, name, content))
+			assert.Error(t, err, name)
+		}
+		_, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+		assert.Error(t, err)
+	})
+}
@@ -28,8 +28,8 @@ func setupTestDB() (*sql.DB, func(), error) {
 
 	// Insert test data
 	_, err = db.Exec(`
-		INSERT INTO accounts (branch, account_number, type, account_name, balance, available_balance, currency)
-		VALUES ('Main', '12345', 'Savings', 'John Doe', 1000, 1000, 'USD');
+		INSERT INTO accounts (branch, account_number, type, account_name, balance, currency)
+		VALUES ('Main', '12345', 'Savings', 'John Doe', 1000, 'USD');
 	`)
 	if err != nil {
 		return nil, nil, err
@@ -37,7 +37,7 @@ func setupTestDB() (*sql.DB, func(), error) {
 
 	_, err = db.Exec(`
 		INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at)
-		VALUES ('txn1', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer', 100, 'USD', 'Payment for services', '2025-01-01 12:00:00');
+		VALUES ('txn1', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer', 100, 'USD', 'Payment for services', '2025-01-01T12:00:00Z');
 	`)
 	if err != nil {
 		return nil, nil, err
@@ -76,7 +76,7 @@ func TestGetBalance(t *testing.T) {
 
 		// Assert the response
 		assert.Equal(t, http.StatusOK, w.Code)
-		expected := `{"branch":"Main","number":"12345","type":"Savings","name":"John Doe","currentBalance":1000,"availableBalance":1000,"currency":"USD"}`
+		expected := `{"branch":"Main","number":"12345","type":"Savings","name":"John Doe","currentBalance":{"minorUnits":1000,"value":"10.00","currency":"USD"},"availableBalance":{"minorUnits":1000,"value":"10.00","currency":"USD"},"currency":"USD"}`
 		assert.JSONEq(t, expected, w.Body.String())
 	})
 }
@@ -105,7 +105,7 @@ func TestGetAllTransactions(t *testing.T) {
 
 		// Assert the response
 		assert.Equal(t, http.StatusOK, w.Code)
-		expected := `[{"transactionId":"txn1","accountNumber":"12345","fromAccount":"12345","toAccount":"54321","toAccountName":"Jane Doe","toBank":"Bank B","type":"Transfer","amount":100,"currency":"USD","note":"Payment for services","transferredAt":"2025-01-01T12:00:00Z"}]`
+		expected := `{"transactions":[{"transactionId":"txn1","accountNumber":"12345","fromAccount":"12345","toAccount":"54321","toAccountName":"Jane Doe","toBank":"Bank B","type":"Transfer","amount":{"minorUnits":100,"value":"1.00","currency":"USD"},"note":"Payment for services","transferredAt":"2025-01-01T12:00:00Z"}]}`
 		assert.JSONEq(t, expected, w.Body.String())
 	})
 }
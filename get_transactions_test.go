@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -28,8 +29,8 @@ func setupTestDBGetTransactions(dbName string) (*sql.DB, func(), error) {
 
 	// Insert test data
 	_, err = db.Exec(`
-		INSERT INTO accounts (branch, account_number, type, account_name, balance, available_balance, currency)
-		VALUES ('Main', '12345', 'Savings', 'John Doe', 1000, 1000, 'USD');
+		INSERT INTO accounts (branch, account_number, type, account_name, balance, currency)
+		VALUES ('Main', '12345', 'Savings', 'John Doe', 1000, 'USD');
 	`)
 	if err != nil {
 		return nil, nil, err
@@ -37,9 +38,9 @@ func setupTestDBGetTransactions(dbName string) (*sql.DB, func(), error) {
 
 	_, err = db.Exec(`
 		INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at)
-		VALUES ('txn1', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer', 100, 'USD', 'Payment for services', '2025-01-01 12:00:00');
+		VALUES ('txn1', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer', 100, 'USD', 'Payment for services', '2025-01-01T12:00:00Z');
 		INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at)
-		VALUES ('txn2', '12345', '12345', '54322', 'Jake Doe', 'Bank C', 'Transfer', 200, 'USD', 'Payment for goods', '2025-01-02 13:00:00');
+		VALUES ('txn2', '12345', '12345', '54322', 'Jake Doe', 'Bank C', 'Transfer', 200, 'USD', 'Payment for goods', '2025-01-02T13:00:00Z');
 	`)
 	if err != nil {
 		return nil, nil, err
@@ -79,7 +80,7 @@ func TestGetTransactions(t *testing.T) {
 
 		// Assert the response
 		assert.Equal(t, http.StatusOK, w.Code)
-		expected := `[
+		expected := `{"transactions": [
 		{
 			"transactionId": "txn2",
 			"accountNumber": "12345",
@@ -88,8 +89,7 @@ func TestGetTransactions(t *testing.T) {
 			"toAccountName": "Jake Doe",
 			"toBank": "Bank C",
 			"type": "Transfer",
-			"amount": 200,
-			"currency": "USD",
+			"amount": {"minorUnits": 200, "value": "2.00", "currency": "USD"},
 			"note": "Payment for goods",
 			"transferredAt": "2025-01-02T13:00:00Z"
 		},
@@ -101,12 +101,11 @@ func TestGetTransactions(t *testing.T) {
 			"toAccountName": "Jane Doe",
 			"toBank": "Bank B",
 			"type": "Transfer",
-			"amount": 100,
-			"currency": "USD",
+			"amount": {"minorUnits": 100, "value": "1.00", "currency": "USD"},
 			"note": "Payment for services",
 			"transferredAt": "2025-01-01T12:00:00Z"
 		}
-	]`
+	]}`
 		assert.JSONEq(t, expected, w.Body.String())
 	})
 
@@ -123,6 +122,9 @@ func TestGetTransactions(t *testing.T) {
 		r := gin.Default()
 		r.GET("/account/:accountNumber/transactions", handler.GetTransactions)
 
+		_, err = db.Exec(`INSERT INTO accounts (account_number, account_name, currency) VALUES ('99999', 'No Transactions', 'USD')`)
+		assert.NoError(t, err)
+
 		// Test GET /account/99999/transactions (Account with no transactions)
 		req, err := http.NewRequest(http.MethodGet, "/account/99999/transactions", nil)
 		assert.NoError(t, err)
@@ -133,7 +135,7 @@ func TestGetTransactions(t *testing.T) {
 
 		// Assert the response
 		assert.Equal(t, http.StatusOK, w.Code)
-		expected := `[]`
+		expected := `{"transactions":[]}`
 		assert.JSONEq(t, expected, w.Body.String())
 	})
 
@@ -162,8 +164,115 @@ func TestGetTransactions(t *testing.T) {
 		r.ServeHTTP(w, req)
 
 		// Assert the response
-		assert.Equal(t, http.StatusInternalServerError, w.Code)
-		expected := `{"error":"unable to get transactions: sql: database is closed"}`
-		assert.JSONEq(t, expected, w.Body.String())
+		// the SQL error is logged, not sent
+		assertError(t, w, http.StatusInternalServerError, codeInternal, "unable to get transactions")
 	})
 }
+
+func setupTestDBTransactionHistory(t *testing.T, dbName string) (*gin.Engine, func()) {
+	db, cleanup, err := setupTestDBGetTransactions(dbName)
+	assert.NoError(t, err)
+
+	// txn3 to txn5 share the same second
+	_, err = db.Exec(`
+		INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at)
+		VALUES
+			('txn3', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer out', -300, 'USD', 'Rent 100%', '2025-01-03T09:00:00Z'),
+			('txn4', '12345', '54321', '12345', 'John Doe', 'Bank A', 'Transfer in', 50, 'USD', 'Refund', '2025-01-03T09:00:00Z'),
+			('txn5', '12345', '12345', '54322', 'Jake Doe', 'Bank C', 'Transfer out', -75, 'USD', 'Lunch', '2025-01-03T09:00:00Z'),
+			('txn4', '54321', '54321', '12345', 'John Doe', 'Bank A', 'Transfer out', -50, 'USD', 'Refund', '2025-01-03T09:00:00Z');
+	`)
+	assert.NoError(t, err)
+
+	handler := &Handler{db: db}
+	r := gin.Default()
+	r.GET("/accounts/:accountNumber/transactions", handler.GetTransactions)
+	r.GET("/transactions", handler.GetAllTransactions)
+	return r, cleanup
+}
+
+func getTransactionPage(t *testing.T, r *gin.Engine, path string) TransactionPage {
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var page TransactionPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	return page
+}
+
+func transactionIDs(page TransactionPage) []string {
+	ids := []string{}
+	for _, txn := range page.Transactions {
+		ids = append(ids, txn.TransactionID)
+	}
+	return ids
+}
+
+func TestTransactionHistoryPagination(t *testing.T) {
+	r, cleanup := setupTestDBTransactionHistory(t, "transaction_history_pages")
+	defer cleanup()
+
+	// walking the pages visits every row exactly once, in a stable order
+	var ids []string
+	path := "/accounts/12345/transactions?limit=2"
+	for pages := 0; ; pages++ {
+		assert.Less(t, pages, 5)
+		page := getTransactionPage(t, r, path)
+		ids = append(ids, transactionIDs(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/accounts/12345/transactions?limit=2&cursor=" + page.NextCursor
+	}
+	assert.Equal(t, []string{"txn5", "txn4", "txn3", "txn2", "txn1"}, ids)
+
+	all := getTransactionPage(t, r, "/transactions?limit=10")
+	assert.Len(t, all.Transactions, 6)
+	assert.Empty(t, all.NextCursor)
+}
+
+func TestTransactionHistoryFilters(t *testing.T) {
+	r, cleanup := setupTestDBTransactionHistory(t, "transaction_history_filters")
+	defer cleanup()
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"From", "from=2025-01-02", []string{"txn5", "txn4", "txn3", "txn2"}},
+		{"ToWholeDay", "to=2025-01-02", []string{"txn2", "txn1"}},
+		{"RFC3339Range", "from=2025-01-01T12:00:00Z&to=2025-01-02T13:00:00Z", []string{"txn2", "txn1"}},
+		{"TypeOut", "type=Transfer+out", []string{"txn5", "txn3"}},
+		{"AmountRangeIgnoresSign", "minAmount=75&maxAmount=200", []string{"txn5", "txn2", "txn1"}},
+		{"Counterparty", "counterparty=54321", []string{"txn4", "txn3", "txn1"}},
+		{"NoteIsCaseInsensitive", "note=payment", []string{"txn2", "txn1"}},
+		{"NoteWildcardIsLiteral", "note=100%25", []string{"txn3"}},
+		{"Combined", "type=Transfer+out&counterparty=54322", []string{"txn5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := getTransactionPage(t, r, "/accounts/12345/transactions?"+tt.query)
+			assert.Equal(t, tt.want, transactionIDs(page))
+		})
+	}
+}
+
+func TestTransactionHistoryInvalidQuery(t *testing.T) {
+	r, cleanup := setupTestDBTransactionHistory(t, "transaction_history_invalid")
+	defer cleanup()
+
+	for _, query := range []string{"limit=0", "limit=501", "cursor=nope", "from=yesterday", "type=Deposit", "minAmount=-1", "maxAmount=abc"} {
+		t.Run(query, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/transactions?"+query, nil)
+			assert.NoError(t, err)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Hold statuses. An ACTIVE hold reserves funds; it is CAPTURED when the money leaves the
+// account or RELEASED when it is no longer needed.
+const (
+	HoldActive   = "ACTIVE"
+	HoldCaptured = "CAPTURED"
+	HoldReleased = "RELEASED"
+)
+
+var errHoldNotActive = errors.New("hold is not active")
+
+// availableBalanceSQL is the available balance of the account row aliased as a:
+// the balance minus every active hold on it.
+const availableBalanceSQL = `a.balance - (
+            SELECT COALESCE(SUM(hl.amount), 0)
+            FROM holds hl
+            WHERE hl.account_number = a.account_number
+            AND hl.status = 'ACTIVE')`
+
+// Hold reserves part of an account balance for a transfer or an upcoming scheduled debit.
+// Transfers settle within the database transaction that makes them, so the hold of a transfer
+// is placed and captured together and is never seen ACTIVE; only the holds placed ahead of
+// scheduled runs stay ACTIVE past the request that placed them.
+type Hold struct {
+	HoldID        string      `json:"holdId"`
+	AccountNumber string      `json:"accountNumber"`
+	Amount        money.Money `json:"amount"`
+	TransactionID string      `json:"transactionId,omitempty"`
+	ScheduleID    string      `json:"scheduleId,omitempty"`
+	Status        string      `json:"status"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	UpdatedAt     time.Time   `json:"updatedAt"`
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// placeHold reserves hold.Amount on hold.AccountNumber, but only if the available balance
+// covers it. The check and the insert are a single statement so concurrent holds can never
+// reserve more than the account has. It fills in the hold ID and status.
+func (h *Handler) placeHold(tx *sql.Tx, hold *Hold, stamp string) error {
+	var res sql.Result
+	var err error
+	for attempt := 1; attempt <= maxIDAttempts; attempt++ {
+		hold.HoldID = h.nextID("HLD")
+		res, err = tx.Exec(`
+        INSERT INTO holds (hold_id, account_number, amount, currency, transaction_id, schedule_id, status, created_at, updated_at)
+        SELECT $1, a.account_number, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $7
+        FROM accounts a
+        WHERE a.account_number = $8
+        AND `+availableBalanceSQL+` >= $2`,
+			hold.HoldID, hold.Amount.Minor, hold.Amount.Currency, hold.TransactionID, hold.ScheduleID, HoldActive, stamp, hold.AccountNumber)
+		if !isUniqueViolation(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to place hold: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to place hold: %w", err)
+	}
+	if n == 0 {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM accounts WHERE account_number = $1)`, hold.AccountNumber).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("unable to check available balance: %w", err)
+		}
+		if !exists {
+			return errAccountNotFound
+		}
+		return errInsufficientBalance
+	}
+	hold.Status = HoldActive
+	return nil
+}
+
+// captureHold settles an active hold: its amount is debited from the balance of the account.
+func (h *Handler) captureHold(tx *sql.Tx, hold *Hold, stamp string) error {
+	if err := h.settleHold(tx, hold, HoldCaptured, stamp); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+        UPDATE accounts
+        SET balance = balance - $1
+        WHERE account_number = $2`,
+		hold.Amount.Minor, hold.AccountNumber)
+	if err != nil {
+		return fmt.Errorf("unable to update sender balance: %w", err)
+	}
+	return nil
+}
+
+// settleHold moves an active hold to status.
+func (h *Handler) settleHold(tx *sql.Tx, hold *Hold, status, stamp string) error {
+	res, err := tx.Exec(`
+        UPDATE holds
+        SET status = $1, updated_at = $2
+        WHERE hold_id = $3
+        AND status = 'ACTIVE'`,
+		status, stamp, hold.HoldID)
+	if err != nil {
+		return fmt.Errorf("unable to update hold: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errHoldNotActive
+	}
+	hold.Status = status
+	return nil
+}
+
+// releaseScheduleHolds releases the active holds placed for upcoming runs of a schedule.
+func (h *Handler) releaseScheduleHolds(db execer, scheduleID, stamp string) error {
+	_, err := db.Exec(`
+        UPDATE holds
+        SET status = 'RELEASED', updated_at = $1
+        WHERE schedule_id = $2
+        AND transaction_id IS NULL
+        AND status = 'ACTIVE'`,
+		stamp, scheduleID)
+	if err != nil {
+		return fmt.Errorf("unable to release schedule holds: %w", err)
+	}
+	return nil
+}
+
+// getHolds lists the holds on an account, newest first, optionally only those in status.
+func (h *Handler) getHolds(accountNo, status string) ([]Hold, error) {
+	rows, err := h.db.Query(`
+        SELECT hold_id, account_number, amount, currency, COALESCE(transaction_id, ''), COALESCE(schedule_id, ''),
+            status, created_at, updated_at
+        FROM holds
+        WHERE account_number = $1
+        AND ($2 = '' OR status = $2)
+        ORDER BY created_at DESC, hold_id DESC`, accountNo, status)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get holds: %w", err)
+	}
+	defer rows.Close()
+
+	holds := []Hold{}
+	for rows.Next() {
+		var hold Hold
+		var createdAt, updatedAt string
+		if err := rows.Scan(&hold.HoldID, &hold.AccountNumber, &hold.Amount.Minor, &hold.Amount.Currency, &hold.TransactionID, &hold.ScheduleID,
+			&hold.Status, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("unable to scan hold: %w", err)
+		}
+		if hold.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("invalid created_at: %w", err)
+		}
+		if hold.UpdatedAt, err = parseTime(updatedAt); err != nil {
+			return nil, fmt.Errorf("invalid updated_at: %w", err)
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// GetHolds handler
+func (h *Handler) GetHolds(c *gin.Context) {
+	accountNo := c.Param("accountNumber")
+	if err := h.accountExists(accountNo); err != nil {
+		abortWithError(c, err, "unable to get holds")
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", HoldActive, HoldCaptured, HoldReleased:
+	default:
+		abortWithError(c, badRequest("invalid status"), "")
+		return
+	}
+
+	holds, err := h.getHolds(accountNo, status)
+	if err != nil {
+		abortWithError(c, err, "unable to get holds")
+		return
+	}
+
+	c.JSON(http.StatusOK, holds)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func availableOf(t *testing.T, h *Handler, accountNo string) int64 {
+	account, err := h.getAccount(accountNo)
+	assert.NoError(t, err)
+	return account.AvailableBalance.Minor
+}
+
+func getHolds(t *testing.T, r *gin.Engine, path string) (int, []Hold) {
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var holds []Hold
+	if w.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &holds))
+	}
+	return w.Code, holds
+}
+
+func insertHold(t *testing.T, db *sql.DB, id, accountNo string, amount int64) {
+	_, err := db.Exec(`
+		INSERT INTO holds (hold_id, account_number, amount, currency, status, created_at, updated_at)
+		VALUES ($1, $2, $3, 'USD', 'ACTIVE', '2025-01-01T00:00:00Z', '2025-01-01T00:00:00Z')`,
+		id, accountNo, amount)
+	assert.NoError(t, err)
+}
+
+func TestHolds(t *testing.T) {
+	t.Run("TransferCapturesItsHold", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("holds_transfer_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+		r.GET("/accounts/:accountNumber/holds", handler.GetHolds)
+
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp := TransferResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		code, holds := getHolds(t, r, "/accounts/12345/holds")
+		assert.Equal(t, http.StatusOK, code)
+		if assert.Len(t, holds, 1) {
+			assert.Equal(t, HoldCaptured, holds[0].Status)
+			assert.Equal(t, resp.TransactionID, holds[0].TransactionID)
+			assert.Equal(t, money.New(200, "USD"), holds[0].Amount)
+		}
+
+		code, holds = getHolds(t, r, "/accounts/12345/holds?status=ACTIVE")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, holds)
+
+		assert.Equal(t, int64(800), balanceOf(t, db, "12345"))
+		assert.Equal(t, int64(800), availableOf(t, handler, "12345"))
+	})
+
+	t.Run("TransferValidatesAvailableBalance", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("holds_available_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		insertHold(t, db, "HLD1", "12345", 900)
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+
+		assert.Equal(t, int64(100), availableOf(t, handler, "12345"))
+
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD"}`)
+		assertError(t, w, http.StatusUnprocessableEntity, codeInsufficientFunds, "insufficient balance")
+		assert.Equal(t, int64(1000), balanceOf(t, db, "12345"))
+
+		w = postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":100,"currency":"USD"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int64(0), availableOf(t, handler, "12345"))
+	})
+
+	t.Run("SchedulerHoldsUpcomingRuns", func(t *testing.T) {
+		db, cleanup, err := setupTestDBScheduler("holds_scheduler_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		insertSchedule(t, db, "SCH1", "54321", 300, "ONCE", "2025-02-01T09:00:00Z", "")
+		insertSchedule(t, db, "SCH2", "54321", 100, "ONCE", "2025-02-05T09:00:00Z", "")
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.GET("/accounts/:accountNumber/holds", handler.GetHolds)
+
+		// the day before, only the run within the lead time is held
+		s := NewScheduler(handler, fixedClock("2025-01-31T12:00:00Z"), time.Minute)
+		_, err = s.RunDue()
+		assert.NoError(t, err)
+
+		_, holds := getHolds(t, r, "/accounts/12345/holds?status=ACTIVE")
+		if assert.Len(t, holds, 1) {
+			assert.Equal(t, "SCH1", holds[0].ScheduleID)
+			assert.Equal(t, money.New(300, "USD"), holds[0].Amount)
+		}
+		assert.Equal(t, int64(1000), balanceOf(t, db, "12345"))
+		assert.Equal(t, int64(700), availableOf(t, handler, "12345"))
+
+		// running again does not hold twice
+		_, err = s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(700), availableOf(t, handler, "12345"))
+
+		// when due, the schedule hold is released in favour of the transfer's own
+		s = NewScheduler(handler, fixedClock("2025-02-01T09:00:00Z"), time.Minute)
+		executed, err := s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, executed)
+
+		_, holds = getHolds(t, r, "/accounts/12345/holds")
+		statuses := map[string]string{}
+		for _, hold := range holds {
+			statuses[hold.ScheduleID+hold.TransactionID] = hold.Status
+		}
+		assert.Equal(t, HoldReleased, statuses["SCH1"])
+		assert.Len(t, statuses, 2)
+		assert.Equal(t, int64(700), balanceOf(t, db, "12345"))
+		assert.Equal(t, int64(700), availableOf(t, handler, "12345"))
+	})
+
+	t.Run("FailedScheduleReleasesItsHold", func(t *testing.T) {
+		db, cleanup, err := setupTestDBScheduler("holds_failed_schedule_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		insertSchedule(t, db, "SCH1", "99999", 300, "ONCE", "2025-02-01T09:00:00Z", "")
+		handler := &Handler{db: db}
+
+		s := NewScheduler(handler, fixedClock("2025-02-01T08:00:00Z"), time.Minute)
+		_, err = s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(700), availableOf(t, handler, "12345"))
+
+		s = NewScheduler(handler, fixedClock("2025-02-01T09:00:00Z"), time.Minute)
+		s.retries = 0
+		_, err = s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1000), availableOf(t, handler, "12345"))
+	})
+
+	t.Run("UnknownAccount", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("holds_unknown_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.GET("/accounts/:accountNumber/holds", handler.GetHolds)
+
+		code, _ := getHolds(t, r, "/accounts/99999/holds")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = getHolds(t, r, "/accounts/12345/holds?status=PENDING")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyHeader     = "Idempotency-Key"
+	idempotencyReplayed   = "Idempotent-Replayed"
+	maxIdempotencyKeySize = 255
+	defaultIdempotencyTTL = 24 * time.Hour
+)
+
+// responseRecorder keeps a copy of the response body so it can be stored for replay.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes a POST safe to retry. The first request with a given Idempotency-Key
+// runs the handler and stores its response; a retry with the same key and body gets the
+// stored response back, and a retry with a different body is rejected with 409.
+// Requests without the header are passed through untouched.
+func (h *Handler) Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeySize {
+			abortWithError(c, badRequest("idempotency key is too long"), "")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, badRequest("invalid request body"), "")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+		scope := c.Request.Method + " " + c.Request.URL.Path
+
+		owned, err := h.reserveIdempotencyKey(key, scope, hash)
+		if err != nil {
+			abortWithError(c, err, "unable to check idempotency key")
+			return
+		}
+		if !owned {
+			h.replayIdempotentResponse(c, key, scope, hash)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		answered := false
+		defer func() {
+			// the handler panicked before answering, its transaction is rolled back by now;
+			// release the key before the panic reaches the recovery middleware
+			if !answered {
+				h.releaseIdempotencyKey(key, scope)
+			}
+		}()
+		c.Next()
+		answered = true
+
+		status := rec.Status()
+		if status >= http.StatusInternalServerError {
+			// nothing was committed, let the client retry with the same key
+			h.releaseIdempotencyKey(key, scope)
+			return
+		}
+		_, err = h.db.Exec(`
+            UPDATE idempotency_keys
+            SET status_code = $1, response = $2
+            WHERE idempotency_key = $3 AND scope = $4`,
+			status, rec.body.String(), key, scope)
+		if err != nil {
+			log.Printf("Error: unable to store idempotent response: %v", err)
+		}
+	}
+}
+
+// releaseIdempotencyKey gives up the claim on key of a request that committed nothing, so a
+// retry with the same key runs again.
+func (h *Handler) releaseIdempotencyKey(key, scope string) {
+	_, err := h.db.Exec(`DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND scope = $2`, key, scope)
+	if err != nil {
+		log.Printf("Error: unable to release idempotency key: %v", err)
+	}
+}
+
+// reserveIdempotencyKey claims key for the current request. It reports false when the key
+// is already held by an earlier, unexpired request.
+func (h *Handler) reserveIdempotencyKey(key, scope, hash string) (bool, error) {
+	now := time.Now()
+	ttl := h.idempotencyTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+
+	_, err := h.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= $1`, formatTime(now))
+	if err != nil {
+		return false, err
+	}
+
+	res, err := h.db.Exec(`
+        INSERT INTO idempotency_keys (idempotency_key, scope, request_hash, created_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT DO NOTHING`,
+		key, scope, hash, formatTime(now), formatTime(now.Add(ttl)))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (h *Handler) replayIdempotentResponse(c *gin.Context, key, scope, hash string) {
+	var storedHash string
+	var status sql.NullInt64
+	var response sql.NullString
+	err := h.db.QueryRow(`
+        SELECT request_hash, status_code, response
+        FROM idempotency_keys
+        WHERE idempotency_key = $1 AND scope = $2`, key, scope).Scan(&storedHash, &status, &response)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the earlier request failed and released the key in the meantime
+		abortWithError(c, errIdempotencyInProgress, "")
+		return
+	}
+	if err != nil {
+		abortWithError(c, err, "unable to check idempotency key")
+		return
+	}
+
+	if storedHash != hash {
+		abortWithError(c, errIdempotencyKeyReused, "")
+		return
+	}
+	if !status.Valid {
+		abortWithError(c, errIdempotencyInProgress, "")
+		return
+	}
+
+	c.Header(idempotencyReplayed, "true")
+	c.Data(int(status.Int64), "application/json; charset=utf-8", []byte(response.String))
+	c.Abort()
+}
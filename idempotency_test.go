@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func postWithKey(r *gin.Engine, path, key, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotencyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency(t *testing.T) {
+	transferBody := `{
+		"fromAccount": "12345",
+		"toAccount": "54321",
+		"toBank": "KTB",
+		"amount": 200,
+		"currency": "USD",
+		"note": "Payment for services"
+	}`
+
+	t.Run("ReplaysTransferResponse", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("idempotency_replay_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.Idempotency(), handler.CreateTransfer)
+
+		first := postWithKey(r, "/accounts/12345/transfers", "key-1", transferBody)
+		assert.Equal(t, http.StatusOK, first.Code)
+
+		retry := postWithKey(r, "/accounts/12345/transfers", "key-1", transferBody)
+		assert.Equal(t, http.StatusOK, retry.Code)
+		assert.Equal(t, "true", retry.Header().Get(idempotencyReplayed))
+		assert.JSONEq(t, first.Body.String(), retry.Body.String())
+
+		// the sender is debited once
+		assert.Equal(t, int64(800), balanceOf(t, db, "12345"))
+		assert.Equal(t, int64(700), balanceOf(t, db, "54321"))
+	})
+
+	t.Run("RejectsKeyReusedWithDifferentBody", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("idempotency_conflict_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.Idempotency(), handler.CreateTransfer)
+
+		first := postWithKey(r, "/accounts/12345/transfers", "key-1", transferBody)
+		assert.Equal(t, http.StatusOK, first.Code)
+
+		other := strings.Replace(transferBody, `"amount": 200`, `"amount": 300`, 1)
+		w := postWithKey(r, "/accounts/12345/transfers", "key-1", other)
+		assertError(t, w, http.StatusConflict, codeIdempotencyKeyReused, "idempotency key was used with a different request")
+		assert.Equal(t, int64(800), balanceOf(t, db, "12345"))
+	})
+
+	t.Run("WithoutKeyEveryRequestRuns", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("idempotency_no_key_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.Idempotency(), handler.CreateTransfer)
+
+		assert.Equal(t, http.StatusOK, postWithKey(r, "/accounts/12345/transfers", "", transferBody).Code)
+		assert.Equal(t, http.StatusOK, postWithKey(r, "/accounts/12345/transfers", "", transferBody).Code)
+		assert.Equal(t, int64(600), balanceOf(t, db, "12345"))
+	})
+
+	t.Run("ExpiredKeyRunsAgain", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("idempotency_expired_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.Idempotency(), handler.CreateTransfer)
+
+		assert.Equal(t, http.StatusOK, postWithKey(r, "/accounts/12345/transfers", "key-1", transferBody).Code)
+
+		_, err = db.Exec(`UPDATE idempotency_keys SET expires_at = '2000-01-01T00:00:00Z'`)
+		assert.NoError(t, err)
+
+		w := postWithKey(r, "/accounts/12345/transfers", "key-1", transferBody)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(idempotencyReplayed))
+		assert.Equal(t, int64(600), balanceOf(t, db, "12345"))
+	})
+
+	t.Run("ReplaysScheduleResponse", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("idempotency_schedule_db")
+		assert.NoError(t, err)
+		defer cleanup()
+		withRemoteConfig(t, map[string]string{"enable_schedule_once": "true"})
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/schedules", handler.Idempotency(), handler.CreateSchedules)
+
+		body := `{
+			"fromAccount": "12345",
+			"toAccount": "54321",
+			"toBank": "KTB",
+			"amount": 200,
+			"currency": "USD",
+			"schedule": "ONCE",
+			"startDate": "2030-01-01 09:00:00"
+		}`
+		first := postWithKey(r, "/accounts/12345/schedules", "key-1", body)
+		assert.Equal(t, http.StatusOK, first.Code)
+
+		retry := postWithKey(r, "/accounts/12345/schedules", "key-1", body)
+		assert.Equal(t, http.StatusOK, retry.Code)
+		assert.JSONEq(t, first.Body.String(), retry.Body.String())
+
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM schedules").Scan(&count)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("PanicReleasesKey", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("idempotency_panic_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.New()
+		r.Use(RequestErrors(), gin.CustomRecovery(recoverWithError))
+		calls := 0
+		r.POST("/accounts/:accountNumber/transfers", handler.Idempotency(), func(c *gin.Context) {
+			calls++
+			if calls == 1 {
+				panic("boom")
+			}
+			handler.CreateTransfer(c)
+		})
+
+		w := postWithKey(r, "/accounts/12345/transfers", "key-1", transferBody)
+		assertError(t, w, http.StatusInternalServerError, codeInternal, "internal error")
+
+		// the retry runs rather than waiting out the key
+		w = postWithKey(r, "/accounts/12345/transfers", "key-1", transferBody)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, int64(800), balanceOf(t, db, "12345"))
+	})
+}
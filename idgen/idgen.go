@@ -0,0 +1,106 @@
+// Package idgen generates unique, time sortable identifiers such as TXN01JH3K5Q8W9ZV6R4N2M7T1XBCD.
+//
+// An identifier is a prefix followed by a ULID: 48 bits of millisecond timestamp and 80 bits
+// from crypto/rand, encoded as 26 Crockford base32 characters. Identifiers made within the
+// same millisecond by one Generator increase monotonically, so sorting them as strings
+// sorts them by creation time.
+package idgen
+
+import (
+	"crypto/rand"
+	"io"
+	"sync"
+	"time"
+)
+
+const encoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Generator makes identifiers. The zero value is not usable, use NewGenerator.
+type Generator struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entropy io.Reader
+	lastMs  uint64
+	last    [10]byte
+}
+
+// NewGenerator returns a generator reading time from now and randomness from entropy.
+// Nil arguments default to time.Now and crypto/rand.
+func NewGenerator(now func() time.Time, entropy io.Reader) *Generator {
+	if now == nil {
+		now = time.Now
+	}
+	if entropy == nil {
+		entropy = rand.Reader
+	}
+	return &Generator{now: now, entropy: entropy}
+}
+
+var defaultGenerator = NewGenerator(nil, nil)
+
+// New returns a new identifier starting with prefix from the default generator.
+func New(prefix string) string {
+	return defaultGenerator.New(prefix)
+}
+
+// New returns a new identifier starting with prefix.
+func (g *Generator) New(prefix string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.now().UnixMilli())
+	if ms <= g.lastMs {
+		// same millisecond, or the clock went back: stay sortable by incrementing
+		ms = g.lastMs
+		if !increment(&g.last) {
+			ms++
+			g.random()
+		}
+	} else {
+		g.random()
+	}
+	g.lastMs = ms
+
+	var id [16]byte
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(id[6:], g.last[:])
+	return prefix + encode(id)
+}
+
+func (g *Generator) random() {
+	if _, err := io.ReadFull(g.entropy, g.last[:]); err != nil {
+		panic("idgen: unable to read entropy: " + err.Error())
+	}
+}
+
+// increment adds one to b as a big endian number and reports false on overflow.
+func increment(b *[10]byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode writes the 128 bits of id as 26 base32 characters, most significant first.
+func encode(id [16]byte) string {
+	out := make([]byte, 26)
+	// 26 characters hold 130 bits, the two leading bits are always zero
+	var acc uint32
+	bits := 2
+	j := 0
+	for _, b := range id {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[j] = encoding[(acc>>bits)&31]
+			j++
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,62 @@
+package idgen
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	id := New("TXN")
+	assert.True(t, strings.HasPrefix(id, "TXN"))
+	assert.Len(t, id, 3+26)
+	assert.NotEqual(t, id, New("TXN"))
+}
+
+func TestGeneratorEncodesTimeFirst(t *testing.T) {
+	now := time.UnixMilli(1469918176385)
+	g := NewGenerator(func() time.Time { return now }, bytes.NewReader(make([]byte, 10)))
+
+	// same timestamp as the example in the ULID spec, all zero entropy
+	assert.Equal(t, "SCH01ARYZ6S410000000000000000", g.New("SCH"))
+}
+
+func TestGeneratorIsSortable(t *testing.T) {
+	now := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	g := NewGenerator(func() time.Time { return now }, nil)
+
+	var ids []string
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		if i%100 == 0 {
+			now = now.Add(time.Millisecond)
+		}
+		id := g.New("TXN")
+		assert.False(t, seen[id], id)
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	assert.True(t, sort.StringsAreSorted(ids))
+}
+
+func TestGeneratorClockGoingBack(t *testing.T) {
+	now := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	g := NewGenerator(func() time.Time { return now }, nil)
+
+	first := g.New("TXN")
+	now = now.Add(-time.Second)
+	assert.Greater(t, g.New("TXN"), first)
+}
+
+func TestGeneratorOverflowMovesToNextMillisecond(t *testing.T) {
+	now := time.UnixMilli(1469918176385)
+	max := bytes.Repeat([]byte{0xff}, 10)
+	g := NewGenerator(func() time.Time { return now }, bytes.NewReader(append(max, make([]byte, 10)...)))
+
+	assert.Equal(t, "01ARYZ6S41ZZZZZZZZZZZZZZZZ", g.New(""))
+	assert.Equal(t, "01ARYZ6S420000000000000000", g.New(""))
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"demo/ledger"
+)
+
+// LedgerReport is the result of checking the journal: entries that do not balance and
+// accounts whose balance is not the sum of their postings.
+type LedgerReport struct {
+	Entries    int                `json:"entries"`
+	Violations []ledger.Violation `json:"violations"`
+	Mismatches []ledger.Mismatch  `json:"mismatches"`
+}
+
+// OK reports whether the ledger passed every check.
+func (r LedgerReport) OK() bool {
+	return len(r.Violations) == 0 && len(r.Mismatches) == 0
+}
+
+// postEntry validates e and writes it with its postings inside tx, filling in its ID.
+// An unbalanced entry is never written.
+func (h *Handler) postEntry(tx *sql.Tx, e *ledger.Entry, stamp string) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxIDAttempts; attempt++ {
+		e.ID = h.nextID("JNL")
+		_, err = tx.Exec(`
+        INSERT INTO journal_entries (entry_id, transaction_id, description, posted_at)
+        VALUES ($1, NULLIF($2, ''), $3, $4)`,
+			e.ID, e.TransactionID, e.Description, stamp)
+		if !isUniqueViolation(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create journal entry: %w", err)
+	}
+
+	for _, p := range e.Postings {
+		_, err := tx.Exec(`
+        INSERT INTO postings (entry_id, account_number, amount, currency)
+        VALUES ($1, $2, $3, $4)`,
+			e.ID, p.Account, p.Amount, p.Currency)
+		if err != nil {
+			return fmt.Errorf("unable to create posting: %w", err)
+		}
+	}
+	return nil
+}
+
+// postTransfer records the journal entry of a completed transfer. A cross-currency transfer
+// goes through the FX position so that each currency balances on its own.
+func (h *Handler) postTransfer(tx *sql.Tx, t *Transfer, stamp string) error {
+	description := "Transfer"
+	if t.ReversalOf != "" {
+		description = "Reversal of " + t.ReversalOf
+	}
+	postings := ledger.Transfer(t.FromAccount, t.ToAccount, t.Amount.Minor, t.Amount.Currency)
+	if t.Converted != nil {
+		postings = ledger.Exchange(t.FromAccount, t.Amount.Minor, t.Amount.Currency, t.ToAccount, t.Converted.Minor, t.Converted.Currency)
+		description += " at " + t.ExchangeRate
+	}
+	return h.postEntry(tx, &ledger.Entry{
+		TransactionID: t.TransactionID,
+		Description:   description,
+		Postings:      postings,
+	}, stamp)
+}
+
+// postOpeningBalances gives every account that has no postings yet an opening entry for its
+// current balance, funded by the opening balances equity account. From then on the balance
+// of the account is the sum of its postings.
+func (h *Handler) postOpeningBalances(stamp string) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+        SELECT a.account_number, a.balance, a.currency
+        FROM accounts a
+        WHERE a.balance <> 0
+        AND NOT EXISTS (SELECT 1 FROM postings p WHERE p.account_number = a.account_number)
+        ORDER BY a.account_number`)
+	if err != nil {
+		return fmt.Errorf("unable to get accounts: %w", err)
+	}
+	var entries []ledger.Entry
+	for rows.Next() {
+		var account, currency string
+		var balance int64
+		if err := rows.Scan(&account, &balance, &currency); err != nil {
+			rows.Close()
+			return fmt.Errorf("unable to scan account: %w", err)
+		}
+		entries = append(entries, ledger.Entry{
+			Description: "Opening balance",
+			Postings:    ledger.Transfer(ledger.OpeningBalances, account, balance, currency),
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range entries {
+		if err := h.postEntry(tx, &entries[i], stamp); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// querier is the read side shared by *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// loadJournal reads every journal entry with its postings, oldest first.
+func loadJournal(q querier) ([]ledger.Entry, error) {
+	rows, err := q.Query(`
+        SELECT e.entry_id, COALESCE(e.transaction_id, ''), e.description, e.posted_at,
+            p.account_number, p.amount, p.currency
+        FROM journal_entries e
+        LEFT JOIN postings p ON p.entry_id = e.entry_id
+        ORDER BY e.posted_at, e.entry_id, p.id`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get journal: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []ledger.Entry
+	for rows.Next() {
+		var e ledger.Entry
+		var postedAt string
+		var account, currency sql.NullString
+		var amount sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.TransactionID, &e.Description, &postedAt, &account, &amount, &currency); err != nil {
+			return nil, fmt.Errorf("unable to scan journal entry: %w", err)
+		}
+		if n := len(entries); n == 0 || entries[n-1].ID != e.ID {
+			if e.PostedAt, err = parseTime(postedAt); err != nil {
+				return nil, fmt.Errorf("invalid posted_at: %w", err)
+			}
+			entries = append(entries, e)
+		}
+		if account.Valid {
+			last := &entries[len(entries)-1]
+			last.Postings = append(last.Postings, ledger.Posting{Account: account.String, Amount: amount.Int64, Currency: currency.String})
+		}
+	}
+	return entries, rows.Err()
+}
+
+// checkLedger proves the journal invariants and verifies every account balance against the
+// postings. Everything is read in one database transaction for a consistent view.
+func (h *Handler) checkLedger() (LedgerReport, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return LedgerReport{}, err
+	}
+	defer tx.Rollback()
+
+	entries, err := loadJournal(tx)
+	if err != nil {
+		return LedgerReport{}, err
+	}
+
+	rows, err := tx.Query(`SELECT account_number, currency, balance FROM accounts`)
+	if err != nil {
+		return LedgerReport{}, fmt.Errorf("unable to get accounts: %w", err)
+	}
+	defer rows.Close()
+	recorded := map[ledger.Key]int64{}
+	for rows.Next() {
+		var key ledger.Key
+		var balance int64
+		if err := rows.Scan(&key.Account, &key.Currency, &balance); err != nil {
+			return LedgerReport{}, fmt.Errorf("unable to scan account: %w", err)
+		}
+		recorded[key] = balance
+	}
+	if err := rows.Err(); err != nil {
+		return LedgerReport{}, err
+	}
+
+	return LedgerReport{
+		Entries:    len(entries),
+		Violations: ledger.Check(entries),
+		Mismatches: ledger.VerifyBalances(entries, recorded),
+	}, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"demo/ledger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestLedger(t *testing.T, dbName string) (*Handler, *gin.Engine, func()) {
+	db, cleanup, err := setupTestDBTransfers(dbName)
+	assert.NoError(t, err)
+
+	handler := &Handler{db: db}
+	assert.NoError(t, handler.postOpeningBalances("2025-01-01T00:00:00Z"))
+
+	r := gin.Default()
+	r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+	return handler, r, cleanup
+}
+
+func TestLedger(t *testing.T) {
+	t.Run("OpeningBalancesArePostedOnce", func(t *testing.T) {
+		handler, _, cleanup := setupTestLedger(t, "ledger_opening_db")
+		defer cleanup()
+
+		assert.NoError(t, handler.postOpeningBalances("2025-01-02T00:00:00Z"))
+
+		report, err := handler.checkLedger()
+		assert.NoError(t, err)
+		assert.True(t, report.OK(), "%+v", report)
+		assert.Equal(t, 2, report.Entries)
+	})
+
+	t.Run("TransferPostsABalancedEntry", func(t *testing.T) {
+		handler, r, cleanup := setupTestLedger(t, "ledger_transfer_db")
+		defer cleanup()
+
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp := TransferResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		entries, err := loadJournal(handler.db)
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 3) {
+			entry := entries[2]
+			assert.Equal(t, resp.TransactionID, entry.TransactionID)
+			assert.Equal(t, []ledger.Posting{
+				{Account: "12345", Amount: -200, Currency: "USD"},
+				{Account: "54321", Amount: 200, Currency: "USD"},
+			}, entry.Postings)
+		}
+
+		report, err := handler.checkLedger()
+		assert.NoError(t, err)
+		assert.True(t, report.OK(), "%+v", report)
+	})
+
+	t.Run("FailedTransferPostsNothing", func(t *testing.T) {
+		handler, r, cleanup := setupTestLedger(t, "ledger_failed_db")
+		defer cleanup()
+
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":5000,"currency":"USD"}`)
+		assert.NotEqual(t, http.StatusOK, w.Code)
+
+		report, err := handler.checkLedger()
+		assert.NoError(t, err)
+		assert.True(t, report.OK(), "%+v", report)
+		assert.Equal(t, 2, report.Entries)
+	})
+
+	t.Run("DetectsTamperedBalance", func(t *testing.T) {
+		handler, _, cleanup := setupTestLedger(t, "ledger_tampered_db")
+		defer cleanup()
+
+		_, err := handler.db.Exec(`UPDATE accounts SET balance = balance + 1 WHERE account_number = '54321'`)
+		assert.NoError(t, err)
+
+		report, err := handler.checkLedger()
+		assert.NoError(t, err)
+		assert.Empty(t, report.Violations)
+		assert.Equal(t, []ledger.Mismatch{{Account: "54321", Currency: "USD", Recorded: 501, Derived: 500}}, report.Mismatches)
+	})
+
+	t.Run("DetectsUnbalancedEntry", func(t *testing.T) {
+		handler, _, cleanup := setupTestLedger(t, "ledger_unbalanced_db")
+		defer cleanup()
+
+		_, err := handler.db.Exec(`
+			INSERT INTO journal_entries (entry_id, description, posted_at) VALUES ('JNLBAD', 'Broken', '2025-01-03T00:00:00Z');
+			INSERT INTO postings (entry_id, account_number, amount, currency) VALUES ('JNLBAD', '12345', -10, 'USD'), ('JNLBAD', '54321', 9, 'USD');`)
+		assert.NoError(t, err)
+
+		report, err := handler.checkLedger()
+		assert.NoError(t, err)
+		assert.Equal(t, []ledger.Violation{{EntryID: "JNLBAD", Currency: "USD", Sum: -1, Reason: ledger.ErrUnbalanced.Error()}}, report.Violations)
+		assert.Len(t, report.Mismatches, 2)
+	})
+
+	t.Run("RejectsUnbalancedEntry", func(t *testing.T) {
+		handler, _, cleanup := setupTestLedger(t, "ledger_reject_db")
+		defer cleanup()
+
+		tx, err := handler.db.Begin()
+		assert.NoError(t, err)
+		defer tx.Rollback()
+
+		err = handler.postEntry(tx, &ledger.Entry{Postings: []ledger.Posting{
+			{Account: "12345", Amount: -10, Currency: "USD"},
+			{Account: "54321", Amount: 10, Currency: "THB"},
+		}}, "2025-01-03T00:00:00Z")
+		assert.ErrorIs(t, err, ledger.ErrUnbalanced)
+	})
+}
@@ -0,0 +1,182 @@
+// Package ledger models money movements as double-entry journal entries.
+//
+// Every entry is a set of postings to accounts whose amounts add up to zero in each
+// currency: whatever leaves one account arrives in another. Account balances are the sum of
+// their postings, which makes them derivable and verifiable from the journal alone.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// OpeningBalances is the equity account that funds the balance an account had before its
+// first posting.
+const OpeningBalances = "equity:opening-balances"
+
+// FXPosition is the account that takes the other side of currency exchanges, its balance
+// in each currency is the bank's open position in it.
+const FXPosition = "fx:position"
+
+var (
+	ErrTooFewPostings = errors.New("journal entry needs at least two postings")
+	ErrZeroPosting    = errors.New("posting amount must not be zero")
+	ErrNoCurrency     = errors.New("posting has no currency")
+	ErrNoAccount      = errors.New("posting has no account")
+	ErrUnbalanced     = errors.New("journal entry does not balance")
+)
+
+// Posting moves Amount, in minor units of Currency, into Account; a negative amount moves
+// money out of it.
+type Posting struct {
+	Account  string `json:"account"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Entry is a journal entry, a balanced set of postings made at the same time.
+type Entry struct {
+	ID            string    `json:"id"`
+	TransactionID string    `json:"transactionId,omitempty"`
+	Description   string    `json:"description"`
+	PostedAt      time.Time `json:"postedAt"`
+	Postings      []Posting `json:"postings"`
+}
+
+// Transfer returns the postings that move amount of currency from one account to another.
+func Transfer(from, to string, amount int64, currency string) []Posting {
+	return []Posting{
+		{Account: from, Amount: -amount, Currency: currency},
+		{Account: to, Amount: amount, Currency: currency},
+	}
+}
+
+// Exchange returns the postings that move amount of currency out of one account and the
+// converted amount of toCurrency into another. Each currency balances through FXPosition.
+func Exchange(from string, amount int64, currency string, to string, converted int64, toCurrency string) []Posting {
+	return []Posting{
+		{Account: from, Amount: -amount, Currency: currency},
+		{Account: FXPosition, Amount: amount, Currency: currency},
+		{Account: FXPosition, Amount: -converted, Currency: toCurrency},
+		{Account: to, Amount: converted, Currency: toCurrency},
+	}
+}
+
+// Sums returns the sum of the postings of e per currency.
+func (e Entry) Sums() map[string]int64 {
+	sums := map[string]int64{}
+	for _, p := range e.Postings {
+		sums[p.Currency] += p.Amount
+	}
+	return sums
+}
+
+// Validate checks that e is a well formed, balanced entry.
+func (e Entry) Validate() error {
+	if len(e.Postings) < 2 {
+		return ErrTooFewPostings
+	}
+	for _, p := range e.Postings {
+		switch {
+		case p.Account == "":
+			return ErrNoAccount
+		case p.Currency == "":
+			return ErrNoCurrency
+		case p.Amount == 0:
+			return ErrZeroPosting
+		}
+	}
+	sums := e.Sums()
+	for _, ccy := range sortedKeys(sums) {
+		if sum := sums[ccy]; sum != 0 {
+			return fmt.Errorf("%w: %s postings sum to %d", ErrUnbalanced, ccy, sum)
+		}
+	}
+	return nil
+}
+
+// Violation is a journal entry that breaks the ledger invariants.
+type Violation struct {
+	EntryID  string `json:"entryId"`
+	Currency string `json:"currency,omitempty"`
+	Sum      int64  `json:"sum,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// Check proves the ledger invariants over entries: every entry is well formed and its
+// postings sum to zero in every currency. It returns every violation, not just the first.
+func Check(entries []Entry) []Violation {
+	var violations []Violation
+	for _, e := range entries {
+		sums := e.Sums()
+		unbalanced := false
+		for _, ccy := range sortedKeys(sums) {
+			if sums[ccy] != 0 {
+				unbalanced = true
+				violations = append(violations, Violation{EntryID: e.ID, Currency: ccy, Sum: sums[ccy], Reason: ErrUnbalanced.Error()})
+			}
+		}
+		if unbalanced {
+			continue
+		}
+		if err := e.Validate(); err != nil {
+			violations = append(violations, Violation{EntryID: e.ID, Reason: err.Error()})
+		}
+	}
+	return violations
+}
+
+// Key identifies the balance of an account in one currency.
+type Key struct {
+	Account  string
+	Currency string
+}
+
+// Balances derives the balance of every account and currency from the postings of entries.
+func Balances(entries []Entry) map[Key]int64 {
+	balances := map[Key]int64{}
+	for _, e := range entries {
+		for _, p := range e.Postings {
+			balances[Key{p.Account, p.Currency}] += p.Amount
+		}
+	}
+	return balances
+}
+
+// Mismatch is an account whose recorded balance differs from the one derived from postings.
+type Mismatch struct {
+	Account  string `json:"account"`
+	Currency string `json:"currency"`
+	Recorded int64  `json:"recorded"`
+	Derived  int64  `json:"derived"`
+}
+
+// VerifyBalances compares the recorded balances with the ones derived from entries. Only
+// recorded accounts are compared, so system accounts such as OpeningBalances need no record.
+func VerifyBalances(entries []Entry, recorded map[Key]int64) []Mismatch {
+	derived := Balances(entries)
+	var mismatches []Mismatch
+	for key, balance := range recorded {
+		if derived[key] != balance {
+			mismatches = append(mismatches, Mismatch{Account: key.Account, Currency: key.Currency, Recorded: balance, Derived: derived[key]})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Account != mismatches[j].Account {
+			return mismatches[i].Account < mismatches[j].Account
+		}
+		return mismatches[i].Currency < mismatches[j].Currency
+	})
+	return mismatches
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []Posting
+		err      error
+	}{
+		{"Transfer", Transfer("A", "B", 100, "THB"), nil},
+		{"MultiCurrency", append(Transfer("A", "FX", 100, "USD"), Transfer("FX", "B", 3500, "THB")...), nil},
+		{"Exchange", Exchange("A", 100, "USD", "B", 3513, "THB"), nil},
+		{"SinglePosting", []Posting{{"A", 100, "THB"}}, ErrTooFewPostings},
+		{"Unbalanced", []Posting{{"A", -100, "THB"}, {"B", 99, "THB"}}, ErrUnbalanced},
+		{"BalancedAcrossCurrenciesOnly", []Posting{{"A", -100, "THB"}, {"B", 100, "USD"}}, ErrUnbalanced},
+		{"ZeroPosting", []Posting{{"A", 0, "THB"}, {"B", 0, "THB"}}, ErrZeroPosting},
+		{"NoCurrency", []Posting{{"A", -100, ""}, {"B", 100, ""}}, ErrNoCurrency},
+		{"NoAccount", []Posting{{"", -100, "THB"}, {"B", 100, "THB"}}, ErrNoAccount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Entry{ID: "JNL1", Postings: tt.postings}.Validate()
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	entries := []Entry{
+		{ID: "JNL1", Postings: Transfer(OpeningBalances, "A", 1000, "THB")},
+		{ID: "JNL2", Postings: []Posting{{"A", -100, "THB"}, {"B", 100, "THB"}, {"A", -5, "USD"}, {"B", 4, "USD"}}},
+		{ID: "JNL3", Postings: []Posting{{"A", -100, "THB"}}},
+		{ID: "JNL4", Postings: Transfer("A", "B", 50, "THB")},
+	}
+
+	assert.Equal(t, []Violation{
+		{EntryID: "JNL2", Currency: "USD", Sum: -1, Reason: "journal entry does not balance"},
+		{EntryID: "JNL3", Currency: "THB", Sum: -100, Reason: "journal entry does not balance"},
+	}, Check(entries))
+	assert.Empty(t, Check(entries[:1]))
+}
+
+func TestBalances(t *testing.T) {
+	entries := []Entry{
+		{ID: "JNL1", Postings: Transfer(OpeningBalances, "A", 1000, "THB")},
+		{ID: "JNL2", Postings: Transfer("A", "B", 300, "THB")},
+		{ID: "JNL3", Postings: Transfer("B", "A", 20, "USD")},
+	}
+
+	assert.Equal(t, map[Key]int64{
+		{OpeningBalances, "THB"}: -1000,
+		{"A", "THB"}:             700,
+		{"B", "THB"}:             300,
+		{"A", "USD"}:             20,
+		{"B", "USD"}:             -20,
+	}, Balances(entries))
+
+	// the opening balances account is not recorded and so not compared
+	recorded := map[Key]int64{
+		{"A", "THB"}: 700,
+		{"B", "THB"}: 350,
+		{"C", "THB"}: 10,
+	}
+	assert.Equal(t, []Mismatch{
+		{Account: "B", Currency: "THB", Recorded: 350, Derived: 300},
+		{Account: "C", Currency: "THB", Recorded: 10, Derived: 0},
+	}, VerifyBalances(entries, recorded))
+}
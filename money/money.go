@@ -0,0 +1,245 @@
+// Package money pairs an amount with its currency.
+//
+// Amounts are integers in the minor units of their currency as defined by ISO 4217, so
+// 1 USD is 100 and 1 JPY is 1. On the wire a Money carries both that integer and the same
+// amount as a decimal string, so nobody has to guess whether 101282250 is satang or baht:
+//
+//	{"minorUnits": 101282250, "value": "1012822.50", "currency": "THB"}
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrTooPrecise       = errors.New("amount has more decimals than its currency")
+	ErrAmountMismatch   = errors.New("minorUnits and value disagree")
+	ErrCurrencyMismatch = errors.New("currency disagrees with the request")
+	ErrNoCurrency       = errors.New("amount has no currency")
+)
+
+// Money is Minor minor units of Currency.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// New returns minor minor units of currency.
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// Parse parses value, a decimal such as "1012822.50", as an amount of currency. It is
+// strict: an optional minus sign, digits and at most as many decimals as the currency has.
+func Parse(value, currency string) (Money, error) {
+	digits, ok := MinorUnits(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+
+	s := strings.TrimPrefix(value, "-")
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if !isDigits(whole) || (hasPoint && !isDigits(frac)) {
+		return Money{}, fmt.Errorf("%w: %q is not a decimal", ErrInvalidAmount, value)
+	}
+	if len(frac) > digits {
+		return Money{}, fmt.Errorf("%w: %q has more than %d decimals for %s", ErrTooPrecise, value, digits, currency)
+	}
+
+	minor, err := strconv.ParseInt(s[:len(whole)]+frac+strings.Repeat("0", digits-len(frac)), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, value)
+	}
+	if strings.HasPrefix(value, "-") {
+		minor = -minor
+	}
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders m as a decimal with the minor units of its currency: 123456 THB is "1234.56".
+func (m Money) String() string {
+	digits, ok := MinorUnits(m.Currency)
+	if !ok {
+		digits = 2
+	}
+	sign := ""
+	// negate as uint64 so the smallest int64 does not overflow
+	abs := uint64(m.Minor)
+	if m.Minor < 0 {
+		sign = "-"
+		abs = -abs
+	}
+	s := strconv.FormatUint(abs, 10)
+	if digits == 0 {
+		return sign + s
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// IsZero reports whether m is zero.
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// Neg returns -m.
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+type wire struct {
+	MinorUnits json.Number `json:"minorUnits"`
+	Value      string      `json:"value"`
+	Currency   string      `json:"currency"`
+}
+
+// MarshalJSON writes m with both its minor units and its decimal value.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(wire{MinorUnits: json.Number(strconv.FormatInt(m.Minor, 10)), Value: m.String(), Currency: m.Currency})
+}
+
+// UnmarshalJSON reads m from the object MarshalJSON writes. Either minorUnits or value may
+// be left out; when both are there they must agree.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var in Input
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	if in.err != nil {
+		return in.err
+	}
+	if !in.object {
+		return fmt.Errorf("%w: money must be an object", ErrInvalidAmount)
+	}
+	resolved, err := in.Resolve("")
+	if err != nil {
+		return err
+	}
+	*m = resolved
+	return nil
+}
+
+// Input is an amount as a client sent it: minor units as a JSON integer, a decimal string,
+// or a Money object. Its currency may come from elsewhere in the request, so it is resolved
+// to Money once that is known.
+type Input struct {
+	minor    string
+	value    string
+	currency string
+	object   bool
+	set      bool
+	// err is why the amount could not be read, reported by Resolve
+	err error
+}
+
+// Minor returns an Input of minor units, as a client sending a JSON integer would.
+func Minor(minor int64) Input {
+	return Input{minor: strconv.FormatInt(minor, 10), set: true}
+}
+
+// IsSet reports whether the request had an amount at all.
+func (in Input) IsSet() bool {
+	return in.set
+}
+
+// UnmarshalJSON accepts a JSON integer, a decimal string or an object with minorUnits,
+// value and currency. Anything else, such as 1.5, 1e3 or unknown fields, is rejected by
+// Resolve rather than here, so the rest of the request still decodes and the amount can be
+// reported as the field at fault.
+func (in *Input) UnmarshalJSON(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	switch {
+	case s == "null":
+		*in = Input{}
+	case strings.HasPrefix(s, `"`):
+		var value string
+		if err := json.Unmarshal(b, &value); err != nil {
+			return err
+		}
+		*in = Input{value: value, set: true}
+	case strings.HasPrefix(s, "{"):
+		var w wire
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		dec.DisallowUnknownFields()
+		switch err := dec.Decode(&w); {
+		case err != nil:
+			*in = Input{err: fmt.Errorf("%w: %v", ErrInvalidAmount, err), set: true}
+		case w.MinorUnits == "" && w.Value == "":
+			*in = Input{err: fmt.Errorf("%w: minorUnits or value is required", ErrInvalidAmount), set: true}
+		case w.MinorUnits != "" && !isInteger(string(w.MinorUnits)):
+			*in = Input{err: fmt.Errorf("%w: minorUnits %s is not an integer", ErrInvalidAmount, w.MinorUnits), set: true}
+		default:
+			*in = Input{minor: string(w.MinorUnits), value: w.Value, currency: w.Currency, object: true, set: true}
+		}
+	case isInteger(s):
+		*in = Input{minor: s, set: true}
+	default:
+		*in = Input{err: fmt.Errorf("%w: %s is not an integer number of minor units", ErrInvalidAmount, s), set: true}
+	}
+	return nil
+}
+
+func isInteger(s string) bool {
+	return isDigits(strings.TrimPrefix(s, "-"))
+}
+
+// Resolve turns in into Money of currency, the currency given next to the amount. A Money
+// object may carry its own currency, which must then agree with currency.
+func (in Input) Resolve(currency string) (Money, error) {
+	if in.err != nil {
+		return Money{}, in.err
+	}
+	switch {
+	case in.currency == "":
+	case currency == "":
+		currency = in.currency
+	case currency != in.currency:
+		return Money{}, fmt.Errorf("%w: %s is not %s", ErrCurrencyMismatch, in.currency, currency)
+	}
+	if currency == "" {
+		return Money{}, ErrNoCurrency
+	}
+	if !Valid(currency) {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+
+	var m Money
+	if in.value != "" {
+		var err error
+		if m, err = Parse(in.value, currency); err != nil {
+			return Money{}, err
+		}
+	}
+	if in.minor != "" {
+		minor, err := strconv.ParseInt(in.minor, 10, 64)
+		if err != nil {
+			return Money{}, fmt.Errorf("%w: %s is out of range", ErrInvalidAmount, in.minor)
+		}
+		if in.value != "" && minor != m.Minor {
+			return Money{}, fmt.Errorf("%w: %s is not %s %s", ErrAmountMismatch, in.minor, in.value, currency)
+		}
+		m = Money{Minor: minor, Currency: currency}
+	}
+	return m, nil
+}
@@ -0,0 +1,132 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value, currency string
+		want            int64
+		err             error
+	}{
+		{"1012822.50", "THB", 101282250, nil},
+		{"1012822.5", "THB", 101282250, nil},
+		{"1012822", "THB", 101282200, nil},
+		{"-0.01", "USD", -1, nil},
+		{"150", "JPY", 150, nil},
+		{"1.234", "KWD", 1234, nil},
+		{"1.5", "JPY", 0, ErrTooPrecise},
+		{"1.001", "USD", 0, ErrTooPrecise},
+		{"1e3", "USD", 0, ErrInvalidAmount},
+		{"+1", "USD", 0, ErrInvalidAmount},
+		{" 1", "USD", 0, ErrInvalidAmount},
+		{"1.", "USD", 0, ErrInvalidAmount},
+		{".5", "USD", 0, ErrInvalidAmount},
+		{"1,000.00", "USD", 0, ErrInvalidAmount},
+		{"", "USD", 0, ErrInvalidAmount},
+		{"99999999999999999999", "USD", 0, ErrInvalidAmount},
+		{"1.00", "ABC", 0, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+" "+tt.currency, func(t *testing.T) {
+			m, err := Parse(tt.value, tt.currency)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, New(tt.want, tt.currency), m)
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid("THB"))
+	assert.True(t, Valid("JPY"))
+	assert.False(t, Valid("thb"))
+	assert.False(t, Valid("XAU"))
+	assert.False(t, Valid("ABC"))
+	assert.False(t, Valid(""))
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "1012822.50", New(101282250, "THB").String())
+	assert.Equal(t, "-0.05", New(-5, "USD").String())
+	assert.Equal(t, "0.00", New(0, "USD").String())
+	assert.Equal(t, "150", New(150, "JPY").String())
+	assert.Equal(t, "1.234", New(1234, "KWD").String())
+	assert.Equal(t, "-92233720368547758.08", New(math.MinInt64, "USD").String())
+}
+
+func TestMarshalJSON(t *testing.T) {
+	b, err := json.Marshal(New(101282250, "THB"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"minorUnits":101282250,"value":"1012822.50","currency":"THB"}`, string(b))
+
+	var m Money
+	assert.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, New(101282250, "THB"), m)
+
+	assert.Error(t, json.Unmarshal([]byte(`101282250`), &m))
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"value":"1.00"}`), &m), ErrNoCurrency)
+}
+
+func TestInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		currency string
+		want     Money
+		err      error
+	}{
+		{"MinorUnits", `200`, "USD", New(200, "USD"), nil},
+		{"Negative", `-200`, "USD", New(-200, "USD"), nil},
+		{"Decimal", `"2.00"`, "USD", New(200, "USD"), nil},
+		{"Object", `{"minorUnits":200,"currency":"USD"}`, "", New(200, "USD"), nil},
+		{"ObjectValue", `{"value":"2.00"}`, "USD", New(200, "USD"), nil},
+		{"ObjectBoth", `{"minorUnits":200,"value":"2.00","currency":"USD"}`, "USD", New(200, "USD"), nil},
+		{"FractionalMinorUnits", `1.5`, "USD", Money{}, ErrInvalidAmount},
+		{"ExponentMinorUnits", `1e3`, "USD", Money{}, ErrInvalidAmount},
+		{"FractionalObjectMinorUnits", `{"minorUnits":1.5,"currency":"USD"}`, "", Money{}, ErrInvalidAmount},
+		{"UnknownField", `{"amount":200,"currency":"USD"}`, "", Money{}, ErrInvalidAmount},
+		{"EmptyObject", `{"currency":"USD"}`, "", Money{}, ErrInvalidAmount},
+		{"Disagree", `{"minorUnits":200,"value":"2.01"}`, "USD", Money{}, ErrAmountMismatch},
+		{"OtherCurrency", `{"minorUnits":200,"currency":"THB"}`, "USD", Money{}, ErrCurrencyMismatch},
+		{"NoCurrency", `200`, "", Money{}, ErrNoCurrency},
+		{"UnknownCurrency", `200`, "usd", Money{}, ErrUnknownCurrency},
+		{"TooPrecise", `"2.001"`, "USD", Money{}, ErrTooPrecise},
+		{"OutOfRange", `99999999999999999999`, "USD", Money{}, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in Input
+			err := json.Unmarshal([]byte(tt.json), &in)
+			if err == nil {
+				assert.True(t, in.IsSet())
+				var m Money
+				m, err = in.Resolve(tt.currency)
+				if err == nil {
+					assert.Equal(t, tt.want, m)
+				}
+			}
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	var req struct {
+		Amount Input `json:"amount"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{}`), &req))
+	assert.False(t, req.Amount.IsSet())
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount":null}`), &req))
+	assert.False(t, req.Amount.IsSet())
+}
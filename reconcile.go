@@ -0,0 +1,385 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fix-up actions proposed by a reconciliation plan.
+const (
+	FixRelinkLeg         = "RELINK_LEG"
+	FixDeleteLeg         = "DELETE_LEG"
+	FixAddLeg            = "ADD_LEG"
+	FixSetBalance        = "SET_BALANCE"
+	FixSetOpeningBalance = "SET_OPENING_BALANCE"
+	FixReview            = "REVIEW"
+)
+
+// BalanceMismatch is an account whose recorded balance is not its opening balance plus the
+// legs booked since.
+type BalanceMismatch struct {
+	AccountNumber     string `json:"accountNumber"`
+	Currency          string `json:"currency"`
+	HasOpeningBalance bool   `json:"hasOpeningBalance"`
+	OpeningBalance    int64  `json:"openingBalance"`
+	TransactionTotal  int64  `json:"transactionTotal"`
+	ExpectedBalance   int64  `json:"expectedBalance"`
+	RecordedBalance   int64  `json:"recordedBalance"`
+	Held              int64  `json:"held"`
+	ExpectedAvailable int64  `json:"expectedAvailableBalance"`
+	RecordedAvailable int64  `json:"recordedAvailableBalance"`
+	Difference        int64  `json:"difference"`
+}
+
+// Leg is one row of the transactions table.
+type Leg struct {
+	ID            int64  `json:"id"`
+	TransactionID string `json:"transactionId"`
+	AccountNumber string `json:"accountNumber"`
+	FromAccount   string `json:"fromAccount"`
+	ToAccount     string `json:"toAccount"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	TransferredAt string `json:"transferredAt"`
+}
+
+// counterparty is the account on the other side of l.
+func (l Leg) counterparty() string {
+	if l.AccountNumber == l.FromAccount {
+		return l.ToAccount
+	}
+	return l.FromAccount
+}
+
+// DuplicateLegs is a transaction ID with more legs than its transfer needs. Kept are the
+// two legs of the transfer, Extra the ones that belong to some other movement.
+type DuplicateLegs struct {
+	TransactionID string `json:"transactionId"`
+	Kept          []Leg  `json:"kept"`
+	Extra         []Leg  `json:"extra"`
+}
+
+// FixUp is one step of a reconciliation plan. Only the fields of its action are set.
+type FixUp struct {
+	Action        string `json:"action"`
+	TransactionID string `json:"transactionId,omitempty"`
+	LegID         int64  `json:"legId,omitempty"`
+	AccountNumber string `json:"accountNumber,omitempty"`
+	Amount        int64  `json:"amount,omitempty"`
+	Balance       *int64 `json:"balance,omitempty"`
+	Reason        string `json:"reason"`
+}
+
+// ReconciliationReport compares every account balance with the transaction history and
+// lists the legs that do not pair up.
+type ReconciliationReport struct {
+	GeneratedAt  time.Time         `json:"generatedAt"`
+	Accounts     int               `json:"accounts"`
+	OK           bool              `json:"ok"`
+	Mismatches   []BalanceMismatch `json:"mismatches"`
+	OrphanedLegs []Leg             `json:"orphanedLegs"`
+	Duplicates   []DuplicateLegs   `json:"duplicateLegs"`
+	Plan         []FixUp           `json:"plan,omitempty"`
+}
+
+// reconcile recomputes the balance of every account from its opening balance and the legs
+// booked since, and finds legs without a counter leg or with more legs than the transfer
+// needs. With plan set it also proposes the fix-ups that would bring the books back in line.
+// Everything is read in one database transaction for a consistent view.
+func (h *Handler) reconcile(plan bool, now time.Time) (*ReconciliationReport, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	accounts, err := reconcileAccounts(tx)
+	if err != nil {
+		return nil, err
+	}
+	legs, err := unpairedLegs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconciliationReport{
+		GeneratedAt:  now.UTC(),
+		Accounts:     len(accounts),
+		Mismatches:   []BalanceMismatch{},
+		OrphanedLegs: []Leg{},
+		Duplicates:   []DuplicateLegs{},
+	}
+	for _, a := range accounts {
+		if a.Difference != 0 {
+			report.Mismatches = append(report.Mismatches, a)
+		}
+	}
+	report.OrphanedLegs, report.Duplicates = classifyLegs(legs)
+	report.OK = len(report.Mismatches) == 0 && len(report.OrphanedLegs) == 0 && len(report.Duplicates) == 0
+
+	if plan {
+		report.Plan = fixUpPlan(accounts, report.OrphanedLegs, report.Duplicates)
+	}
+	return report, nil
+}
+
+// reconcileAccounts returns the expected and recorded balances of every account, in account
+// number order. An account without an opening balance starts from zero with its first leg.
+func reconcileAccounts(q querier) ([]BalanceMismatch, error) {
+	rows, err := q.Query(`
+        SELECT a.account_number, a.currency, a.balance, ` + availableBalanceSQL + `,
+            o.amount IS NOT NULL, COALESCE(o.amount, 0),
+            COALESCE((
+                SELECT SUM(t.amount) FROM transactions t
+                WHERE t.account_number = a.account_number
+                AND t.transferred_at >= COALESCE(o.as_of, '')), 0)
+        FROM accounts a
+        LEFT JOIN opening_balances o ON o.account_number = a.account_number
+        ORDER BY a.account_number`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []BalanceMismatch
+	for rows.Next() {
+		var m BalanceMismatch
+		if err := rows.Scan(&m.AccountNumber, &m.Currency, &m.RecordedBalance, &m.RecordedAvailable,
+			&m.HasOpeningBalance, &m.OpeningBalance, &m.TransactionTotal); err != nil {
+			return nil, fmt.Errorf("unable to scan account: %w", err)
+		}
+		m.ExpectedBalance = m.OpeningBalance + m.TransactionTotal
+		m.Held = m.RecordedBalance - m.RecordedAvailable
+		m.ExpectedAvailable = m.ExpectedBalance - m.Held
+		m.Difference = m.RecordedBalance - m.ExpectedBalance
+		accounts = append(accounts, m)
+	}
+	return accounts, rows.Err()
+}
+
+// unpairedLegs returns, grouped by transaction ID, the legs of every transaction that is not
+// exactly one leg on the sender and one on the recipient of the same transfer.
+func unpairedLegs(q querier) ([]Leg, error) {
+	rows, err := q.Query(`
+        SELECT t.id, t.transaction_id, t.account_number, t.from_account, t.to_account,
+            t.amount, t.currency, t.transferred_at
+        FROM transactions t
+        WHERE t.transaction_id IN (
+            SELECT transaction_id FROM transactions
+            GROUP BY transaction_id
+            HAVING COUNT(*) <> 2 OR COUNT(DISTINCT from_account || '>' || to_account) <> 1)
+        ORDER BY t.transaction_id, t.id`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var legs []Leg
+	for rows.Next() {
+		var l Leg
+		if err := rows.Scan(&l.ID, &l.TransactionID, &l.AccountNumber, &l.FromAccount, &l.ToAccount,
+			&l.Amount, &l.Currency, &l.TransferredAt); err != nil {
+			return nil, fmt.Errorf("unable to scan transaction: %w", err)
+		}
+		legs = append(legs, l)
+	}
+	return legs, rows.Err()
+}
+
+// classifyLegs sorts unpaired legs, grouped by transaction ID, into orphans and duplicates.
+// The transfer of a transaction ID is its first pair of legs on the sender and the recipient;
+// any other leg under that ID is a duplicate. Without such a pair every leg is an orphan.
+func classifyLegs(legs []Leg) ([]Leg, []DuplicateLegs) {
+	orphans := []Leg{}
+	duplicates := []DuplicateLegs{}
+	for start := 0; start < len(legs); {
+		end := start
+		for end < len(legs) && legs[end].TransactionID == legs[start].TransactionID {
+			end++
+		}
+		group := legs[start:end]
+		start = end
+
+		kept := pairOf(group)
+		if kept == nil {
+			orphans = append(orphans, group...)
+			continue
+		}
+		d := DuplicateLegs{TransactionID: group[0].TransactionID, Kept: kept}
+		for _, l := range group {
+			if l.ID != kept[0].ID && l.ID != kept[1].ID {
+				d.Extra = append(d.Extra, l)
+			}
+		}
+		duplicates = append(duplicates, d)
+	}
+	return orphans, duplicates
+}
+
+// pairOf returns the first sender and recipient legs of the same transfer in group.
+func pairOf(group []Leg) []Leg {
+	for _, out := range group {
+		if out.AccountNumber != out.FromAccount {
+			continue
+		}
+		for _, in := range group {
+			if in.AccountNumber == in.ToAccount && in.FromAccount == out.FromAccount && in.ToAccount == out.ToAccount {
+				return []Leg{out, in}
+			}
+		}
+	}
+	return nil
+}
+
+// fixUpPlan proposes how to repair the books. A duplicate leg that is the missing counter
+// leg of an orphan is moved to the orphan's transaction ID; other duplicates are deleted and
+// other orphans get their counter leg when the counterparty is one of our accounts. Balances
+// are then compared with the history as it would be after those fixes: an account without an
+// opening balance gets the one that explains its balance, any other account is corrected.
+func fixUpPlan(accounts []BalanceMismatch, orphans []Leg, duplicates []DuplicateLegs) []FixUp {
+	plan := []FixUp{}
+	delta := map[string]int64{}
+	known := map[string]bool{}
+	for _, a := range accounts {
+		known[a.AccountNumber] = true
+	}
+
+	matched := map[int64]bool{}
+	var extras []Leg
+	for _, d := range duplicates {
+		extras = append(extras, d.Extra...)
+	}
+	for _, o := range orphans {
+		relinked := false
+		for _, e := range extras {
+			if matched[e.ID] || e.FromAccount != o.FromAccount || e.ToAccount != o.ToAccount ||
+				e.AccountNumber == o.AccountNumber || e.Amount != -o.Amount || e.Currency != o.Currency {
+				continue
+			}
+			matched[e.ID] = true
+			relinked = true
+			plan = append(plan, FixUp{
+				Action: FixRelinkLeg, TransactionID: o.TransactionID, LegID: e.ID, AccountNumber: e.AccountNumber,
+				Reason: fmt.Sprintf("leg %d booked under %s is the missing counter leg of %s", e.ID, e.TransactionID, o.TransactionID),
+			})
+			break
+		}
+		if relinked {
+			continue
+		}
+		if counterparty := o.counterparty(); known[counterparty] {
+			delta[counterparty] -= o.Amount
+			plan = append(plan, FixUp{
+				Action: FixAddLeg, TransactionID: o.TransactionID, AccountNumber: counterparty, Amount: -o.Amount,
+				Reason: fmt.Sprintf("%s has no leg on %s", o.TransactionID, counterparty),
+			})
+			continue
+		}
+		plan = append(plan, FixUp{
+			Action: FixReview, TransactionID: o.TransactionID, LegID: o.ID, AccountNumber: o.AccountNumber,
+			Reason: fmt.Sprintf("%s has a single leg and %s is not one of our accounts", o.TransactionID, o.counterparty()),
+		})
+	}
+	for _, e := range extras {
+		if matched[e.ID] {
+			continue
+		}
+		delta[e.AccountNumber] -= e.Amount
+		plan = append(plan, FixUp{
+			Action: FixDeleteLeg, TransactionID: e.TransactionID, LegID: e.ID, AccountNumber: e.AccountNumber,
+			Reason: fmt.Sprintf("leg %d does not belong to the transfer of %s", e.ID, e.TransactionID),
+		})
+	}
+
+	for _, a := range accounts {
+		total := a.TransactionTotal + delta[a.AccountNumber]
+		if a.OpeningBalance+total == a.RecordedBalance {
+			continue
+		}
+		if !a.HasOpeningBalance {
+			opening := a.RecordedBalance - total
+			plan = append(plan, FixUp{
+				Action: FixSetOpeningBalance, AccountNumber: a.AccountNumber, Balance: &opening,
+				Reason: "no opening balance is recorded, this one explains the balance with the history",
+			})
+			continue
+		}
+		balance := a.OpeningBalance + total
+		plan = append(plan, FixUp{
+			Action: FixSetBalance, AccountNumber: a.AccountNumber, Balance: &balance,
+			Reason: fmt.Sprintf("recorded balance %d differs from opening balance plus history", a.RecordedBalance),
+		})
+	}
+	return plan
+}
+
+// GetReconciliation handler
+func (h *Handler) GetReconciliation(c *gin.Context) {
+	plan, err := strconv.ParseBool(c.DefaultQuery("plan", "false"))
+	if err != nil {
+		abortWithError(c, badRequest("plan must be true or false"), "")
+		return
+	}
+
+	report, err := h.reconcile(plan, time.Now())
+	if err != nil {
+		abortWithError(c, err, "unable to reconcile accounts")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// runReconcile is the reconcile subcommand. It writes the report of an existing database as
+// JSON to out and returns the exit code: 0 when the books reconcile, 1 when they do not and
+// 2 when the report could not be made.
+func runReconcile(args []string, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	path := flags.String("db", bankDB, "SQLite database to reconcile")
+	plan := flags.Bool("plan", false, "include a fix-up plan")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	db, err := sql.Open("sqlite", *path)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	defer db.Close()
+	// duplicate legs are what the reconciliation reports, they do not stop it
+	if err := Migrate(db); err != nil && !errors.Is(err, errDuplicateLegs) {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+
+	report, err := (&Handler{db: db}).reconcile(*plan, time.Now())
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func getReconciliation(t *testing.T, r *gin.Engine, path string) (int, ReconciliationReport) {
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var report ReconciliationReport
+	if w.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	}
+	return w.Code, report
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func TestReconciliation(t *testing.T) {
+	t.Run("CleanBooks", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("reconcile_clean_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		_, err = db.Exec(`INSERT INTO opening_balances (account_number, amount) VALUES ('12345', 1000), ('54321', 500)`)
+		assert.NoError(t, err)
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+		r.GET("/admin/reconciliation", handler.GetReconciliation)
+
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		code, report := getReconciliation(t, r, "/admin/reconciliation?plan=true")
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, report.OK)
+		assert.Equal(t, 2, report.Accounts)
+		assert.Empty(t, report.Mismatches)
+		assert.Empty(t, report.OrphanedLegs)
+		assert.Empty(t, report.Duplicates)
+		assert.Empty(t, report.Plan)
+	})
+
+	t.Run("BalanceDrift", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("reconcile_drift_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		_, err = db.Exec(`
+			INSERT INTO opening_balances (account_number, amount, as_of) VALUES ('12345', 1200, '2025-01-01T00:00:00Z');
+			INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at)
+			VALUES
+				('TXN0', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer out', -700, 'USD', 'Before opening', '2024-12-31T09:00:00Z'),
+				('TXN0', '54321', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer in', 700, 'USD', 'Before opening', '2024-12-31T09:00:00Z'),
+				('TXN1', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer out', -150, 'USD', 'Rent', '2025-01-10T09:00:00Z'),
+				('TXN1', '54321', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer in', 150, 'USD', 'Rent', '2025-01-10T09:00:00Z');
+			INSERT INTO holds (hold_id, account_number, amount, currency, status, created_at, updated_at)
+			VALUES ('HLD1', '12345', 100, 'USD', 'ACTIVE', '2025-01-11T00:00:00Z', '2025-01-11T00:00:00Z');`)
+		assert.NoError(t, err)
+
+		report, err := (&Handler{db: db}).reconcile(true, time.Now())
+		assert.NoError(t, err)
+		assert.False(t, report.OK)
+		assert.Equal(t, []BalanceMismatch{
+			{
+				AccountNumber: "12345", Currency: "USD", HasOpeningBalance: true, OpeningBalance: 1200,
+				TransactionTotal: -150, ExpectedBalance: 1050, RecordedBalance: 1000, Held: 100,
+				ExpectedAvailable: 950, RecordedAvailable: 900, Difference: -50,
+			},
+			{
+				AccountNumber: "54321", Currency: "USD", TransactionTotal: 850, ExpectedBalance: 850,
+				RecordedBalance: 500, ExpectedAvailable: 850, RecordedAvailable: 500, Difference: -350,
+			},
+		}, report.Mismatches)
+		assert.Equal(t, []FixUp{
+			{Action: FixSetBalance, AccountNumber: "12345", Balance: int64Ptr(1050), Reason: "recorded balance 1000 differs from opening balance plus history"},
+			{Action: FixSetOpeningBalance, AccountNumber: "54321", Balance: int64Ptr(-350), Reason: "no opening balance is recorded, this one explains the balance with the history"},
+		}, report.Plan)
+	})
+
+	t.Run("SeedRows", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("reconcile_seed_db")
+		assert.NoError(t, err)
+		defer cleanup()
+		assert.NoError(t, Seed(db))
+
+		report, err := (&Handler{db: db}).reconcile(false, time.Now())
+		assert.NoError(t, err)
+		assert.Empty(t, report.OrphanedLegs)
+		assert.Empty(t, report.Duplicates)
+	})
+
+	t.Run("MisbookedLeg", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("reconcile_misbooked_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		// the counter leg of TXN123434267 booked under the ID of another transfer, as the seed once did
+		_, err = db.Exec(`
+			INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, amount, currency, type, note, transferred_at)
+			VALUES
+				('TXN123456789', '111-111-111', '111-111-111', '222-222-222', 'MaiThai', 'KTB', -98982500, 'THB', 'Transfer out', 'Lunch', '2024-11-10T07:22:00Z'),
+				('TXN123456789', '222-222-222', '111-111-111', '222-222-222', 'MaiThai', 'KTB', 98982500, 'THB', 'Transfer in', 'Lunch', '2024-11-10T07:22:00Z'),
+				('TXN123434267', '111-111-111', '111-111-111', '444-444-444', 'Laumcing', 'KBANK', -2499800, 'THB', 'Transfer out', 'Lunch', '2025-01-10T07:22:00Z'),
+				('TXN123456789', '444-444-444', '111-111-111', '444-444-444', 'Laumcing', 'KBANK', 2499800, 'THB', 'Transfer in', 'Lunch', '2025-01-10T07:22:00Z')`)
+		assert.NoError(t, err)
+
+		var leg int64
+		assert.NoError(t, db.QueryRow(`SELECT id FROM transactions WHERE transaction_id = 'TXN123456789' AND account_number = '444-444-444'`).Scan(&leg))
+
+		report, err := (&Handler{db: db}).reconcile(true, time.Now())
+		assert.NoError(t, err)
+		assert.False(t, report.OK)
+
+		if assert.Len(t, report.OrphanedLegs, 1) {
+			assert.Equal(t, "TXN123434267", report.OrphanedLegs[0].TransactionID)
+			assert.Equal(t, "111-111-111", report.OrphanedLegs[0].AccountNumber)
+		}
+		if assert.Len(t, report.Duplicates, 1) {
+			d := report.Duplicates[0]
+			assert.Equal(t, "TXN123456789", d.TransactionID)
+			assert.Len(t, d.Kept, 2)
+			if assert.Len(t, d.Extra, 1) {
+				assert.Equal(t, leg, d.Extra[0].ID)
+			}
+		}
+
+		if assert.NotEmpty(t, report.Plan) {
+			assert.Equal(t, FixUp{
+				Action: FixRelinkLeg, TransactionID: "TXN123434267", LegID: leg, AccountNumber: "444-444-444",
+				Reason: "leg " + strconv.FormatInt(leg, 10) + " booked under TXN123456789 is the missing counter leg of TXN123434267",
+			}, report.Plan[0])
+		}
+		for _, fix := range report.Plan {
+			assert.NotEqual(t, FixDeleteLeg, fix.Action)
+		}
+	})
+
+	t.Run("InvalidPlan", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("reconcile_invalid_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		r := gin.Default()
+		r.GET("/admin/reconciliation", (&Handler{db: db}).GetReconciliation)
+		code, _ := getReconciliation(t, r, "/admin/reconciliation?plan=maybe")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestReconcileCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bank.sqlite")
+	db, err := sql.Open("sqlite", path)
+	assert.NoError(t, err)
+	assert.NoError(t, Migrate(db))
+	assert.NoError(t, Seed(db))
+	assert.NoError(t, db.Close())
+
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 1, runReconcile([]string{"-db", path, "-plan"}, &out, &errOut))
+	assert.Empty(t, errOut.String())
+
+	var report ReconciliationReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 4, report.Accounts)
+	assert.Empty(t, report.OrphanedLegs)
+	assert.NotEmpty(t, report.Mismatches)
+	assert.NotEmpty(t, report.Plan)
+
+	out.Reset()
+	errOut.Reset()
+	assert.Equal(t, 2, runReconcile([]string{"-db", filepath.Join(t.TempDir(), "missing.sqlite")}, &out, &errOut))
+	assert.Empty(t, out.String())
+	assert.NotEmpty(t, errOut.String())
+}
@@ -0,0 +1,387 @@
+// Package recurrence expands recurrence rules into the times a schedule runs.
+//
+// Rules are a subset of the RRULE of RFC 5545: FREQ (DAILY, WEEKLY or MONTHLY), INTERVAL,
+// BYDAY without ordinals, BYMONTHDAY, COUNT and UNTIL. BYSETPOS with a single value is
+// understood as well, so the last weekday of a month can be written as
+//
+//	FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1
+//
+// Weeks start on Monday. Unlike RFC 5545 a BYMONTHDAY past the end of a month falls on its
+// last day instead of skipping the month: a transfer on the 31st is still made in February.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// Frequency is how often a rule repeats.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// Weekdays are the days from Monday to Friday.
+var Weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+// maxPeriods caps how many days, weeks or months are searched for the next occurrence, so a
+// rule that never matches again still ends.
+const maxPeriods = 10000
+
+// Rule is a recurrence rule. A zero Interval repeats every period; a zero Count or Until
+// never ends the rule.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int // 1 to 31, or -1 to -31 counted from the end of the month
+	BySetPos   int   // picks one of the times a period matches, -1 being the last
+	Count      int
+	Until      time.Time
+}
+
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// ParseWeekday parses a two letter RFC 5545 weekday such as MO.
+func ParseWeekday(code string) (time.Weekday, error) {
+	for d, c := range weekdayCodes {
+		if c == code {
+			return time.Weekday(d), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown weekday %q", ErrInvalidRule, code)
+}
+
+// Parse parses an RRULE such as FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=10, with or without
+// its RRULE: prefix. Like RFC 5545 it does not care about case. An UNTIL date without a time
+// ends the rule at the end of that day; times are UTC.
+func Parse(s string) (Rule, error) {
+	var r Rule
+	seen := map[string]bool{}
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, part := range strings.Split(strings.TrimPrefix(s, "RRULE:"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return Rule{}, fmt.Errorf("%w: %q is not KEY=VALUE", ErrInvalidRule, part)
+		}
+		if seen[key] {
+			return Rule{}, fmt.Errorf("%w: %s is given twice", ErrInvalidRule, key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			r.Freq = Frequency(value)
+		case "INTERVAL":
+			r.Interval, err = parsePositive(key, value)
+		case "COUNT":
+			r.Count, err = parsePositive(key, value)
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				d, err := ParseWeekday(code)
+				if err != nil {
+					return Rule{}, err
+				}
+				r.ByDay = append(r.ByDay, d)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := strconv.Atoi(v)
+				if err != nil {
+					return Rule{}, fmt.Errorf("%w: BYMONTHDAY %q is not a number", ErrInvalidRule, v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, day)
+			}
+		case "BYSETPOS":
+			if r.BySetPos, err = strconv.Atoi(value); err != nil {
+				return Rule{}, fmt.Errorf("%w: BYSETPOS %q is not a single number", ErrInvalidRule, value)
+			}
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "WKST":
+			if value != "MO" {
+				err = fmt.Errorf("%w: weeks start on MO", ErrInvalidRule)
+			}
+		default:
+			err = fmt.Errorf("%w: %s is not supported", ErrInvalidRule, key)
+		}
+		if err != nil {
+			return Rule{}, err
+		}
+	}
+	if !seen["FREQ"] {
+		return Rule{}, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	return r, r.Validate()
+}
+
+func parsePositive(key, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: %s must be a positive number", ErrInvalidRule, key)
+	}
+	return n, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102T150405", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: UNTIL %q is not a date or date-time", ErrInvalidRule, value)
+}
+
+// Validate checks that r is a rule this package can expand.
+func (r Rule) Validate() error {
+	switch r.Freq {
+	case Daily, Weekly, Monthly:
+	default:
+		return fmt.Errorf("%w: FREQ must be DAILY, WEEKLY or MONTHLY", ErrInvalidRule)
+	}
+	switch {
+	case r.Interval < 0:
+		return fmt.Errorf("%w: INTERVAL must be a positive number", ErrInvalidRule)
+	case r.Count < 0:
+		return fmt.Errorf("%w: COUNT must be a positive number", ErrInvalidRule)
+	case r.Count > 0 && !r.Until.IsZero():
+		return fmt.Errorf("%w: COUNT and UNTIL can not both be given", ErrInvalidRule)
+	case r.Freq == Weekly && len(r.ByMonthDay) > 0:
+		return fmt.Errorf("%w: BYMONTHDAY does not apply to WEEKLY rules", ErrInvalidRule)
+	case r.BySetPos != 0 && len(r.ByDay) == 0 && len(r.ByMonthDay) == 0:
+		return fmt.Errorf("%w: BYSETPOS needs BYDAY or BYMONTHDAY", ErrInvalidRule)
+	case r.BySetPos < -366 || r.BySetPos > 366:
+		return fmt.Errorf("%w: BYSETPOS is out of range", ErrInvalidRule)
+	}
+	for _, day := range r.ByMonthDay {
+		if day == 0 || day < -31 || day > 31 {
+			return fmt.Errorf("%w: BYMONTHDAY %d is out of range", ErrInvalidRule, day)
+		}
+	}
+	return nil
+}
+
+// String renders r as an RRULE value, with its parts in a fixed order.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			codes[i] = weekdayCodes[d]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.BySetPos != 0 {
+		parts = append(parts, "BYSETPOS="+strconv.Itoa(r.BySetPos))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// First returns the first occurrence of r started at start: start itself when it matches the
+// rule, otherwise the first time after it that does. It is false when the rule has none.
+func (r Rule) First(start time.Time) (time.Time, bool) {
+	return r.Next(start, start.Add(-time.Nanosecond))
+}
+
+// Next returns the first occurrence of r started at start that is after after.
+func (r Rule) Next(start, after time.Time) (time.Time, bool) {
+	next := r.After(start, after, 1)
+	if len(next) == 0 {
+		return time.Time{}, false
+	}
+	return next[0], true
+}
+
+// After returns up to n occurrences of r started at start that are after after, in order.
+// Occurrences before after still count towards COUNT.
+func (r Rule) After(start, after time.Time, n int) []time.Time {
+	var times []time.Time
+	if n <= 0 {
+		return times
+	}
+	r.each(start, r.periodAfter(start, after), func(t time.Time) bool {
+		if t.After(after) {
+			times = append(times, t)
+		}
+		return len(times) < n
+	})
+	return times
+}
+
+// periodAfter returns the first period of r started at start that can have an occurrence
+// after after, so the occurrences before it are skipped rather than expanded. A rule with
+// COUNT has to be expanded from start to count its occurrences, it has at most COUNT of them.
+func (r Rule) periodAfter(start, after time.Time) time.Time {
+	first := r.periodOf(start)
+	if r.Count > 0 || !after.After(start) {
+		return first
+	}
+	last := r.periodOf(after.In(start.Location()))
+
+	var periods int
+	switch r.Freq {
+	case Daily:
+		periods = daysBetween(first, last)
+	case Weekly:
+		periods = daysBetween(first, last) / 7
+	default:
+		periods = (last.Year()-first.Year())*12 + int(last.Month()-first.Month())
+	}
+	periods -= periods % max(r.Interval, 1)
+	return r.addPeriods(first, periods)
+}
+
+// daysBetween returns the number of calendar days from a to b.
+func daysBetween(a, b time.Time) int {
+	a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// addPeriods moves period, the first day of a period of r, n periods on.
+func (r Rule) addPeriods(period time.Time, n int) time.Time {
+	switch r.Freq {
+	case Daily:
+		return period.AddDate(0, 0, n)
+	case Weekly:
+		return period.AddDate(0, 0, 7*n)
+	default:
+		return period.AddDate(0, n, 0)
+	}
+}
+
+// each calls yield with every occurrence of r started at start from the period starting at
+// period on, in order, until it returns false or the rule ends. Occurrences are at the time
+// of day of start.
+func (r Rule) each(start, period time.Time, yield func(time.Time) bool) {
+	interval := max(r.Interval, 1)
+	emitted := 0
+	for range maxPeriods {
+		for _, day := range r.days(period, start) {
+			t := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+			if t.Before(start) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return
+			}
+			if !yield(t) {
+				return
+			}
+			emitted++
+			if r.Count > 0 && emitted == r.Count {
+				return
+			}
+		}
+		period = r.addPeriods(period, interval)
+	}
+}
+
+// periodOf returns the first day of the day, week or month t is in.
+func (r Rule) periodOf(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch r.Freq {
+	case Daily:
+		return day
+	case Weekly:
+		return day.AddDate(0, 0, -int((t.Weekday()+6)%7))
+	default:
+		return day.AddDate(0, 0, 1-t.Day())
+	}
+}
+
+// days returns the days of the period starting at period that match r, in order.
+func (r Rule) days(period, start time.Time) []time.Time {
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		if r.matchesDay(period) {
+			days = append(days, period)
+		}
+	case Weekly:
+		weekdays := r.ByDay
+		if len(weekdays) == 0 {
+			weekdays = []time.Weekday{start.Weekday()}
+		}
+		for i := range 7 {
+			day := period.AddDate(0, 0, i)
+			if slices.Contains(weekdays, day.Weekday()) {
+				days = append(days, day)
+			}
+		}
+	default:
+		last := period.AddDate(0, 1, -1).Day()
+		for i := range last {
+			day := period.AddDate(0, 0, i)
+			if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+				if day.Day() == min(start.Day(), last) {
+					days = append(days, day)
+				}
+			} else if r.matchesDay(day) {
+				days = append(days, day)
+			}
+		}
+	}
+
+	if r.BySetPos == 0 {
+		return days
+	}
+	i := r.BySetPos - 1
+	if r.BySetPos < 0 {
+		i = len(days) + r.BySetPos
+	}
+	if i < 0 || i >= len(days) {
+		return nil
+	}
+	return days[i : i+1]
+}
+
+// matchesDay reports whether day is one of the BYDAY weekdays and BYMONTHDAY days of r.
+func (r Rule) matchesDay(day time.Time) bool {
+	if len(r.ByDay) > 0 && !slices.Contains(r.ByDay, day.Weekday()) {
+		return false
+	}
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	for _, d := range r.ByMonthDay {
+		if d < 0 {
+			d = last + d + 1
+		}
+		if min(d, last) == day.Day() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const layout = "2006-01-02 15:04"
+
+func at(value string) time.Time {
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func format(times []time.Time) []string {
+	s := make([]string, len(times))
+	for i, t := range times {
+		s[i] = t.Format("Mon " + layout)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rrule string
+		want  Rule
+		err   string
+	}{
+		{"FREQ=DAILY", Rule{Freq: Daily}, ""},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=10", Rule{Freq: Weekly, Interval: 2, ByDay: []time.Weekday{time.Monday, time.Friday}, Count: 10}, ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,-1;UNTIL=20301231", Rule{Freq: Monthly, ByMonthDay: []int{1, -1}, Until: at("2030-12-31 23:59").Add(59 * time.Second)}, ""},
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;UNTIL=20301231T090000Z", Rule{Freq: Monthly, ByDay: Weekdays, BySetPos: -1, Until: at("2030-12-31 09:00")}, ""},
+		{"FREQ=WEEKLY;WKST=MO", Rule{Freq: Weekly}, ""},
+		{"rrule:freq=weekly;byday=mo,Fr;Interval=2", Rule{Freq: Weekly, Interval: 2, ByDay: []time.Weekday{time.Monday, time.Friday}}, ""},
+		{"", Rule{}, "is not KEY=VALUE"},
+		{"INTERVAL=2", Rule{}, "FREQ is required"},
+		{"FREQ=YEARLY", Rule{}, "FREQ must be DAILY, WEEKLY or MONTHLY"},
+		{"FREQ=DAILY;INTERVAL=0", Rule{}, "INTERVAL must be a positive number"},
+		{"FREQ=DAILY;COUNT=2;COUNT=3", Rule{}, "COUNT is given twice"},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20300101", Rule{}, "COUNT and UNTIL can not both be given"},
+		{"FREQ=WEEKLY;BYDAY=1MO", Rule{}, `unknown weekday "1MO"`},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", Rule{}, "BYMONTHDAY does not apply to WEEKLY rules"},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", Rule{}, "BYMONTHDAY 32 is out of range"},
+		{"FREQ=MONTHLY;BYSETPOS=-1", Rule{}, "BYSETPOS needs BYDAY or BYMONTHDAY"},
+		{"FREQ=MONTHLY;BYMONTH=1", Rule{}, "BYMONTH is not supported"},
+		{"FREQ=WEEKLY;WKST=SU", Rule{}, "weeks start on MO"},
+		{"FREQ=DAILY;UNTIL=tomorrow", Rule{}, "is not a date or date-time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rrule, func(t *testing.T) {
+			r, err := Parse(tt.rrule)
+			if tt.err != "" {
+				assert.ErrorIs(t, err, ErrInvalidRule)
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, r)
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, rrule := range []string{
+		"FREQ=DAILY",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=10",
+		"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;UNTIL=20301231T090000Z",
+		"FREQ=MONTHLY;BYMONTHDAY=15,-1",
+	} {
+		r, err := Parse(rrule)
+		assert.NoError(t, err)
+		assert.Equal(t, rrule, r.String())
+	}
+}
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		start string
+		want  []string
+	}{
+		{"Daily", Rule{Freq: Daily}, "2030-01-30 09:00",
+			[]string{"Wed 2030-01-30 09:00", "Thu 2030-01-31 09:00", "Fri 2030-02-01 09:00"}},
+		{"EveryOtherDay", Rule{Freq: Daily, Interval: 2}, "2030-01-30 09:00",
+			[]string{"Wed 2030-01-30 09:00", "Fri 2030-02-01 09:00", "Sun 2030-02-03 09:00"}},
+		{"DailyOnWeekdays", Rule{Freq: Daily, ByDay: Weekdays}, "2030-02-01 09:00",
+			[]string{"Fri 2030-02-01 09:00", "Mon 2030-02-04 09:00", "Tue 2030-02-05 09:00"}},
+		{"WeeklyOnStartDay", Rule{Freq: Weekly}, "2030-01-30 09:00",
+			[]string{"Wed 2030-01-30 09:00", "Wed 2030-02-06 09:00", "Wed 2030-02-13 09:00"}},
+		{"WeeklyStartingBetweenDays", Rule{Freq: Weekly, ByDay: []time.Weekday{time.Monday, time.Friday}}, "2030-01-30 09:00",
+			[]string{"Fri 2030-02-01 09:00", "Mon 2030-02-04 09:00", "Fri 2030-02-08 09:00"}},
+		{"FortnightlyOnTwoDays", Rule{Freq: Weekly, Interval: 2, ByDay: []time.Weekday{time.Tuesday, time.Thursday}}, "2030-01-29 09:00",
+			[]string{"Tue 2030-01-29 09:00", "Thu 2030-01-31 09:00", "Tue 2030-02-12 09:00"}},
+		{"MonthlyOnStartDay", Rule{Freq: Monthly}, "2030-01-31 09:00",
+			[]string{"Thu 2030-01-31 09:00", "Thu 2030-02-28 09:00", "Sun 2030-03-31 09:00"}},
+		{"MonthlyOnThe31st", Rule{Freq: Monthly, ByMonthDay: []int{31}}, "2032-01-15 09:00",
+			[]string{"Sat 2032-01-31 09:00", "Sun 2032-02-29 09:00", "Wed 2032-03-31 09:00"}},
+		{"MonthlyOnTheLastDay", Rule{Freq: Monthly, ByMonthDay: []int{-1}}, "2030-04-01 09:00",
+			[]string{"Tue 2030-04-30 09:00", "Fri 2030-05-31 09:00", "Sun 2030-06-30 09:00"}},
+		{"MonthlyOn30And31InFebruary", Rule{Freq: Monthly, ByMonthDay: []int{30, 31}}, "2030-02-01 09:00",
+			[]string{"Thu 2030-02-28 09:00", "Sat 2030-03-30 09:00", "Sun 2030-03-31 09:00"}},
+		{"LastWeekdayOfMonth", Rule{Freq: Monthly, ByDay: Weekdays, BySetPos: -1}, "2030-03-01 09:00",
+			[]string{"Fri 2030-03-29 09:00", "Tue 2030-04-30 09:00", "Fri 2030-05-31 09:00"}},
+		{"Quarterly", Rule{Freq: Monthly, Interval: 3, ByMonthDay: []int{1}}, "2030-01-01 09:00",
+			[]string{"Tue 2030-01-01 09:00", "Mon 2030-04-01 09:00", "Mon 2030-07-01 09:00"}},
+		{"Count", Rule{Freq: Daily, Count: 2}, "2030-01-30 09:00",
+			[]string{"Wed 2030-01-30 09:00", "Thu 2030-01-31 09:00"}},
+		{"UntilIsInclusive", Rule{Freq: Daily, Until: at("2030-01-31 09:00")}, "2030-01-30 09:00",
+			[]string{"Wed 2030-01-30 09:00", "Thu 2030-01-31 09:00"}},
+		{"NeverMatches", Rule{Freq: Daily, ByMonthDay: []int{-31}, ByDay: []time.Weekday{time.Monday}, Until: at("2030-03-01 00:00")}, "2030-02-01 09:00",
+			[]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := at(tt.start)
+			assert.Equal(t, tt.want, format(tt.rule.After(start, start.Add(-time.Nanosecond), 3)))
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	start := at("2030-01-31 09:00")
+	r := Rule{Freq: Monthly, Count: 3}
+
+	first, ok := r.First(start)
+	assert.True(t, ok)
+	assert.Equal(t, start, first)
+
+	next, ok := r.Next(start, first)
+	assert.True(t, ok)
+	assert.Equal(t, at("2030-02-28 09:00"), next)
+
+	// earlier occurrences count towards COUNT
+	assert.Equal(t, []string{"Sun 2030-03-31 09:00"}, format(r.After(start, next, 12)))
+	_, ok = r.Next(start, at("2030-03-31 09:00"))
+	assert.False(t, ok)
+}
+
+func TestNextContinuesFromAfter(t *testing.T) {
+	tests := []struct {
+		name         string
+		rule         Rule
+		start, after string
+		want         string
+	}{
+		{"EveryThirdDay", Rule{Freq: Daily, Interval: 3}, "2030-01-01 09:00", "2030-01-05 09:00", "2030-01-07 09:00"},
+		{"EveryThirdDayLaterInTheDay", Rule{Freq: Daily, Interval: 3}, "2030-01-01 09:00", "2030-01-07 08:00", "2030-01-07 09:00"},
+		{"FortnightlyOnTwoDays", Rule{Freq: Weekly, Interval: 2, ByDay: []time.Weekday{time.Tuesday, time.Thursday}}, "2030-01-29 09:00", "2030-02-08 09:00", "2030-02-12 09:00"},
+		{"EveryOtherMonthOnThe31st", Rule{Freq: Monthly, Interval: 2, ByMonthDay: []int{31}}, "2030-01-31 09:00", "2030-02-28 09:00", "2030-03-31 09:00"},
+		// further from start than a rule is ever expanded
+		{"DecadesOn", Rule{Freq: Daily}, "2000-01-01 09:00", "2099-12-30 09:00", "2099-12-31 09:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, ok := tt.rule.Next(at(tt.start), at(tt.after))
+			assert.True(t, ok)
+			assert.Equal(t, at(tt.want), next)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"demo/fx"
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReversalRequest reverses a transfer fully, or partially when Amount is set. Amount is in the
+// currency of the original transfer.
+type ReversalRequest struct {
+	Amount money.Input `json:"amount"`
+	Note   string      `json:"note"`
+}
+
+type ReversalResponse struct {
+	TransactionID         string      `json:"transactionId"`
+	OriginalTransactionID string      `json:"originalTransactionId"`
+	Amount                money.Money `json:"amount"`
+	RefundableAmount      money.Money `json:"refundableAmount"`
+	OriginalStatus        string      `json:"originalStatus"`
+	TransferredAt         string      `json:"transferredAt"`
+}
+
+// reverse posts a compensating transfer from the recipient of the original transfer back to
+// its sender and records the refund on the original. Refunds add up to at most the original
+// amount; the original becomes REVERSED once it is fully refunded.
+func (h *Handler) reverse(tx *sql.Tx, originalID string, req ReversalRequest, stamp string) (*Transfer, *Transfer, error) {
+	original, err := h.getTransfer(tx, originalID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case original.Status == TransferReversed:
+		return nil, nil, errAlreadyReversed
+	case original.Status != TransferCompleted, original.ReversalOf != "":
+		return nil, nil, errNotReversible
+	}
+
+	// Without an amount whatever is left of the original is refunded
+	amount := money.New(original.Amount.Minor-original.RefundedAmount.Minor, original.Amount.Currency)
+	if req.Amount.IsSet() {
+		if amount, err = req.Amount.Resolve(original.Amount.Currency); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", errInvalidAmount, err)
+		}
+	}
+	if amount.Minor <= 0 {
+		return nil, nil, errInvalidAmount
+	}
+
+	// Claim the refund on the original, this fails if another reversal got there first
+	res, err := tx.Exec(`
+        UPDATE transfers
+        SET refunded_amount = refunded_amount + $1, updated_at = $2
+        WHERE transaction_id = $3
+        AND status = $4
+        AND refunded_amount + $1 <= amount`,
+		amount.Minor, stamp, original.TransactionID, TransferCompleted)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to update refunded amount: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, nil, err
+	} else if n == 0 {
+		return nil, nil, errRefundTooLarge
+	}
+	original.RefundedAmount.Minor += amount.Minor
+
+	note := req.Note
+	if note == "" {
+		note = "Reversal of " + original.TransactionID
+	}
+	reversal := &Transfer{
+		FromAccount: original.ToAccount,
+		ToAccount:   original.FromAccount,
+		ToBank:      original.ToBank,
+		Amount:      amount,
+		Note:        note,
+		ReversalOf:  original.TransactionID,
+	}
+	if original.Converted != nil {
+		if err := h.refundAtOriginalRate(tx, original, reversal); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := h.transfer(tx, reversal, stamp); err != nil {
+		return nil, nil, err
+	}
+
+	if original.RefundedAmount == original.Amount {
+		if err := h.setTransferStatus(tx, original, TransferReversed, "", stamp); err != nil {
+			return nil, nil, err
+		}
+	}
+	return original, reversal, nil
+}
+
+// refundAtOriginalRate turns reversal, a refund of part of a cross-currency transfer, around
+// at the rate of original so its sender gets back exactly what they paid. The recipient gives
+// back the same share of the converted amount; the last refund gives back whatever is left
+// of it so rounding never keeps or takes a minor unit. The rate is quoted the other way round,
+// like the rest of the reversal.
+func (h *Handler) refundAtOriginalRate(tx *sql.Tx, original, reversal *Transfer) error {
+	refund := reversal.Amount
+	debit, err := fx.Prorate(original.Converted.Minor, refund.Minor, original.Amount.Minor)
+	if err != nil {
+		return err
+	}
+	if original.RefundedAmount == original.Amount {
+		var refunded int64
+		err := tx.QueryRow(`
+            SELECT COALESCE(SUM(amount), 0)
+            FROM transfers
+            WHERE reversal_of = $1
+            AND status = $2`, original.TransactionID, TransferCompleted).Scan(&refunded)
+		if err != nil {
+			return fmt.Errorf("unable to get refunded amount: %w", err)
+		}
+		debit = original.Converted.Minor - refunded
+	}
+	if debit <= 0 {
+		return errInvalidAmount
+	}
+	rate, err := fx.ParseRate(original.ExchangeRate)
+	if err != nil {
+		return err
+	}
+
+	reversal.Amount = money.New(debit, original.Converted.Currency)
+	reversal.ExchangeRate = fx.FormatRate(fx.Invert(rate))
+	reversal.Converted = &refund
+	return nil
+}
+
+// CreateReversal handler
+func (h *Handler) CreateReversal(c *gin.Context) {
+	var req ReversalRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		abortWithError(c, badRequest("invalid request body"), "")
+		return
+	}
+
+	// Begin transaction
+	tx, err := h.db.Begin()
+	if err != nil {
+		abortWithError(c, err, "unable to reverse transfer")
+		return
+	}
+	defer tx.Rollback()
+
+	stamp := formatTime(time.Now())
+	original, reversal, err := h.reverse(tx, c.Param("transactionId"), req, stamp)
+	if errors.Is(err, errInsufficientBalance) {
+		err = errInsufficientBalance.withMessage("recipient has insufficient balance")
+	}
+	if err != nil {
+		abortWithError(c, err, "unable to reverse transfer")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		abortWithError(c, err, "unable to commit reversal")
+		return
+	}
+
+	// the amount given back to the original sender, in the currency of the original
+	c.JSON(http.StatusOK, ReversalResponse{
+		TransactionID:         reversal.TransactionID,
+		OriginalTransactionID: original.TransactionID,
+		Amount:                reversal.credit(),
+		RefundableAmount:      money.New(original.Amount.Minor-original.RefundedAmount.Minor, original.Amount.Currency),
+		OriginalStatus:        original.Status,
+		TransferredAt:         stamp,
+	})
+}
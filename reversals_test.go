@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupReversalRouter(t *testing.T, dbName string) (*Handler, *gin.Engine, string, func()) {
+	db, cleanup, err := setupTestDBTransfers(dbName)
+	assert.NoError(t, err)
+
+	handler := &Handler{db: db}
+	r := gin.Default()
+	r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+	r.GET("/accounts/:accountNumber/transactions", handler.GetTransactions)
+	r.POST("/transfers/:transactionId/reversals", handler.CreateReversal)
+
+	w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD","note":"Rent"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := TransferResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	return handler, r, resp.TransactionID, cleanup
+}
+
+func TestCreateReversal(t *testing.T) {
+	t.Run("FullReversal", func(t *testing.T) {
+		handler, r, txID, cleanup := setupReversalRouter(t, "reversal_full_db")
+		defer cleanup()
+
+		w := postWithKey(r, "/transfers/"+txID+"/reversals", "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp ReversalResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, txID, resp.OriginalTransactionID)
+		assert.Equal(t, money.New(200, "USD"), resp.Amount)
+		assert.Equal(t, money.New(0, "USD"), resp.RefundableAmount)
+		assert.Equal(t, TransferReversed, resp.OriginalStatus)
+
+		assert.Equal(t, int64(1000), balanceOf(t, handler.db, "12345"))
+		assert.Equal(t, int64(500), balanceOf(t, handler.db, "54321"))
+
+		original, err := handler.getTransfer(handler.db, txID)
+		assert.NoError(t, err)
+		assert.Equal(t, TransferReversed, original.Status)
+		assert.NotNil(t, original.ReversedAt)
+
+		// both accounts see the compensating leg linked to the original transfer
+		for account, kind := range map[string]string{"12345": "Transfer in", "54321": "Transfer out"} {
+			req, _ := http.NewRequest(http.MethodGet, "/accounts/"+account+"/transactions", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			var page TransactionPage
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+
+			var linked []Transaction
+			for _, txn := range page.Transactions {
+				if txn.OriginalTransactionID == txID {
+					linked = append(linked, txn)
+				}
+			}
+			if assert.Len(t, linked, 1, account) {
+				assert.Equal(t, resp.TransactionID, linked[0].TransactionID)
+				assert.Equal(t, kind, linked[0].Type)
+			}
+		}
+	})
+
+	t.Run("PartialRefundsUpToOriginalAmount", func(t *testing.T) {
+		handler, r, txID, cleanup := setupReversalRouter(t, "reversal_partial_db")
+		defer cleanup()
+
+		w := postWithKey(r, "/transfers/"+txID+"/reversals", "", `{"amount":150,"note":"Overpaid"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp ReversalResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, money.New(50, "USD"), resp.RefundableAmount)
+		assert.Equal(t, TransferCompleted, resp.OriginalStatus)
+
+		w = postWithKey(r, "/transfers/"+txID+"/reversals", "", `{"amount":60}`)
+		assertError(t, w, http.StatusUnprocessableEntity, codeRefundTooLarge, "reversal amount exceeds refundable amount")
+
+		// without an amount the rest is refunded
+		w = postWithKey(r, "/transfers/"+txID+"/reversals", "", `{}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, money.New(50, "USD"), resp.Amount)
+		assert.Equal(t, TransferReversed, resp.OriginalStatus)
+
+		assert.Equal(t, int64(1000), balanceOf(t, handler.db, "12345"))
+		assert.Equal(t, int64(500), balanceOf(t, handler.db, "54321"))
+	})
+
+	t.Run("ZeroOrNegativeAmount", func(t *testing.T) {
+		handler, r, txID, cleanup := setupReversalRouter(t, "reversal_zero_db")
+		defer cleanup()
+
+		for _, body := range []string{`{"amount":0}`, `{"amount":"0.00"}`, `{"amount":-50}`} {
+			w := postWithKey(r, "/transfers/"+txID+"/reversals", "", body)
+			assertError(t, w, http.StatusUnprocessableEntity, codeInvalidAmount, "invalid amount")
+		}
+
+		original, err := handler.getTransfer(handler.db, txID)
+		assert.NoError(t, err)
+		assert.Equal(t, TransferCompleted, original.Status)
+		assert.Equal(t, money.New(0, "USD"), original.RefundedAmount)
+		assert.Equal(t, int64(800), balanceOf(t, handler.db, "12345"))
+	})
+
+	t.Run("CannotReverseTwice", func(t *testing.T) {
+		handler, r, txID, cleanup := setupReversalRouter(t, "reversal_twice_db")
+		defer cleanup()
+
+		assert.Equal(t, http.StatusOK, postWithKey(r, "/transfers/"+txID+"/reversals", "", "").Code)
+		w := postWithKey(r, "/transfers/"+txID+"/reversals", "", "")
+		assertError(t, w, http.StatusConflict, codeAlreadyReversed, "transfer already reversed")
+		assert.Equal(t, int64(1000), balanceOf(t, handler.db, "12345"))
+	})
+
+	t.Run("CannotReverseAReversal", func(t *testing.T) {
+		_, r, txID, cleanup := setupReversalRouter(t, "reversal_of_reversal_db")
+		defer cleanup()
+
+		w := postWithKey(r, "/transfers/"+txID+"/reversals", "", `{"amount":10}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp ReversalResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		w = postWithKey(r, "/transfers/"+resp.TransactionID+"/reversals", "", "")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("RecipientWithoutFunds", func(t *testing.T) {
+		handler, r, txID, cleanup := setupReversalRouter(t, "reversal_no_funds_db")
+		defer cleanup()
+
+		_, err := handler.db.Exec(`UPDATE accounts SET balance = 100 WHERE account_number = '54321'`)
+		assert.NoError(t, err)
+
+		w := postWithKey(r, "/transfers/"+txID+"/reversals", "", "")
+		assertError(t, w, http.StatusUnprocessableEntity, codeInsufficientFunds, "recipient has insufficient balance")
+
+		original, err := handler.getTransfer(handler.db, txID)
+		assert.NoError(t, err)
+		assert.Equal(t, TransferCompleted, original.Status)
+		assert.Equal(t, money.New(0, "USD"), original.RefundedAmount)
+	})
+
+	t.Run("UnknownTransfer", func(t *testing.T) {
+		_, r, _, cleanup := setupReversalRouter(t, "reversal_unknown_db")
+		defer cleanup()
+
+		w := postWithKey(r, "/transfers/TXN0/reversals", "", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Schedule run statuses. A run that failed is RETRYING while the scheduler will try it
+// again, and FAILED once it gave up on the occurrence.
+const (
+	ScheduleRunSucceeded = "SUCCEEDED"
+	ScheduleRunRetrying  = "RETRYING"
+	ScheduleRunFailed    = "FAILED"
+)
+
+// ScheduleRun is one attempt of the scheduler at the transfer of an occurrence of a schedule.
+type ScheduleRun struct {
+	OccurrenceDate time.Time  `json:"occurrenceDate"`
+	Attempt        int        `json:"attempt"`
+	Status         string     `json:"status"`
+	TransactionID  string     `json:"transactionId,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	RetryAt        *time.Time `json:"retryAt,omitempty"`
+	At             time.Time  `json:"at"`
+}
+
+// recordScheduleRun appends run to the runs of the schedule scheduleID.
+func recordScheduleRun(db execer, scheduleID string, run ScheduleRun) error {
+	var retryAt string
+	if run.RetryAt != nil {
+		retryAt = formatTime(*run.RetryAt)
+	}
+	_, err := db.Exec(`
+        INSERT INTO schedule_runs (schedule_id, occurrence_date, attempt, status, transaction_id, error, retry_at, created_at)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8)`,
+		scheduleID, formatTime(run.OccurrenceDate), run.Attempt, run.Status, run.TransactionID, run.Error, retryAt, formatTime(run.At))
+	if err != nil {
+		return fmt.Errorf("unable to record schedule run: %w", err)
+	}
+	return nil
+}
+
+// getScheduleRuns returns the runs of the schedule scheduleID, oldest first.
+func (h *Handler) getScheduleRuns(scheduleID string) ([]ScheduleRun, error) {
+	rows, err := h.db.Query(`
+        SELECT occurrence_date, attempt, status, COALESCE(transaction_id, ''), COALESCE(error, ''), retry_at, created_at
+        FROM schedule_runs
+        WHERE schedule_id = $1
+        ORDER BY id ASC`, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get schedule runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []ScheduleRun{}
+	for rows.Next() {
+		var r ScheduleRun
+		var occurrenceDate, createdAt string
+		var retryAt sql.NullString
+		if err := rows.Scan(&occurrenceDate, &r.Attempt, &r.Status, &r.TransactionID, &r.Error, &retryAt, &createdAt); err != nil {
+			return nil, fmt.Errorf("unable to scan schedule run: %w", err)
+		}
+		if r.OccurrenceDate, err = parseTime(occurrenceDate); err != nil {
+			return nil, fmt.Errorf("invalid occurrence_date: %w", err)
+		}
+		if retryAt.Valid {
+			at, err := parseTime(retryAt.String)
+			if err != nil {
+				return nil, fmt.Errorf("invalid retry_at: %w", err)
+			}
+			r.RetryAt = &at
+		}
+		if r.At, err = parseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("invalid created_at: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// GetScheduleRuns handler
+func (h *Handler) GetScheduleRuns(c *gin.Context) {
+	accountNo := c.Param("accountNumber")
+	if err := h.accountExists(accountNo); err != nil {
+		abortWithError(c, err, "unable to get schedule runs")
+		return
+	}
+	s, err := h.getSchedule(h.db, accountNo, c.Param("scheduleId"))
+	if err != nil {
+		abortWithError(c, err, "unable to get schedule runs")
+		return
+	}
+
+	runs, err := h.getScheduleRuns(s.ScheduleID)
+	if err != nil {
+		abortWithError(c, err, "unable to get schedule runs")
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
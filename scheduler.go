@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"demo/calendar"
+	"demo/money"
+	"demo/recurrence"
+)
+
+const (
+	defaultHoldLead     = 24 * time.Hour
+	defaultRetries      = 3
+	defaultRetryBackoff = 30 * time.Minute
+	defaultSuspendAfter = 3
+)
+
+var errScheduleAlreadyTaken = errors.New("schedule already executed")
+
+// Scheduler executes rows from the schedules table once their schedule_date is due.
+// All of its state lives in the database, so it picks up where it left off after a restart.
+type Scheduler struct {
+	h        *Handler
+	now      func() time.Time
+	interval time.Duration
+
+	// holdLead is how long before a run its amount is held on the sender, defaults to 24h
+	holdLead time.Duration
+
+	// retries is how often a run that failed for want of funds or a recipient is tried again,
+	// first after retryBackoff and then after twice as long as the time before. Retries stay
+	// on the business day of the run. Defaults to 3 retries, the first after 30m
+	retries      int
+	retryBackoff time.Duration
+	// suspendAfter is how many runs in a row fail before the schedule is paused, defaults to
+	// 3; 0 never pauses it
+	suspendAfter int
+}
+
+// dueSchedule is a schedule row picked up for execution.
+type dueSchedule struct {
+	ScheduleID   string
+	FromAccount  string
+	ToAccount    string
+	ToBank       string
+	Amount       money.Money
+	Note         string
+	Schedule     string
+	RRule        string
+	Policy       calendar.Policy
+	StartDate    string
+	ScheduleDate string
+	// OccurrenceDate is the time the rule gave for this run, before Policy moved it
+	OccurrenceDate string
+	EndDate        string
+	// Attempts is how often the current run has been tried
+	Attempts            int
+	ConsecutiveFailures int
+}
+
+// NewScheduler creates a scheduler that polls every interval. now is the clock used to
+// decide which schedules are due; pass nil to use time.Now.
+func NewScheduler(h *Handler, now func() time.Time, interval time.Duration) *Scheduler {
+	if now == nil {
+		now = time.Now
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Scheduler{h: h, now: now, interval: interval, holdLead: defaultHoldLead,
+		retries: defaultRetries, retryBackoff: defaultRetryBackoff, suspendAfter: defaultSuspendAfter}
+}
+
+// Start runs due schedules immediately and then on every tick until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunDue(); err != nil {
+			log.Printf("scheduler: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue executes every schedule whose schedule_date, or retry_at for a run being retried, is
+// not after the current time and returns how many transfers were made.
+func (s *Scheduler) RunDue() (int, error) {
+	if err := s.holdUpcoming(); err != nil {
+		log.Printf("scheduler: %v", err)
+	}
+
+	due, err := s.dueSchedules(formatTime(s.now()))
+	if err != nil {
+		return 0, err
+	}
+
+	executed := 0
+	for _, d := range due {
+		err := s.execute(d)
+		switch {
+		case err == nil:
+			executed++
+		case errors.Is(err, errScheduleAlreadyTaken):
+			// another runner got there first
+		case isTransferFailure(err):
+			log.Printf("scheduler: schedule %s failed: %v", d.ScheduleID, err)
+			if err := s.fail(d, err); err != nil {
+				log.Printf("scheduler: unable to mark schedule %s as failed: %v", d.ScheduleID, err)
+			}
+		default:
+			// leave the schedule untouched so it is retried on the next tick
+			log.Printf("scheduler: schedule %s: %v", d.ScheduleID, err)
+		}
+	}
+	return executed, nil
+}
+
+// holdUpcoming reserves the amount of every schedule that runs within holdLead, so the funds
+// are still there when it is due, and releases holds of schedules that will no longer run.
+// A schedule the sender can not cover is left without a hold and fails when it is due.
+func (s *Scheduler) holdUpcoming() error {
+	now := s.now()
+	stamp := formatTime(now)
+
+	_, err := s.h.db.Exec(`
+        UPDATE holds
+        SET status = 'RELEASED', updated_at = $1
+        WHERE status = 'ACTIVE'
+        AND transaction_id IS NULL
+        AND schedule_id NOT IN (SELECT schedule_id FROM schedules WHERE status = 'SCHEDULED')`, stamp)
+	if err != nil {
+		return fmt.Errorf("unable to release schedule holds: %w", err)
+	}
+
+	upcoming, err := s.h.db.Query(`
+        SELECT s.from_account, s.amount, s.currency, s.schedule_id
+        FROM schedules s
+        WHERE s.status = 'SCHEDULED'
+        AND s.amount > 0
+        AND s.schedule_date <= $1
+        AND NOT EXISTS (
+            SELECT 1 FROM holds hl
+            WHERE hl.schedule_id = s.schedule_id
+            AND hl.transaction_id IS NULL
+            AND hl.status = 'ACTIVE')
+        ORDER BY s.schedule_date ASC`, formatTime(now.Add(s.holdLead)))
+	if err != nil {
+		return fmt.Errorf("unable to get upcoming schedules: %w", err)
+	}
+	var holds []Hold
+	for upcoming.Next() {
+		var hold Hold
+		if err := upcoming.Scan(&hold.AccountNumber, &hold.Amount.Minor, &hold.Amount.Currency, &hold.ScheduleID); err != nil {
+			upcoming.Close()
+			return fmt.Errorf("unable to scan schedule: %w", err)
+		}
+		holds = append(holds, hold)
+	}
+	upcoming.Close()
+	if err := upcoming.Err(); err != nil {
+		return err
+	}
+
+	for i := range holds {
+		if err := s.hold(&holds[i], stamp); err != nil {
+			log.Printf("scheduler: unable to hold funds for schedule %s: %v", holds[i].ScheduleID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) hold(hold *Hold, stamp string) error {
+	tx, err := s.h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.h.placeHold(tx, hold, stamp); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Scheduler) dueSchedules(now string) ([]dueSchedule, error) {
+	rows, err := s.h.db.Query(`
+        SELECT schedule_id, from_account, to_account, to_bank, amount, currency, note, schedule, COALESCE(rrule, ''),
+            COALESCE(business_day_policy, 'NONE'), COALESCE(start_date, ''), schedule_date, COALESCE(occurrence_date, schedule_date), end_date,
+            attempts, consecutive_failures
+        FROM schedules
+        WHERE status = 'SCHEDULED'
+        AND COALESCE(retry_at, schedule_date) <= $1
+        ORDER BY COALESCE(retry_at, schedule_date) ASC
+    `, now)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get due schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var due []dueSchedule
+	for rows.Next() {
+		var d dueSchedule
+		var toBank, note, endDate sql.NullString
+		if err := rows.Scan(&d.ScheduleID, &d.FromAccount, &d.ToAccount, &toBank, &d.Amount.Minor, &d.Amount.Currency, &note, &d.Schedule, &d.RRule,
+			&d.Policy, &d.StartDate, &d.ScheduleDate, &d.OccurrenceDate, &endDate, &d.Attempts, &d.ConsecutiveFailures); err != nil {
+			return nil, fmt.Errorf("unable to scan schedule: %w", err)
+		}
+		d.ToBank, d.Note, d.EndDate = toBank.String, note.String, endDate.String
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// execute makes the transfer for d and advances the schedule in the same database
+// transaction, so a schedule is never executed twice for the same run date.
+func (s *Scheduler) execute(d dueSchedule) error {
+	if d.Amount.Minor <= 0 {
+		return errInvalidAmount
+	}
+
+	tx, err := s.h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := s.now()
+	t := d.transfer()
+	if err := s.h.transfer(tx, t, formatTime(now)); err != nil {
+		return err
+	}
+
+	status, next, occurrence, err := nextRun(d, s.h.calendar, s.h.timezone())
+	if err != nil {
+		return err
+	}
+	// schedules from before rules were stored keep the rule they ran by from now on
+	rule, start, err := d.rule(s.h.timezone())
+	if err != nil {
+		return err
+	}
+	var rrule string
+	if rule != nil {
+		rrule = rule.String()
+	}
+
+	res, err := tx.Exec(`
+        UPDATE schedules
+        SET status = $1, schedule_date = $2, occurrence_date = $3, last_transaction_id = $4, last_run_at = $5, last_error = NULL,
+            rrule = COALESCE(rrule, NULLIF($8, '')), start_date = COALESCE(start_date, $9), attempts = 0, retry_at = NULL, consecutive_failures = 0
+        WHERE schedule_id = $6
+        AND status = 'SCHEDULED'
+        AND schedule_date = $7`,
+		status, next, occurrence, t.TransactionID, formatTime(now), d.ScheduleID, d.ScheduleDate, rrule, formatTime(start))
+	if err != nil {
+		return fmt.Errorf("unable to advance schedule: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errScheduleAlreadyTaken
+	}
+	run, err := d.run(ScheduleRunSucceeded, t.TransactionID, now)
+	if err != nil {
+		return err
+	}
+	if err := recordScheduleRun(tx, d.ScheduleID, run); err != nil {
+		return err
+	}
+	if status != ScheduleScheduled {
+		event := ScheduleEvent{Action: ScheduleCompletedEvent, Actor: schedulerActor, FromStatus: ScheduleScheduled, ToStatus: status}
+		if err := recordScheduleEvent(tx, d.ScheduleID, event, formatTime(now)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// fail records the failed transfer of a run of d and what becomes of the schedule. A run that
+// failed for want of funds or a recipient is tried again while retries are left; otherwise
+// its occurrence fails. A recurring schedule then moves on to its next run, unless too many
+// runs in a row have failed and it is paused; a schedule without runs left is marked as
+// FAILED. The funds held for an occurrence that failed are released.
+func (s *Scheduler) fail(d dueSchedule, reason error) error {
+	now := s.now()
+	stamp := formatTime(now)
+
+	tx, err := s.h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// claim the run first, the failed transfer is only recorded by the runner that got it
+	retryAt, retry := s.retryAt(d, reason, now)
+	var res sql.Result
+	status, action, failures := ScheduleScheduled, "", d.ConsecutiveFailures
+	if retry {
+		res, err = tx.Exec(`
+            UPDATE schedules
+            SET attempts = attempts + 1, retry_at = $1, last_run_at = $2, last_error = $3
+            WHERE schedule_id = $4
+            AND status = 'SCHEDULED'
+            AND schedule_date = $5
+            AND attempts = $6`,
+			formatTime(retryAt), stamp, reason.Error(), d.ScheduleID, d.ScheduleDate, d.Attempts)
+	} else {
+		var next, occurrence string
+		status, next, occurrence, err = nextRun(d, s.h.calendar, s.h.timezone())
+		if err != nil {
+			return err
+		}
+		failures++
+		switch {
+		case status == ScheduleCompleted:
+			// the run that failed was the last one
+			status, next, occurrence = ScheduleFailed, d.ScheduleDate, d.OccurrenceDate
+			action = ScheduleFailedEvent
+		case s.suspendAfter > 0 && failures >= s.suspendAfter:
+			status = SchedulePaused
+			action = ScheduleSuspendedEvent
+		}
+		res, err = tx.Exec(`
+            UPDATE schedules
+            SET status = $1, schedule_date = $2, occurrence_date = $3, attempts = 0, retry_at = NULL, consecutive_failures = $4,
+                last_run_at = $5, last_error = $6
+            WHERE schedule_id = $7
+            AND status = 'SCHEDULED'
+            AND schedule_date = $8
+            AND attempts = $9`,
+			status, next, occurrence, failures, stamp, reason.Error(), d.ScheduleID, d.ScheduleDate, d.Attempts)
+	}
+	if err != nil {
+		return err
+	}
+	// no rows means another runner got there first
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	t := d.transfer()
+	if err := s.h.recordFailedTransfer(tx, t, reason, stamp); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE schedules SET last_transaction_id = $1 WHERE schedule_id = $2`, t.TransactionID, d.ScheduleID); err != nil {
+		return err
+	}
+
+	run, err := d.run(ScheduleRunFailed, t.TransactionID, now)
+	if err != nil {
+		return err
+	}
+	run.Error = reason.Error()
+	if retry {
+		run.Status, run.RetryAt = ScheduleRunRetrying, &retryAt
+		if err := recordScheduleRun(tx, d.ScheduleID, run); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	if err := recordScheduleRun(tx, d.ScheduleID, run); err != nil {
+		return err
+	}
+
+	if action != "" {
+		changes := map[string]ScheduleChange{"lastError": {nil, reason.Error()}}
+		if action == ScheduleSuspendedEvent {
+			changes["consecutiveFailures"] = ScheduleChange{d.ConsecutiveFailures, failures}
+		}
+		event := ScheduleEvent{Action: action, Actor: schedulerActor, FromStatus: ScheduleScheduled, ToStatus: status, Changes: changes}
+		if err := recordScheduleEvent(tx, d.ScheduleID, event, stamp); err != nil {
+			return err
+		}
+	}
+	if err := s.h.releaseScheduleHolds(tx, d.ScheduleID, stamp); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// retryAt returns when to try the run of d again after it failed for reason at now. Only a
+// run short of funds or of a recipient is retried, as either may be there later; the wait
+// doubles with every attempt and the retry has to fall on the same day in the business
+// timezone.
+func (s *Scheduler) retryAt(d dueSchedule, reason error, now time.Time) (time.Time, bool) {
+	if d.Attempts >= s.retries || !(errors.Is(reason, errInsufficientBalance) || errors.Is(reason, errRecipientNotFound)) {
+		return time.Time{}, false
+	}
+	at := now.Add(s.retryBackoff << d.Attempts)
+	loc := s.h.timezone()
+	if at.In(loc).Format(time.DateOnly) != now.In(loc).Format(time.DateOnly) {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// run returns the attempt at the current run of d made at now.
+func (d dueSchedule) run(status, transactionID string, now time.Time) (ScheduleRun, error) {
+	occurrence, err := parseTime(d.OccurrenceDate)
+	if err != nil {
+		return ScheduleRun{}, fmt.Errorf("invalid occurrence date: %w", err)
+	}
+	return ScheduleRun{OccurrenceDate: occurrence, Attempt: d.Attempts + 1, Status: status, TransactionID: transactionID, At: now}, nil
+}
+
+// transfer returns the transfer the current run of d makes.
+func (d dueSchedule) transfer() *Transfer {
+	return &Transfer{
+		FromAccount: d.FromAccount,
+		ToAccount:   d.ToAccount,
+		ToBank:      d.ToBank,
+		Amount:      d.Amount,
+		Note:        d.Note,
+		ScheduleID:  d.ScheduleID,
+	}
+}
+
+// rule returns the recurrence rule of d, nil for a ONCE schedule, and the time it starts in
+// the business timezone loc, where the rule is evaluated.
+func (d dueSchedule) rule(loc *time.Location) (*recurrence.Rule, time.Time, error) {
+	start := d.StartDate
+	if start == "" {
+		start = d.ScheduleDate
+	}
+	at, err := parseTime(start)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid start date: %w", err)
+	}
+	at = at.In(loc)
+	rule, err := ruleOf(d.Schedule, d.RRule, at)
+	return rule, at, err
+}
+
+// nextRun returns the status, schedule_date and occurrence_date of d once its current run is
+// done. ONCE schedules complete; recurring schedules move to the next time their rule
+// matches in the business timezone loc until the rule or end_date ends them, and from there
+// to a business day of cal by the policy of d.
+func nextRun(d dueSchedule, cal *calendar.Calendar, loc *time.Location) (string, string, string, error) {
+	rule, start, err := d.rule(loc)
+	if err != nil {
+		return "", "", "", err
+	}
+	if rule == nil {
+		return ScheduleCompleted, d.ScheduleDate, d.OccurrenceDate, nil
+	}
+
+	current, err := parseTime(d.OccurrenceDate)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid occurrence date: %w", err)
+	}
+	at, ok := rule.Next(start, current)
+	occurrence := formatTime(at)
+
+	if !ok || (d.EndDate != "" && occurrence > d.EndDate) {
+		return ScheduleCompleted, d.ScheduleDate, d.OccurrenceDate, nil
+	}
+	return ScheduleScheduled, formatTime(cal.Adjust(at, d.Policy)), occurrence, nil
+}
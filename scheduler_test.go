@@ -0,0 +1,377 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func setupTestDBScheduler(dbName string) (*sql.DB, func(), error) {
+	// Create an in-memory SQLite database for testing
+	name := fmt.Sprintf("file:%s?mode=memory&cache=shared", dbName)
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Create tables
+	err = Migrate(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Insert initial data into accounts table
+	_, err = db.Exec(`
+		INSERT INTO accounts (branch, account_number, account_name, balance, currency)
+		VALUES
+			('Main', '12345', 'John Doe', 1000, 'USD'),
+			('Main', '54321', 'Jane Doe', 500, 'USD');
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return db, func() {
+		// Cleanup after tests
+		err := db.Close()
+		if err != nil {
+			fmt.Println("Error closing DB:", err)
+		}
+	}, nil
+}
+
+func insertSchedule(t *testing.T, db *sql.DB, id, toAccount string, amount int64, schedule, date, endDate string) {
+	_, err := db.Exec(`
+		INSERT INTO schedules (schedule_id, from_account, to_account, to_account_name, to_bank, amount, currency, note, status, schedule, schedule_date, end_date)
+		VALUES ($1, '12345', $2, 'Jane Doe', 'Bank B', $3, 'USD', 'Rent', 'SCHEDULED', $4, $5, $6)`,
+		id, toAccount, amount, schedule, date, endDate)
+	assert.NoError(t, err)
+}
+
+func fixedClock(value string) func() time.Time {
+	at, err := parseTime(value)
+	if err != nil {
+		panic(err)
+	}
+	return func() time.Time { return at }
+}
+
+func balanceOf(t *testing.T, db *sql.DB, accountNo string) int64 {
+	var balance int64
+	err := db.QueryRow("SELECT balance FROM accounts WHERE account_number = $1", accountNo).Scan(&balance)
+	assert.NoError(t, err)
+	return balance
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	t.Run("ExecutesDueOnceSchedule", func(t *testing.T) {
+		db, cleanup, err := setupTestDBScheduler("scheduler_once")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		insertSchedule(t, db, "SCH1", "54321", 200, "ONCE", "2025-02-01T09:00:00Z", "")
+		s := NewScheduler(&Handler{db: db}, fixedClock("2025-02-01T09:00:00Z"), time.Minute)
+
+		executed, err := s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, executed)
+
+		assert.Equal(t, int64(800), balanceOf(t, db, "12345"))
+		assert.Equal(t, int64(700), balanceOf(t, db, "54321"))
+
+		var status, txID string
+		err = db.QueryRow("SELECT status, last_transaction_id FROM schedules WHERE schedule_id = 'SCH1'").Scan(&status, &txID)
+		assert.NoError(t, err)
+		assert.Equal(t, "COMPLETED", status)
+
+		var legs int
+		err = db.QueryRow("SELECT COUNT(*) FROM transactions WHERE transaction_id = $1", txID).Scan(&legs)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, legs)
+	})
+
+	t.Run("SkipsScheduleNotYetDue", func(t *testing.T) {
+		db, cleanup, err := setupTestDBScheduler("scheduler_not_due")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		insertSchedule(t, db, "SCH1", "54321", 200, "ONCE", "2025-02-01T09:00:00Z", "")
+		s := NewScheduler(&Handler{db: db}, fixedClock("2025-02-01T08:59:59Z"), time.Minute)
+
+		executed, err := s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, executed)
+		assert.Equal(t, int64(1000), balanceOf(t, db, "12345"))
+	})
+
+	t.Run("NeverExecutesTwice", func(t *testing.T) {
+		db, cleanup, err := setupTestDBScheduler("scheduler_twice")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		insertSchedule(t, db, "SCH1", "54321", 200, "ONCE", "2025-02-01T09:00:00Z", "")
+		s := NewScheduler(&Handler{db: db}, fixedClock("2025-03-01T09:00:00Z"), time.Minute)
+
+		executed, err := s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, executed)
+
+		// simulate a restart
+		s = NewScheduler(&Handler{db: db}, fixedClock("2025-03-01T09:00:00Z"), time.Minute)
+		executed, err = s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, executed)
+		assert.Equal(t, int64(800), balanceOf(t, db, "12345"))
+
+		// a runner holding a stale row must not execute it again
+		err = s.execute(dueSchedule{ScheduleID: "SCH1", FromAccount: "12345", ToAccount: "54321", Amount: money.New(200, "USD"), Schedule: "ONCE", ScheduleDate: "2025-02-01T09:00:00Z"})
+		assert.ErrorIs(t, err, errScheduleAlreadyTaken)
+		assert.Equal(t, int64(800), balanceOf(t, db, "12345"))
+	})
+
+	t.Run("SurvivesAServerRestart", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "bank.sqlite")
+		start := func() *sql.DB {
+			db, err := sql.Open("sqlite", path)
+			assert.NoError(t, err)
+			db.SetMaxOpenConns(1)
+			assert.NoError(t, Migrate(db))
+			assert.NoError(t, Seed(db))
+			return db
+		}
+
+		db := start()
+		_, err := db.Exec(`UPDATE schedules SET amount = 100000 WHERE schedule_id = 'SCH123456789'`)
+		assert.NoError(t, err)
+		s := NewScheduler(&Handler{db: db}, fixedClock("2025-09-01T05:00:00Z"), time.Minute)
+		_, err = s.RunDue()
+		assert.NoError(t, err)
+		balance := balanceOf(t, db, "111-111-111")
+		assert.NoError(t, db.Close())
+
+		// starting again keeps the balances and does not run the schedule twice
+		db = start()
+		defer db.Close()
+		assert.Equal(t, balance, balanceOf(t, db, "111-111-111"))
+		var status string
+		assert.NoError(t, db.QueryRow(`SELECT status FROM schedules WHERE schedule_id = 'SCH123456789'`).Scan(&status))
+		assert.Equal(t, ScheduleCompleted, status)
+		s = NewScheduler(&Handler{db: db}, fixedClock("2025-09-01T05:00:00Z"), time.Minute)
+		executed, err := s.RunDue()
+		assert.NoError(t, err)
+		assert.Zero(t, executed)
+		assert.Equal(t, balance, balanceOf(t, db, "111-111-111"))
+	})
+
+	t.Run("AdvancesMonthlyUntilEndDate", func(t *testing.T) {
+		db, cleanup, err := setupTestDBScheduler("scheduler_monthly")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		insertSchedule(t, db, "SCH1", "54321", 100, "MONTHLY", "2025-01-31T09:00:00Z", "2025-03-15T00:00:00Z")
+		now := "2025-01-31T09:00:00Z"
+		s := NewScheduler(&Handler{db: db}, func() time.Time { return fixedClock(now)() }, time.Minute)
+
+		executed, err := s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, executed)
+
+		var status, date string
+		err = db.QueryRow("SELECT status, schedule_date FROM schedules WHERE schedule_id = 'SCH1'").Scan(&status, &date)
+		assert.NoError(t, err)
+		assert.Equal(t, "SCHEDULED", status)
+		assert.Equal(t, "2025-02-28T09:00:00Z", date)
+
+		now = "2025-02-28T09:00:00Z"
+		executed, err = s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, executed)
+
+		err = db.QueryRow("SELECT status, schedule_date FROM schedules WHERE schedule_id = 'SCH1'").Scan(&status, &date)
+		assert.NoError(t, err)
+		assert.Equal(t, "COMPLETED", status)
+		assert.Equal(t, int64(800), balanceOf(t, db, "12345"))
+	})
+
+	t.Run("InsufficientBalanceFailsSchedule", func(t *testing.T) {
+		db, cleanup, err := setupTestDBScheduler("scheduler_insufficient")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		insertSchedule(t, db, "SCH1", "54321", 5000, "ONCE", "2025-02-01T09:00:00Z", "")
+		s := NewScheduler(&Handler{db: db}, fixedClock("2025-02-01T09:00:00Z"), time.Minute)
+		s.retries = 0
+
+		executed, err := s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, executed)
+
+		var status, lastError string
+		err = db.QueryRow("SELECT status, last_error FROM schedules WHERE schedule_id = 'SCH1'").Scan(&status, &lastError)
+		assert.NoError(t, err)
+		assert.Equal(t, "FAILED", status)
+		assert.Equal(t, "insufficient balance", lastError)
+		assert.Equal(t, int64(1000), balanceOf(t, db, "12345"))
+	})
+}
+
+func TestSchedulerRetries(t *testing.T) {
+	runs := func(t *testing.T, r *gin.Engine, path string) []ScheduleRun {
+		var runs []ScheduleRun
+		w := sendJSON(r, http.MethodGet, path+"/runs", "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+		return runs
+	}
+
+	t.Run("RetriesWithinTheBusinessDay", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "scheduler_retry_db")
+		defer cleanup()
+		insertSchedule(t, handler.db, "SCH1", "54321", 5000, "ONCE", "2025-02-01T02:00:00Z", "")
+		s := NewScheduler(handler, fixedClock("2025-02-01T02:00:00Z"), time.Minute)
+
+		executed, err := s.RunDue()
+		assert.NoError(t, err)
+		assert.Zero(t, executed)
+		got := decodeSchedule(t, sendJSON(r, http.MethodGet, "/accounts/12345/schedules/SCH1", ""))
+		assert.Equal(t, ScheduleScheduled, got.Status)
+		if assert.NotNil(t, got.RetryAt) {
+			assert.Equal(t, "2025-02-01T02:30:00Z", formatTime(*got.RetryAt))
+		}
+
+		// not before the backoff is over
+		s.now = fixedClock("2025-02-01T02:29:00Z")
+		executed, err = s.RunDue()
+		assert.NoError(t, err)
+		assert.Zero(t, executed)
+
+		_, err = handler.db.Exec(`UPDATE accounts SET balance = 6000 WHERE account_number = '12345'`)
+		assert.NoError(t, err)
+		s.now = fixedClock("2025-02-01T02:30:00Z")
+		executed, err = s.RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, executed)
+
+		got = decodeSchedule(t, sendJSON(r, http.MethodGet, "/accounts/12345/schedules/SCH1", ""))
+		assert.Equal(t, ScheduleCompleted, got.Status)
+		assert.Nil(t, got.RetryAt)
+		history := runs(t, r, "/accounts/12345/schedules/SCH1")
+		if assert.Len(t, history, 2) {
+			assert.Equal(t, ScheduleRunRetrying, history[0].Status)
+			assert.Equal(t, 1, history[0].Attempt)
+			assert.Equal(t, "insufficient balance", history[0].Error)
+			assert.Equal(t, ScheduleRunSucceeded, history[1].Status)
+			assert.Equal(t, 2, history[1].Attempt)
+			assert.Equal(t, got.LastTransactionID, history[1].TransactionID)
+			assert.Equal(t, "2025-02-01T02:00:00Z", formatTime(history[1].OccurrenceDate))
+		}
+	})
+
+	t.Run("GivesUpAtTheEndOfTheDay", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "scheduler_retry_end_of_day_db")
+		defer cleanup()
+		// 23:00 in Bangkok leaves room for the first retry only
+		insertSchedule(t, handler.db, "SCH1", "54321", 5000, "ONCE", "2025-02-01T16:00:00Z", "")
+		s := NewScheduler(handler, nil, time.Minute)
+
+		for _, now := range []string{"2025-02-01T16:00:00Z", "2025-02-01T16:30:00Z"} {
+			s.now = fixedClock(now)
+			_, err := s.RunDue()
+			assert.NoError(t, err)
+		}
+
+		got := decodeSchedule(t, sendJSON(r, http.MethodGet, "/accounts/12345/schedules/SCH1", ""))
+		assert.Equal(t, ScheduleFailed, got.Status)
+		assert.Equal(t, "insufficient balance", got.LastError)
+		history := runs(t, r, "/accounts/12345/schedules/SCH1")
+		if assert.Len(t, history, 2) {
+			assert.Equal(t, ScheduleRunRetrying, history[0].Status)
+			assert.Equal(t, ScheduleRunFailed, history[1].Status)
+			assert.Nil(t, history[1].RetryAt)
+		}
+		events := scheduleEvents(t, r, "/accounts/12345/schedules/SCH1")
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, ScheduleFailedEvent, events[0].Action)
+		}
+	})
+
+	t.Run("MonthlyKeepsGoingUntilSuspended", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "scheduler_suspend_db")
+		defer cleanup()
+		insertSchedule(t, handler.db, "SCH1", "88888", 100, "MONTHLY", "2025-02-01T02:00:00Z", "")
+		s := NewScheduler(handler, fixedClock("2025-02-01T02:00:00Z"), time.Minute)
+		s.retries, s.suspendAfter = 0, 2
+
+		_, err := s.RunDue()
+		assert.NoError(t, err)
+		got := decodeSchedule(t, sendJSON(r, http.MethodGet, "/accounts/12345/schedules/SCH1", ""))
+		assert.Equal(t, ScheduleScheduled, got.Status)
+		assert.Equal(t, "2025-03-01T02:00:00Z", formatTime(got.ScheduleDate))
+		assert.Equal(t, 1, got.ConsecutiveFailures)
+		assert.Equal(t, "recipient account not found", got.LastError)
+
+		s.now = fixedClock("2025-03-01T02:00:00Z")
+		_, err = s.RunDue()
+		assert.NoError(t, err)
+		got = decodeSchedule(t, sendJSON(r, http.MethodGet, "/accounts/12345/schedules/SCH1", ""))
+		assert.Equal(t, SchedulePaused, got.Status)
+		assert.Equal(t, "2025-04-01T02:00:00Z", formatTime(got.ScheduleDate))
+		assert.Equal(t, 2, got.ConsecutiveFailures)
+
+		history := runs(t, r, "/accounts/12345/schedules/SCH1")
+		if assert.Len(t, history, 2) {
+			assert.Equal(t, "2025-02-01T02:00:00Z", formatTime(history[0].OccurrenceDate))
+			assert.Equal(t, "2025-03-01T02:00:00Z", formatTime(history[1].OccurrenceDate))
+			assert.Equal(t, ScheduleRunFailed, history[1].Status)
+		}
+		events := scheduleEvents(t, r, "/accounts/12345/schedules/SCH1")
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, ScheduleSuspendedEvent, events[0].Action)
+			assert.Equal(t, schedulerActor, events[0].Actor)
+			assert.Equal(t, SchedulePaused, events[0].ToStatus)
+		}
+
+		// resuming starts counting failures again
+		got = decodeSchedule(t, sendJSON(r, http.MethodPost, "/accounts/12345/schedules/SCH1/resume", ""))
+		assert.Equal(t, ScheduleScheduled, got.Status)
+		assert.Zero(t, got.ConsecutiveFailures)
+	})
+
+	t.Run("RunTakenByAnotherRunner", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "scheduler_retry_taken_db")
+		defer cleanup()
+		insertSchedule(t, handler.db, "SCH1", "54321", 5000, "ONCE", "2025-02-01T02:00:00Z", "")
+		s := NewScheduler(handler, fixedClock("2025-02-01T02:00:00Z"), time.Minute)
+
+		due, err := s.dueSchedules("2025-02-01T02:00:00Z")
+		assert.NoError(t, err)
+		if assert.Len(t, due, 1) {
+			assert.NoError(t, s.fail(due[0], errInsufficientBalance))
+			// a second runner that picked up the same run leaves no trace
+			assert.NoError(t, s.fail(due[0], errInsufficientBalance))
+		}
+
+		var transfers int
+		assert.NoError(t, handler.db.QueryRow(`SELECT COUNT(*) FROM transfers`).Scan(&transfers))
+		assert.Equal(t, 1, transfers)
+		assert.Len(t, runs(t, r, "/accounts/12345/schedules/SCH1"), 1)
+	})
+
+	t.Run("UnknownSchedule", func(t *testing.T) {
+		_, r, cleanup := setupScheduleRouter(t, "scheduler_runs_unknown_db")
+		defer cleanup()
+
+		w := sendJSON(r, http.MethodGet, "/accounts/12345/schedules/SCH1/runs", "")
+		assertError(t, w, http.StatusNotFound, codeScheduleNotFound, "schedule not found")
+	})
+}
@@ -0,0 +1,682 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"demo/calendar"
+	"demo/money"
+	"demo/recurrence"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Schedule statuses. A schedule is SCHEDULED while it has runs ahead of it; it can be PAUSED
+// and resumed, or CANCELLED. The scheduler moves it to COMPLETED after its last run, or to
+// FAILED when its last run can not be made, and pauses it when too many runs in a row fail.
+const (
+	ScheduleScheduled = "SCHEDULED"
+	SchedulePaused    = "PAUSED"
+	ScheduleCancelled = "CANCELLED"
+	ScheduleCompleted = "COMPLETED"
+	ScheduleFailed    = "FAILED"
+)
+
+var scheduleTransitions = map[string][]string{
+	ScheduleScheduled: {SchedulePaused, ScheduleCancelled, ScheduleCompleted, ScheduleFailed},
+	SchedulePaused:    {ScheduleScheduled, ScheduleCancelled, ScheduleCompleted},
+}
+
+// canMoveSchedule reports whether a schedule may move from status from to status to.
+func canMoveSchedule(from, to string) bool {
+	for _, next := range scheduleTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Schedule event actions, one per kind of change in the audit trail of a schedule.
+const (
+	ScheduleCreatedEvent   = "CREATED"
+	ScheduleUpdatedEvent   = "UPDATED"
+	SchedulePausedEvent    = "PAUSED"
+	ScheduleResumedEvent   = "RESUMED"
+	ScheduleCancelledEvent = "CANCELLED"
+	ScheduleCompletedEvent = "COMPLETED"
+	ScheduleFailedEvent    = "FAILED"
+	ScheduleSuspendedEvent = "SUSPENDED"
+)
+
+// schedulerActor is the actor of the changes the scheduler makes on its own. Changes made
+// through the API are made by the account in the path, the only identity the API has.
+const schedulerActor = "scheduler"
+
+// Schedule is a scheduled transfer. ScheduleDate is its next run, OccurrenceDate the time
+// its recurrence rule, RRule, gave for that run before BusinessDayPolicy moved it off a
+// weekend or bank holiday. StartDate is where the rule starts counting. RetryAt is when a run
+// that failed is tried again, ConsecutiveFailures how many runs in a row have failed.
+type Schedule struct {
+	ScheduleID          string      `json:"scheduleId"`
+	FromAccount         string      `json:"fromAccount"`
+	ToAccount           string      `json:"toAccount"`
+	ToAccountName       string      `json:"toAccountName"`
+	ToBank              string      `json:"toBank"`
+	Amount              money.Money `json:"amount"`
+	Note                string      `json:"note"`
+	ScheduleDate        time.Time   `json:"date"`
+	OccurrenceDate      time.Time   `json:"occurrenceDate"`
+	Schedule            string      `json:"schedule"`
+	RRule               string      `json:"rrule,omitempty"`
+	BusinessDayPolicy   string      `json:"businessDayPolicy"`
+	Status              string      `json:"status"`
+	StartDate           time.Time   `json:"startDate"`
+	EndDate             *time.Time  `json:"endDate,omitempty"`
+	LastTransactionID   string      `json:"lastTransactionId,omitempty"`
+	LastError           string      `json:"lastError,omitempty"`
+	RetryAt             *time.Time  `json:"retryAt,omitempty"`
+	ConsecutiveFailures int         `json:"consecutiveFailures"`
+}
+
+// ScheduleUpdate changes a SCHEDULED or PAUSED schedule. Fields left out keep their value;
+// an empty EndDate removes the end date.
+type ScheduleUpdate struct {
+	Amount            money.Input `json:"amount"`
+	Note              *string     `json:"note"`
+	NextRunDate       *string     `json:"nextRunDate"`
+	EndDate           *string     `json:"endDate"`
+	BusinessDayPolicy *string     `json:"businessDayPolicy"`
+}
+
+// ScheduleEvent is an entry in the audit trail of a schedule: who changed it, when, and
+// the fields that changed.
+type ScheduleEvent struct {
+	Action     string                    `json:"action"`
+	Actor      string                    `json:"actor"`
+	FromStatus string                    `json:"fromStatus,omitempty"`
+	ToStatus   string                    `json:"toStatus"`
+	Changes    map[string]ScheduleChange `json:"changes,omitempty"`
+	RequestID  string                    `json:"requestId,omitempty"`
+	At         time.Time                 `json:"at"`
+}
+
+// ScheduleChange is the value of a schedule field before and after a change.
+type ScheduleChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+const scheduleColumns = `schedule_id, from_account, to_account, to_account_name, to_bank, amount, currency, note, schedule_date,
+            occurrence_date, schedule, rrule, business_day_policy, status, start_date, end_date, last_transaction_id, last_error, retry_at,
+            consecutive_failures`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSchedule(row rowScanner) (*Schedule, error) {
+	var s Schedule
+	var toBank, note, occurrenceDate, rrule, policy, status, startDate, endDate, lastTransactionID, lastError, retryAt sql.NullString
+	var scheduleDate string
+	if err := row.Scan(&s.ScheduleID, &s.FromAccount, &s.ToAccount, &s.ToAccountName, &toBank, &s.Amount.Minor, &s.Amount.Currency, &note, &scheduleDate,
+		&occurrenceDate, &s.Schedule, &rrule, &policy, &status, &startDate, &endDate, &lastTransactionID, &lastError, &retryAt,
+		&s.ConsecutiveFailures); err != nil {
+		return nil, err
+	}
+	s.ToBank, s.Note, s.RRule, s.Status = toBank.String, note.String, rrule.String, status.String
+	s.LastTransactionID, s.LastError = lastTransactionID.String, lastError.String
+	// schedules from before business day policies ran on the day their rule gave
+	s.BusinessDayPolicy = cmp.Or(policy.String, string(calendar.None))
+
+	var err error
+	if s.ScheduleDate, err = parseTime(scheduleDate); err != nil {
+		return nil, fmt.Errorf("invalid schedule_date: %w", err)
+	}
+	s.OccurrenceDate = s.ScheduleDate
+	if occurrenceDate.String != "" {
+		if s.OccurrenceDate, err = parseTime(occurrenceDate.String); err != nil {
+			return nil, fmt.Errorf("invalid occurrence_date: %w", err)
+		}
+	}
+	// schedules from before start dates were kept start at their next run
+	s.StartDate = s.ScheduleDate
+	if startDate.String != "" {
+		if s.StartDate, err = parseTime(startDate.String); err != nil {
+			return nil, fmt.Errorf("invalid start_date: %w", err)
+		}
+	}
+	if endDate.String != "" {
+		end, err := parseTime(endDate.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end_date: %w", err)
+		}
+		s.EndDate = &end
+	}
+	if retryAt.String != "" {
+		retry, err := parseTime(retryAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_at: %w", err)
+		}
+		s.RetryAt = &retry
+	}
+	return &s, nil
+}
+
+// getSchedule loads the schedule scheduleID of accountNo. A schedule of another account is
+// not found, so its ID tells nothing about it.
+func (h *Handler) getSchedule(q queryRower, accountNo, scheduleID string) (*Schedule, error) {
+	s, err := scanSchedule(q.QueryRow(`
+        SELECT `+scheduleColumns+`
+        FROM schedules
+        WHERE schedule_id = $1
+        AND from_account = $2`, scheduleID, accountNo))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errScheduleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get schedule: %w", err)
+	}
+	return s, nil
+}
+
+// GetSchedules lists the schedules of an account by their next run, those still running
+// (SCHEDULED or PAUSED) unless the status query parameter asks for another status.
+func (h *Handler) GetSchedules(c *gin.Context) {
+	accountNo := c.Param("accountNumber")
+	if err := h.accountExists(accountNo); err != nil {
+		abortWithError(c, err, "unable to get schedules")
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", ScheduleScheduled, SchedulePaused, ScheduleCancelled, ScheduleCompleted, ScheduleFailed:
+	default:
+		abortWithError(c, badRequest("invalid status"), "")
+		return
+	}
+
+	rows, err := h.db.Query(`
+        SELECT `+scheduleColumns+`
+        FROM schedules
+        WHERE from_account = $1
+        AND (($2 = '' AND status IN ('SCHEDULED', 'PAUSED')) OR status = $2)
+        ORDER BY schedule_date ASC, schedule_id ASC`, accountNo, status)
+	if err != nil {
+		abortWithError(c, err, "unable to get schedules")
+		return
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			abortWithError(c, err, "unable to get schedules")
+			return
+		}
+		schedules = append(schedules, *s)
+	}
+	if err := rows.Err(); err != nil {
+		abortWithError(c, err, "unable to get schedules")
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// GetSchedule handler
+func (h *Handler) GetSchedule(c *gin.Context) {
+	accountNo := c.Param("accountNumber")
+	if err := h.accountExists(accountNo); err != nil {
+		abortWithError(c, err, "unable to get schedule")
+		return
+	}
+	s, err := h.getSchedule(h.db, accountNo, c.Param("scheduleId"))
+	if err != nil {
+		abortWithError(c, err, "unable to get schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+// UpdateSchedule changes the amount, note, next run date or end date of a schedule. A new
+// amount is held to the transfer limit like a new transfer.
+func (h *Handler) UpdateSchedule(c *gin.Context) {
+	var req ScheduleUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, badRequest("invalid request body"), "")
+		return
+	}
+	if !req.Amount.IsSet() && req.Note == nil && req.NextRunDate == nil && req.EndDate == nil && req.BusinessDayPolicy == nil {
+		abortWithError(c, badRequest("nothing to update"), "")
+		return
+	}
+	// the sender is loaded up front, the database is busy with the schedule once it is changed
+	account, err := h.getAccount(c.Param("accountNumber"))
+	if err != nil {
+		abortWithError(c, err, "unable to change schedule")
+		return
+	}
+
+	h.changeSchedule(c, ScheduleUpdatedEvent, func(s *Schedule, _ time.Time) error {
+		if s.Status != ScheduleScheduled && s.Status != SchedulePaused {
+			return errScheduleStatus.withMessage(fmt.Sprintf("a %s schedule can not be changed", strings.ToLower(s.Status)))
+		}
+		if err := req.apply(s, h.calendar, h.timezone()); err != nil {
+			return err
+		}
+		if req.Amount.IsSet() {
+			return checkTransferLimit(s.Amount, account)
+		}
+		return nil
+	})
+}
+
+// apply checks the fields of u against s and sets them on s, moving a new next run off the
+// days cal closes. Dates without an offset are read in the business timezone loc. It fails
+// with a ValidationError listing every field at fault.
+func (u ScheduleUpdate) apply(s *Schedule, cal *calendar.Calendar, loc *time.Location) error {
+	var v ValidationError
+	if u.Amount.IsSet() {
+		amount, err := u.Amount.Resolve(s.Amount.Currency)
+		switch {
+		case err != nil:
+			v.add("amount", fieldInvalidAmount, err.Error())
+		case amount.Minor <= 0:
+			v.add("amount", fieldNotPositive, "amount must be positive")
+		default:
+			s.Amount = amount
+		}
+	}
+	if u.Note != nil {
+		if utf8.RuneCountInString(*u.Note) > maxNoteLength {
+			v.add("note", fieldTooLong, "note is longer than 140 characters")
+		} else {
+			s.Note = *u.Note
+		}
+	}
+	if u.NextRunDate != nil {
+		next, err := parseClientTime(*u.NextRunDate, loc)
+		if err != nil {
+			v.add("nextRunDate", fieldInvalidDate, "invalid next run date")
+		} else {
+			s.OccurrenceDate = next
+		}
+	}
+	if u.BusinessDayPolicy != nil {
+		if policy, err := calendar.ParsePolicy(*u.BusinessDayPolicy); err != nil {
+			v.add("businessDayPolicy", fieldInvalidPolicy, "businessDayPolicy must be PREVIOUS, NEXT or NONE")
+		} else {
+			s.BusinessDayPolicy = string(policy)
+		}
+	}
+	if u.NextRunDate != nil || u.BusinessDayPolicy != nil {
+		s.ScheduleDate = cal.Adjust(s.OccurrenceDate.In(loc), calendar.Policy(s.BusinessDayPolicy)).UTC()
+	}
+	if u.EndDate != nil {
+		if *u.EndDate == "" {
+			s.EndDate = nil
+		} else if end, err := parseClientTime(*u.EndDate, loc); err != nil {
+			v.add("endDate", fieldInvalidDate, "invalid end date")
+		} else {
+			s.EndDate = &end
+		}
+	}
+	if len(v.Fields) == 0 && s.EndDate != nil && s.EndDate.Before(s.OccurrenceDate) {
+		v.add("endDate", fieldEndBeforeStart, "endDate is before the next run date")
+	}
+	return v.err()
+}
+
+// CancelSchedule stops a schedule for good. The row is kept, CANCELLED, along with its
+// audit trail.
+func (h *Handler) CancelSchedule(c *gin.Context) {
+	h.changeSchedule(c, ScheduleCancelledEvent, func(s *Schedule, _ time.Time) error {
+		return s.moveTo(ScheduleCancelled, "cancelled")
+	})
+}
+
+// PauseSchedule stops the runs of a schedule until it is resumed.
+func (h *Handler) PauseSchedule(c *gin.Context) {
+	h.changeSchedule(c, SchedulePausedEvent, func(s *Schedule, _ time.Time) error {
+		return s.moveTo(SchedulePaused, "paused")
+	})
+}
+
+// ResumeSchedule picks up a paused schedule. A recurring schedule skips the runs it missed
+// while paused rather than making them all at once; should none be left it completes. A
+// missed ONCE schedule runs on the next tick of the scheduler.
+func (h *Handler) ResumeSchedule(c *gin.Context) {
+	h.changeSchedule(c, ScheduleResumedEvent, func(s *Schedule, now time.Time) error {
+		if s.Status != SchedulePaused {
+			return errScheduleStatus.withMessage(fmt.Sprintf("a %s schedule can not be resumed", strings.ToLower(s.Status)))
+		}
+		s.Status = ScheduleScheduled
+		// a schedule the scheduler paused after failed runs starts counting them again
+		s.ConsecutiveFailures = 0
+
+		rule, start, err := s.rule(h.timezone())
+		if err != nil || rule == nil {
+			return err
+		}
+		for s.ScheduleDate.Before(now) {
+			next, ok := rule.Next(start, s.OccurrenceDate)
+			if !ok || (s.EndDate != nil && next.After(*s.EndDate)) {
+				s.Status = ScheduleCompleted
+				return nil
+			}
+			s.OccurrenceDate, s.ScheduleDate = next.UTC(), h.calendar.Adjust(next, calendar.Policy(s.BusinessDayPolicy)).UTC()
+		}
+		return nil
+	})
+}
+
+// ruleOf returns the recurrence rule of a schedule of kind stored as rrule, nil for a ONCE
+// schedule. MONTHLY schedules from before rules were stored recur on the day of the month
+// they start.
+func ruleOf(kind, rrule string, start time.Time) (*recurrence.Rule, error) {
+	if rrule != "" {
+		rule, err := recurrence.Parse(rrule)
+		if err != nil {
+			return nil, err
+		}
+		return &rule, nil
+	}
+	if kind == "MONTHLY" {
+		return &recurrence.Rule{Freq: recurrence.Monthly, ByMonthDay: []int{start.Day()}}, nil
+	}
+	return nil, nil
+}
+
+// rule returns the recurrence rule of s, nil for a ONCE schedule, and its start in the
+// business timezone loc, where the rule is evaluated.
+func (s *Schedule) rule(loc *time.Location) (*recurrence.Rule, time.Time, error) {
+	start := s.StartDate.In(loc)
+	rule, err := ruleOf(s.Schedule, s.RRule, start)
+	return rule, start, err
+}
+
+const (
+	defaultOccurrences = 12
+	maxOccurrences     = 100
+)
+
+// ScheduleOccurrences are the upcoming runs of a schedule.
+type ScheduleOccurrences struct {
+	ScheduleID        string       `json:"scheduleId"`
+	RRule             string       `json:"rrule,omitempty"`
+	BusinessDayPolicy string       `json:"businessDayPolicy"`
+	Occurrences       []Occurrence `json:"occurrences"`
+}
+
+// Occurrence is a run of a schedule. When its rule gave a day that is not a business day,
+// OriginalDate is that day and Holiday names the holiday on it, if any.
+type Occurrence struct {
+	Date         time.Time  `json:"date"`
+	OriginalDate *time.Time `json:"originalDate,omitempty"`
+	Holiday      string     `json:"holiday,omitempty"`
+}
+
+// occurrences returns up to n upcoming runs of s, starting with its next run, moved off the
+// days cal closes in the business timezone loc. A schedule that no longer runs has none.
+func (s *Schedule) occurrences(n int, cal *calendar.Calendar, loc *time.Location) ([]Occurrence, error) {
+	occurrences := []Occurrence{}
+	if s.Status != ScheduleScheduled && s.Status != SchedulePaused {
+		return occurrences, nil
+	}
+	rule, start, err := s.rule(loc)
+	if err != nil {
+		return nil, err
+	}
+	times := []time.Time{s.OccurrenceDate.In(loc)}
+	if rule != nil {
+		times = append(times, rule.After(start, s.OccurrenceDate, n-1)...)
+	}
+	for _, t := range times {
+		if s.EndDate != nil && t.After(*s.EndDate) {
+			break
+		}
+		o := Occurrence{Date: cal.Adjust(t, calendar.Policy(s.BusinessDayPolicy)).UTC()}
+		if !o.Date.Equal(t) {
+			original := t.UTC()
+			o.OriginalDate = &original
+			o.Holiday, _ = cal.Holiday(t)
+		}
+		occurrences = append(occurrences, o)
+	}
+	return occurrences, nil
+}
+
+// GetScheduleOccurrences previews the next runs of a schedule, as many as the n query
+// parameter asks for, 12 by default.
+func (h *Handler) GetScheduleOccurrences(c *gin.Context) {
+	n := defaultOccurrences
+	if v := c.Query("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 1 || n > maxOccurrences {
+			abortWithError(c, badRequest("n must be between 1 and %d", maxOccurrences), "")
+			return
+		}
+	}
+
+	accountNo := c.Param("accountNumber")
+	if err := h.accountExists(accountNo); err != nil {
+		abortWithError(c, err, "unable to get schedule occurrences")
+		return
+	}
+	s, err := h.getSchedule(h.db, accountNo, c.Param("scheduleId"))
+	if err != nil {
+		abortWithError(c, err, "unable to get schedule occurrences")
+		return
+	}
+	occurrences, err := s.occurrences(n, h.calendar, h.timezone())
+	if err != nil {
+		abortWithError(c, err, "unable to get schedule occurrences")
+		return
+	}
+
+	c.JSON(http.StatusOK, ScheduleOccurrences{ScheduleID: s.ScheduleID, RRule: s.RRule, BusinessDayPolicy: s.BusinessDayPolicy, Occurrences: occurrences})
+}
+
+// moveTo moves s to status, failing with errScheduleStatus when it can not get there; verb
+// names the change in the error message.
+func (s *Schedule) moveTo(status, verb string) error {
+	if !canMoveSchedule(s.Status, status) {
+		return errScheduleStatus.withMessage(fmt.Sprintf("a %s schedule can not be %s", strings.ToLower(s.Status), verb))
+	}
+	s.Status = status
+	return nil
+}
+
+// changeSchedule loads the schedule in the path, lets change modify it and saves it along
+// with an audit event, answering with the schedule as it is afterwards. Funds held for its
+// next run are released should the run no longer happen as held, the scheduler holds them
+// again when it is due.
+func (h *Handler) changeSchedule(c *gin.Context, action string, change func(s *Schedule, now time.Time) error) {
+	accountNo := c.Param("accountNumber")
+	if err := h.accountExists(accountNo); err != nil {
+		abortWithError(c, err, "unable to change schedule")
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		abortWithError(c, err, "unable to change schedule")
+		return
+	}
+	defer tx.Rollback()
+
+	s, err := h.getSchedule(tx, accountNo, c.Param("scheduleId"))
+	if err != nil {
+		abortWithError(c, err, "unable to change schedule")
+		return
+	}
+	before := *s
+	now := time.Now()
+	if err := change(s, now); err != nil {
+		abortWithError(c, err, "unable to change schedule")
+		return
+	}
+
+	stamp := formatTime(now)
+	if err := h.saveSchedule(tx, &before, s, stamp); err != nil {
+		abortWithError(c, err, "unable to change schedule")
+		return
+	}
+	event := ScheduleEvent{Action: action, Actor: accountNo, FromStatus: before.Status, ToStatus: s.Status, Changes: diffSchedules(&before, s), RequestID: requestID(c)}
+	if err := recordScheduleEvent(tx, s.ScheduleID, event, stamp); err != nil {
+		abortWithError(c, err, "unable to change schedule")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		abortWithError(c, err, "unable to change schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+// saveSchedule writes the changes from before to after, releasing the funds held for the
+// next run when its amount, date or status changed. Such a change also drops the retries
+// left of a failed run, the run starts over with its new date.
+func (h *Handler) saveSchedule(tx *sql.Tx, before, after *Schedule, stamp string) error {
+	if after.Status != before.Status || !after.ScheduleDate.Equal(before.ScheduleDate) {
+		after.RetryAt = nil
+	}
+	var endDate, retryAt string
+	if after.EndDate != nil {
+		endDate = formatTime(*after.EndDate)
+	}
+	if after.RetryAt != nil {
+		retryAt = formatTime(*after.RetryAt)
+	}
+	_, err := tx.Exec(`
+        UPDATE schedules
+        SET status = $1, amount = $2, note = $3, schedule_date = $4, end_date = NULLIF($5, ''), occurrence_date = $6, business_day_policy = $7,
+            retry_at = NULLIF($8, ''), attempts = CASE WHEN $8 = '' THEN 0 ELSE attempts END, consecutive_failures = $9
+        WHERE schedule_id = $10`,
+		after.Status, after.Amount.Minor, after.Note, formatTime(after.ScheduleDate), endDate, formatTime(after.OccurrenceDate),
+		after.BusinessDayPolicy, retryAt, after.ConsecutiveFailures, after.ScheduleID)
+	if err != nil {
+		return fmt.Errorf("unable to update schedule: %w", err)
+	}
+
+	if after.Status != before.Status || after.Amount != before.Amount || !after.ScheduleDate.Equal(before.ScheduleDate) {
+		return h.releaseScheduleHolds(tx, after.ScheduleID, stamp)
+	}
+	return nil
+}
+
+// diffSchedules returns the fields clients can change that differ between before and after.
+func diffSchedules(before, after *Schedule) map[string]ScheduleChange {
+	changes := map[string]ScheduleChange{}
+	if before.Amount != after.Amount {
+		changes["amount"] = ScheduleChange{before.Amount, after.Amount}
+	}
+	if before.Note != after.Note {
+		changes["note"] = ScheduleChange{before.Note, after.Note}
+	}
+	if !before.ScheduleDate.Equal(after.ScheduleDate) {
+		changes["nextRunDate"] = ScheduleChange{formatTime(before.ScheduleDate), formatTime(after.ScheduleDate)}
+	}
+	if before.BusinessDayPolicy != after.BusinessDayPolicy {
+		changes["businessDayPolicy"] = ScheduleChange{before.BusinessDayPolicy, after.BusinessDayPolicy}
+	}
+	if formatEndDate(before.EndDate) != formatEndDate(after.EndDate) {
+		changes["endDate"] = ScheduleChange{formatEndDate(before.EndDate), formatEndDate(after.EndDate)}
+	}
+	return changes
+}
+
+func formatEndDate(end *time.Time) string {
+	if end == nil {
+		return ""
+	}
+	return formatTime(*end)
+}
+
+// recordScheduleEvent appends event to the audit trail of the schedule scheduleID.
+func recordScheduleEvent(db execer, scheduleID string, event ScheduleEvent, stamp string) error {
+	var changes sql.NullString
+	if len(event.Changes) > 0 {
+		b, err := json.Marshal(event.Changes)
+		if err != nil {
+			return err
+		}
+		changes = sql.NullString{String: string(b), Valid: true}
+	}
+	_, err := db.Exec(`
+        INSERT INTO schedule_events (schedule_id, action, actor, from_status, to_status, changes, request_id, created_at)
+        VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, ''), $8)`,
+		scheduleID, event.Action, event.Actor, event.FromStatus, event.ToStatus, changes, event.RequestID, stamp)
+	if err != nil {
+		return fmt.Errorf("unable to record schedule event: %w", err)
+	}
+	return nil
+}
+
+// getScheduleEvents returns the audit trail of the schedule scheduleID, oldest first.
+func (h *Handler) getScheduleEvents(scheduleID string) ([]ScheduleEvent, error) {
+	rows, err := h.db.Query(`
+        SELECT action, actor, COALESCE(from_status, ''), to_status, changes, COALESCE(request_id, ''), created_at
+        FROM schedule_events
+        WHERE schedule_id = $1
+        ORDER BY id ASC`, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get schedule events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []ScheduleEvent{}
+	for rows.Next() {
+		var e ScheduleEvent
+		var changes sql.NullString
+		var createdAt string
+		if err := rows.Scan(&e.Action, &e.Actor, &e.FromStatus, &e.ToStatus, &changes, &e.RequestID, &createdAt); err != nil {
+			return nil, fmt.Errorf("unable to scan schedule event: %w", err)
+		}
+		if changes.Valid {
+			if err := json.Unmarshal([]byte(changes.String), &e.Changes); err != nil {
+				return nil, fmt.Errorf("invalid schedule event changes: %w", err)
+			}
+		}
+		if e.At, err = parseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("invalid created_at: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GetScheduleEvents handler
+func (h *Handler) GetScheduleEvents(c *gin.Context) {
+	accountNo := c.Param("accountNumber")
+	if err := h.accountExists(accountNo); err != nil {
+		abortWithError(c, err, "unable to get schedule events")
+		return
+	}
+	s, err := h.getSchedule(h.db, accountNo, c.Param("scheduleId"))
+	if err != nil {
+		abortWithError(c, err, "unable to get schedule events")
+		return
+	}
+
+	events, err := h.getScheduleEvents(s.ScheduleID)
+	if err != nil {
+		abortWithError(c, err, "unable to get schedule events")
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"demo/calendar"
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupScheduleRouter(t *testing.T, dbName string) (*Handler, *gin.Engine, func()) {
+	db, cleanup, err := setupTestDBScheduler(dbName)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO accounts (account_number, account_name, balance, currency) VALUES ('99999', 'Someone Else', 0, 'USD')`)
+	assert.NoError(t, err)
+	handler := &Handler{db: db}
+	return handler, setupRouter(handler), cleanup
+}
+
+func sendJSON(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decodeSchedule(t *testing.T, w *httptest.ResponseRecorder) Schedule {
+	var s Schedule
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &s))
+	return s
+}
+
+func scheduleEvents(t *testing.T, r *gin.Engine, path string) []ScheduleEvent {
+	var events []ScheduleEvent
+	w := sendJSON(r, http.MethodGet, path+"/events", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	return events
+}
+
+func TestScheduleLifecycle(t *testing.T) {
+	future := formatTime(time.Now().AddDate(1, 0, 0))
+
+	t.Run("PauseAndResume", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_pause_db")
+		defer cleanup()
+		insertSchedule(t, handler.db, "SCH1", "54321", 200, "ONCE", future, "")
+		insertHold(t, handler.db, "HLD1", "12345", 200)
+		_, err := handler.db.Exec(`UPDATE holds SET schedule_id = 'SCH1' WHERE hold_id = 'HLD1'`)
+		assert.NoError(t, err)
+
+		s := decodeSchedule(t, sendJSON(r, http.MethodPost, "/accounts/12345/schedules/SCH1/pause", ""))
+		assert.Equal(t, SchedulePaused, s.Status)
+		// funds are no longer reserved for a paused schedule
+		assert.Equal(t, int64(1000), availableOf(t, handler, "12345"))
+
+		w := sendJSON(r, http.MethodPost, "/accounts/12345/schedules/SCH1/pause", "")
+		assertError(t, w, http.StatusConflict, codeInvalidScheduleStatus, "a paused schedule can not be paused")
+
+		s = decodeSchedule(t, sendJSON(r, http.MethodPost, "/accounts/12345/schedules/SCH1/resume", ""))
+		assert.Equal(t, ScheduleScheduled, s.Status)
+
+		events := scheduleEvents(t, r, "/accounts/12345/schedules/SCH1")
+		if assert.Len(t, events, 2) {
+			assert.Equal(t, SchedulePausedEvent, events[0].Action)
+			assert.Equal(t, "12345", events[0].Actor)
+			assert.Equal(t, ScheduleScheduled, events[0].FromStatus)
+			assert.Equal(t, SchedulePaused, events[0].ToStatus)
+			assert.NotEmpty(t, events[0].RequestID)
+			assert.Equal(t, ScheduleResumedEvent, events[1].Action)
+		}
+	})
+
+	t.Run("PausedScheduleDoesNotRun", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_paused_run_db")
+		defer cleanup()
+		insertSchedule(t, handler.db, "SCH1", "54321", 200, "ONCE", "2025-02-01T09:00:00Z", "")
+
+		decodeSchedule(t, sendJSON(r, http.MethodPost, "/accounts/12345/schedules/SCH1/pause", ""))
+		executed, err := NewScheduler(handler, fixedClock("2025-02-01T09:00:00Z"), time.Minute).RunDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, executed)
+		assert.Equal(t, int64(1000), balanceOf(t, handler.db, "12345"))
+	})
+
+	t.Run("ResumeSkipsMissedMonthlyRuns", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_resume_db")
+		defer cleanup()
+		start := time.Now().AddDate(0, -3, 0).Truncate(time.Second)
+		insertSchedule(t, handler.db, "SCH1", "54321", 200, "MONTHLY", formatTime(start), "")
+		insertSchedule(t, handler.db, "SCH2", "54321", 200, "MONTHLY", formatTime(start), formatTime(start.AddDate(0, 1, 0)))
+		for _, id := range []string{"SCH1", "SCH2"} {
+			decodeSchedule(t, sendJSON(r, http.MethodPost, "/accounts/12345/schedules/"+id+"/pause", ""))
+		}
+
+		s := decodeSchedule(t, sendJSON(r, http.MethodPost, "/accounts/12345/schedules/SCH1/resume", ""))
+		assert.Equal(t, ScheduleScheduled, s.Status)
+		assert.False(t, s.ScheduleDate.Before(time.Now().Add(-time.Second)), s.ScheduleDate)
+
+		// every run left was missed
+		s = decodeSchedule(t, sendJSON(r, http.MethodPost, "/accounts/12345/schedules/SCH2/resume", ""))
+		assert.Equal(t, ScheduleCompleted, s.Status)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_cancel_db")
+		defer cleanup()
+		insertSchedule(t, handler.db, "SCH1", "54321", 200, "MONTHLY", future, "")
+		insertSchedule(t, handler.db, "SCH2", "54321", 300, "MONTHLY", future, "")
+
+		s := decodeSchedule(t, sendJSON(r, http.MethodDelete, "/accounts/12345/schedules/SCH1", ""))
+		assert.Equal(t, ScheduleCancelled, s.Status)
+
+		w := sendJSON(r, http.MethodDelete, "/accounts/12345/schedules/SCH1", "")
+		assertError(t, w, http.StatusConflict, codeInvalidScheduleStatus, "a cancelled schedule can not be cancelled")
+		w = sendJSON(r, http.MethodPost, "/accounts/12345/schedules/SCH1/resume", "")
+		assertError(t, w, http.StatusConflict, codeInvalidScheduleStatus, "a cancelled schedule can not be resumed")
+
+		var schedules []Schedule
+		w = sendJSON(r, http.MethodGet, "/accounts/12345/schedules", "")
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedules))
+		if assert.Len(t, schedules, 1) {
+			assert.Equal(t, "SCH2", schedules[0].ScheduleID)
+		}
+		w = sendJSON(r, http.MethodGet, "/accounts/12345/schedules?status=CANCELLED", "")
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedules))
+		if assert.Len(t, schedules, 1) {
+			assert.Equal(t, "SCH1", schedules[0].ScheduleID)
+		}
+		w = sendJSON(r, http.MethodGet, "/accounts/12345/schedules?status=GONE", "")
+		assertError(t, w, http.StatusBadRequest, codeBadRequest, "invalid status")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_update_db")
+		defer cleanup()
+		insertSchedule(t, handler.db, "SCH1", "54321", 200, "MONTHLY", "2030-01-05T09:00:00Z", "2030-12-31T09:00:00Z")
+
+		s := decodeSchedule(t, sendJSON(r, http.MethodPatch, "/accounts/12345/schedules/SCH1",
+			`{"amount":"3.50","note":"New rent","nextRunDate":"2030-02-01T09:00:00Z","endDate":""}`))
+		assert.Equal(t, money.New(350, "USD"), s.Amount)
+		assert.Equal(t, "New rent", s.Note)
+		assert.Equal(t, "2030-02-01T09:00:00Z", formatTime(s.ScheduleDate))
+		assert.Nil(t, s.EndDate)
+
+		events := scheduleEvents(t, r, "/accounts/12345/schedules/SCH1")
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, ScheduleUpdatedEvent, events[0].Action)
+			assert.Equal(t, map[string]ScheduleChange{
+				"amount":      {map[string]any{"minorUnits": 200.0, "value": "2.00", "currency": "USD"}, map[string]any{"minorUnits": 350.0, "value": "3.50", "currency": "USD"}},
+				"note":        {"Rent", "New rent"},
+				"nextRunDate": {"2030-01-05T09:00:00Z", "2030-02-01T09:00:00Z"},
+				"endDate":     {"2030-12-31T09:00:00Z", ""},
+			}, events[0].Changes)
+		}
+
+		w := sendJSON(r, http.MethodPatch, "/accounts/12345/schedules/SCH1", `{"amount":-1,"endDate":"2029-01-01 09:00:00"}`)
+		resp := assertError(t, w, http.StatusUnprocessableEntity, codeValidationFailed, "invalid request")
+		assert.Equal(t, []FieldError{{"amount", fieldNotPositive, "amount must be positive"}}, resp.Fields)
+		w = sendJSON(r, http.MethodPatch, "/accounts/12345/schedules/SCH1", `{"endDate":"2029-01-01 09:00:00"}`)
+		resp = assertError(t, w, http.StatusUnprocessableEntity, codeValidationFailed, "invalid request")
+		assert.Equal(t, []FieldError{{"endDate", fieldEndBeforeStart, "endDate is before the next run date"}}, resp.Fields)
+		w = sendJSON(r, http.MethodPatch, "/accounts/12345/schedules/SCH1", `{}`)
+		assertError(t, w, http.StatusBadRequest, codeBadRequest, "nothing to update")
+
+		_, err := handler.db.Exec(`UPDATE schedules SET status = 'COMPLETED'`)
+		assert.NoError(t, err)
+		w = sendJSON(r, http.MethodPatch, "/accounts/12345/schedules/SCH1", `{"note":"Late"}`)
+		assertError(t, w, http.StatusConflict, codeInvalidScheduleStatus, "a completed schedule can not be changed")
+	})
+
+	t.Run("OnlyTheSenderCanChangeIt", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_owner_db")
+		defer cleanup()
+		insertSchedule(t, handler.db, "SCH1", "54321", 200, "ONCE", future, "")
+
+		for _, req := range []struct{ method, path, body string }{
+			{http.MethodGet, "/accounts/99999/schedules/SCH1", ""},
+			{http.MethodPatch, "/accounts/99999/schedules/SCH1", `{"note":"Mine"}`},
+			{http.MethodDelete, "/accounts/99999/schedules/SCH1", ""},
+			{http.MethodPost, "/accounts/99999/schedules/SCH1/pause", ""},
+			{http.MethodPost, "/accounts/99999/schedules/SCH1/resume", ""},
+			{http.MethodGet, "/accounts/99999/schedules/SCH1/events", ""},
+			{http.MethodDelete, "/accounts/12345/schedules/SCH0", ""},
+		} {
+			w := sendJSON(r, req.method, req.path, req.body)
+			assertError(t, w, http.StatusNotFound, codeScheduleNotFound, "schedule not found")
+		}
+		w := sendJSON(r, http.MethodDelete, "/accounts/00000/schedules/SCH1", "")
+		assertError(t, w, http.StatusNotFound, codeAccountNotFound, "account not found")
+
+		s := decodeSchedule(t, sendJSON(r, http.MethodGet, "/accounts/12345/schedules/SCH1", ""))
+		assert.Equal(t, ScheduleScheduled, s.Status)
+		assert.Equal(t, "Rent", s.Note)
+	})
+
+	t.Run("CreatedAndCompletedAreAudited", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_audit_db")
+		defer cleanup()
+		withRemoteConfig(t, map[string]string{"enable_schedule_once": "true"})
+
+		var created ScheduleResponse
+		w := postWithKey(r, "/accounts/12345/schedules", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD","schedule":"ONCE","startDate":"2025-02-01T09:00:00Z"}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+		_, err := NewScheduler(handler, fixedClock("2025-02-01T09:00:00Z"), time.Minute).RunDue()
+		assert.NoError(t, err)
+
+		events := scheduleEvents(t, r, "/accounts/12345/schedules/"+created.ScheduleID)
+		if assert.Len(t, events, 2) {
+			assert.Equal(t, ScheduleCreatedEvent, events[0].Action)
+			assert.Equal(t, "12345", events[0].Actor)
+			assert.Equal(t, ScheduleCompletedEvent, events[1].Action)
+			assert.Equal(t, schedulerActor, events[1].Actor)
+			assert.Equal(t, ScheduleCompleted, events[1].ToStatus)
+		}
+	})
+}
+
+func TestScheduleRecurrence(t *testing.T) {
+	create := func(t *testing.T, r *gin.Engine, fields string) ScheduleResponse {
+		var created ScheduleResponse
+		w := postWithKey(r, "/accounts/12345/schedules", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD",`+fields+`}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created
+	}
+	occurrences := func(t *testing.T, r *gin.Engine, path string) []string {
+		var resp ScheduleOccurrences
+		w := sendJSON(r, http.MethodGet, path, "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		dates := make([]string, len(resp.Occurrences))
+		for i, o := range resp.Occurrences {
+			dates[i] = o.Date.Format("Mon 2006-01-02")
+		}
+		return dates
+	}
+
+	t.Run("Weekly", func(t *testing.T) {
+		_, r, cleanup := setupScheduleRouter(t, "schedule_weekly_db")
+		defer cleanup()
+		withRemoteConfig(t, map[string]string{"enable_schedule_monthly": "true"})
+
+		// starts on a Wednesday, so the first run is the Friday after
+		created := create(t, r, `"schedule":"WEEKLY","weekdays":["MO","FR"],"count":3,"startDate":"2030-01-30 09:00:00"`)
+		assert.Equal(t, "2030-02-01T02:00:00Z", created.NextRunDate)
+		assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,FR;COUNT=3", created.RRule)
+
+		path := "/accounts/12345/schedules/" + created.ScheduleID + "/occurrences"
+		assert.Equal(t, []string{"Fri 2030-02-01", "Mon 2030-02-04", "Fri 2030-02-08"}, occurrences(t, r, path))
+		assert.Equal(t, []string{"Fri 2030-02-01", "Mon 2030-02-04"}, occurrences(t, r, path+"?n=2"))
+	})
+
+	t.Run("MonthlyOnLastBusinessDay", func(t *testing.T) {
+		_, r, cleanup := setupScheduleRouter(t, "schedule_last_business_day_db")
+		defer cleanup()
+		withRemoteConfig(t, map[string]string{"enable_schedule_monthly": "true"})
+
+		created := create(t, r, `"schedule":"MONTHLY","lastBusinessDay":true,"startDate":"2030-03-01 09:00:00","endDate":"2030-06-30 09:00:00"`)
+		assert.Equal(t, "2030-03-29T02:00:00Z", created.NextRunDate)
+
+		path := "/accounts/12345/schedules/" + created.ScheduleID + "/occurrences"
+		assert.Equal(t, []string{"Fri 2030-03-29", "Tue 2030-04-30", "Fri 2030-05-31", "Fri 2030-06-28"}, occurrences(t, r, path))
+	})
+
+	t.Run("RRuleRunsByItsRule", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_rrule_db")
+		defer cleanup()
+		withRemoteConfig(t, map[string]string{"enable_schedule_monthly": "true"})
+
+		created := create(t, r, `"schedule":"RRULE","rrule":"FREQ=DAILY;INTERVAL=2;COUNT=2","startDate":"2025-02-01 09:00:00"`)
+
+		sched := NewScheduler(handler, fixedClock("2025-02-01T02:00:00Z"), time.Minute)
+		_, err := sched.RunDue()
+		assert.NoError(t, err)
+		s := decodeSchedule(t, sendJSON(r, http.MethodGet, "/accounts/12345/schedules/"+created.ScheduleID, ""))
+		assert.Equal(t, ScheduleScheduled, s.Status)
+		assert.Equal(t, "2025-02-03T02:00:00Z", formatTime(s.ScheduleDate))
+
+		sched.now = fixedClock("2025-02-03T02:00:00Z")
+		_, err = sched.RunDue()
+		assert.NoError(t, err)
+		s = decodeSchedule(t, sendJSON(r, http.MethodGet, "/accounts/12345/schedules/"+created.ScheduleID, ""))
+		assert.Equal(t, ScheduleCompleted, s.Status)
+		assert.Empty(t, occurrences(t, r, "/accounts/12345/schedules/"+created.ScheduleID+"/occurrences"))
+	})
+
+	t.Run("OnlyMonthlyNeedsTheMonthlySwitch", func(t *testing.T) {
+		_, r, cleanup := setupScheduleRouter(t, "schedule_recurring_disabled_db")
+		defer cleanup()
+		withRemoteConfig(t, map[string]string{"enable_schedule_monthly": "false"})
+
+		w := postWithKey(r, "/accounts/12345/schedules", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD","schedule":"RRULE","rrule":"FREQ=MONTHLY","startDate":"2030-01-30 09:00:00"}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = postWithKey(r, "/accounts/12345/schedules", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD","schedule":"MONTHLY","startDate":"2030-01-30 09:00:00"}`)
+		assertError(t, w, http.StatusForbidden, codeScheduleMonthlyDisabled, "monthly schedules are disabled")
+	})
+
+	t.Run("OccurrencesOfAOnceSchedule", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_occurrences_db")
+		defer cleanup()
+		insertSchedule(t, handler.db, "SCH1", "54321", 200, "ONCE", "2030-01-30T09:00:00Z", "")
+
+		assert.Equal(t, []string{"Wed 2030-01-30"}, occurrences(t, r, "/accounts/12345/schedules/SCH1/occurrences"))
+
+		w := sendJSON(r, http.MethodGet, "/accounts/12345/schedules/SCH1/occurrences?n=101", "")
+		assertError(t, w, http.StatusBadRequest, codeBadRequest, "n must be between 1 and 100")
+		w = sendJSON(r, http.MethodGet, "/accounts/99999/schedules/SCH1/occurrences", "")
+		assertError(t, w, http.StatusNotFound, codeScheduleNotFound, "schedule not found")
+	})
+}
+
+func TestScheduleBusinessDays(t *testing.T) {
+	holidays := calendar.New([]calendar.Holiday{
+		{Date: time.Date(2025, 4, 14, 0, 0, 0, 0, time.UTC), Name: "Songkran Festival"},
+		{Date: time.Date(2025, 4, 15, 0, 0, 0, 0, time.UTC), Name: "Songkran Festival"},
+		{Date: time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC), Name: "New Year's Eve"},
+		{Date: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Name: "New Year's Day"},
+	})
+	create := func(t *testing.T, r *gin.Engine, fields string) ScheduleResponse {
+		var created ScheduleResponse
+		w := postWithKey(r, "/accounts/12345/schedules", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD",`+fields+`}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created
+	}
+
+	t.Run("PreviewAroundSongkran", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_songkran_db")
+		defer cleanup()
+		handler.calendar = holidays
+		withRemoteConfig(t, map[string]string{"enable_schedule_monthly": "true"})
+
+		created := create(t, r, `"schedule":"MONTHLY","businessDayPolicy":"NEXT","startDate":"2025-03-14 09:00:00"`)
+		assert.Equal(t, "NEXT", created.BusinessDayPolicy)
+
+		var resp ScheduleOccurrences
+		w := sendJSON(r, http.MethodGet, "/accounts/12345/schedules/"+created.ScheduleID+"/occurrences?n=3", "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		if assert.Len(t, resp.Occurrences, 3) {
+			assert.Nil(t, resp.Occurrences[0].OriginalDate)
+			songkran := resp.Occurrences[1]
+			assert.Equal(t, "2025-04-16T02:00:00Z", formatTime(songkran.Date))
+			if assert.NotNil(t, songkran.OriginalDate) {
+				assert.Equal(t, "2025-04-14T02:00:00Z", formatTime(*songkran.OriginalDate))
+			}
+			assert.Equal(t, "Songkran Festival", songkran.Holiday)
+			assert.Equal(t, "2025-05-14T02:00:00Z", formatTime(resp.Occurrences[2].Date))
+		}
+	})
+
+	t.Run("ExecutorRunsOnThePreviousBusinessDay", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_year_end_db")
+		defer cleanup()
+		handler.calendar = holidays
+		withRemoteConfig(t, map[string]string{"enable_schedule_monthly": "true"})
+
+		// the 31st falls on a Sunday in November, a holiday in December and a Saturday in January
+		created := create(t, r, `"schedule":"MONTHLY","dayOfMonth":31,"businessDayPolicy":"PREVIOUS","startDate":"2025-11-01 09:00:00"`)
+		assert.Equal(t, "2025-11-28T02:00:00Z", created.NextRunDate)
+		path := "/accounts/12345/schedules/" + created.ScheduleID
+
+		sched := NewScheduler(handler, nil, time.Minute)
+		for _, want := range []string{"2025-12-30T02:00:00Z", "2026-01-30T02:00:00Z"} {
+			s := decodeSchedule(t, sendJSON(r, http.MethodGet, path, ""))
+			sched.now = fixedClock(formatTime(s.ScheduleDate))
+			_, err := sched.RunDue()
+			assert.NoError(t, err)
+
+			s = decodeSchedule(t, sendJSON(r, http.MethodGet, path, ""))
+			assert.Equal(t, ScheduleScheduled, s.Status)
+			assert.Equal(t, want, formatTime(s.ScheduleDate))
+		}
+		s := decodeSchedule(t, sendJSON(r, http.MethodGet, path, ""))
+		assert.Equal(t, "2026-01-31T02:00:00Z", formatTime(s.OccurrenceDate))
+	})
+
+	t.Run("ChangePolicy", func(t *testing.T) {
+		handler, r, cleanup := setupScheduleRouter(t, "schedule_policy_db")
+		defer cleanup()
+		handler.calendar = holidays
+		withRemoteConfig(t, map[string]string{"enable_schedule_once": "true"})
+
+		created := create(t, r, `"schedule":"ONCE","startDate":"2025-12-31 09:00:00"`)
+		assert.Equal(t, "NONE", created.BusinessDayPolicy)
+		assert.Equal(t, "2025-12-31T02:00:00Z", created.NextRunDate)
+		path := "/accounts/12345/schedules/" + created.ScheduleID
+
+		s := decodeSchedule(t, sendJSON(r, http.MethodPatch, path, `{"businessDayPolicy":"NEXT"}`))
+		assert.Equal(t, "2026-01-02T02:00:00Z", formatTime(s.ScheduleDate))
+		assert.Equal(t, "2025-12-31T02:00:00Z", formatTime(s.OccurrenceDate))
+
+		events := scheduleEvents(t, r, path)
+		if assert.Len(t, events, 2) {
+			assert.Equal(t, ScheduleChange{"NONE", "NEXT"}, events[1].Changes["businessDayPolicy"])
+			assert.Equal(t, ScheduleChange{"2025-12-31T02:00:00Z", "2026-01-02T02:00:00Z"}, events[1].Changes["nextRunDate"])
+		}
+
+		w := sendJSON(r, http.MethodPatch, path, `{"businessDayPolicy":"LATER"}`)
+		body := assertError(t, w, http.StatusUnprocessableEntity, codeValidationFailed, "invalid request")
+		if assert.Len(t, body.Fields, 1) {
+			assert.Equal(t, fieldInvalidPolicy, body.Fields[0].Code)
+		}
+	})
+}
+
+func TestScheduleStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{ScheduleScheduled, SchedulePaused, true},
+		{ScheduleScheduled, ScheduleCancelled, true},
+		{SchedulePaused, ScheduleScheduled, true},
+		{SchedulePaused, ScheduleCancelled, true},
+		{SchedulePaused, ScheduleFailed, false},
+		{ScheduleCancelled, ScheduleScheduled, false},
+		{ScheduleCompleted, SchedulePaused, false},
+		{ScheduleFailed, ScheduleCancelled, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, canMoveSchedule(tt.from, tt.to), tt.from+" to "+tt.to)
+	}
+}
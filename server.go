@@ -1,116 +1,172 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"demo/calendar"
 	"demo/config"
 	"demo/firebase"
+	"demo/fx"
+	"demo/idgen"
+	"demo/money"
+	"demo/statement"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 type Account struct {
-	Branch           string `json:"branch"`
-	AccountNumber    string `json:"number"`
-	AccountType      string `json:"type"`
-	AccountName      string `json:"name"`
-	Balance          int64  `json:"currentBalance"`
-	AvailableBalance int64  `json:"availableBalance"`
-	Currency         string `json:"currency"`
+	Branch           string      `json:"branch"`
+	AccountNumber    string      `json:"number"`
+	AccountType      string      `json:"type"`
+	AccountName      string      `json:"name"`
+	Balance          money.Money `json:"currentBalance"`
+	AvailableBalance money.Money `json:"availableBalance"`
+	Currency         string      `json:"currency"`
 }
 
 type Transaction struct {
-	TransactionID string    `json:"transactionId"`
-	AccountNumber string    `json:"accountNumber"`
-	FromAccount   string    `json:"fromAccount"`
-	ToAccount     string    `json:"toAccount"`
-	ToAccountName string    `json:"toAccountName"`
-	ToBank        string    `json:"toBank"`
-	Type          string    `json:"type"`
-	Amount        int64     `json:"amount"`
-	Currency      string    `json:"currency"`
-	Note          string    `json:"note"`
-	TransferredAt time.Time `json:"transferredAt"`
-}
-
-type Schedule struct {
-	ScheduleID    string    `json:"scheduleId"`
-	FromAccount   string    `json:"fromAccount"`
-	ToAccount     string    `json:"toAccount"`
-	ToAccountName string    `json:"toAccountName"`
-	ToBank        string    `json:"toBank"`
-	Amount        int64     `json:"amount"`
-	Note          string    `json:"note"`
-	ScheduleDate  time.Time `json:"date"`
+	TransactionID         string       `json:"transactionId"`
+	AccountNumber         string       `json:"accountNumber"`
+	FromAccount           string       `json:"fromAccount"`
+	ToAccount             string       `json:"toAccount"`
+	ToAccountName         string       `json:"toAccountName"`
+	ToBank                string       `json:"toBank"`
+	Type                  string       `json:"type"`
+	Amount                money.Money  `json:"amount"`
+	Note                  string       `json:"note"`
+	TransferredAt         time.Time    `json:"transferredAt"`
+	OriginalTransactionID string       `json:"originalTransactionId,omitempty"`
+	ExchangeRate          string       `json:"exchangeRate,omitempty"`
+	Converted             *money.Money `json:"converted,omitempty"`
 }
 
 // Request & Response Structs
+
+// TransferRequest carries the amount as minor units, a decimal string or a Money object.
+// Currency may be left out when the amount is a Money object. Fields are checked by
+// validateTransfer rather than binding tags, so every field at fault is reported at once.
 type TransferRequest struct {
-	FromAccount string `json:"fromAccount" binding:"required"`
-	ToAccount   string `json:"toAccount" binding:"required"`
-	ToBank      string `json:"toBank" binding:"required"`
-	Amount      int64  `json:"amount" binding:"required"`
-	Currency    string `json:"currency" binding:"required"`
-	Note        string `json:"note"`
+	FromAccount string      `json:"fromAccount"`
+	ToAccount   string      `json:"toAccount"`
+	ToBank      string      `json:"toBank"`
+	Amount      money.Input `json:"amount"`
+	Currency    string      `json:"currency"`
+	Note        string      `json:"note"`
 }
 
 type TransferResponse struct {
-	TransactionID string `json:"transactionId"`
-	Status        string `json:"status"`
-	TransferredAt string `json:"transferredAt"`
+	TransactionID string       `json:"transactionId"`
+	Status        string       `json:"status"`
+	TransferredAt string       `json:"transferredAt"`
+	ExchangeRate  string       `json:"exchangeRate,omitempty"`
+	Converted     *money.Money `json:"converted,omitempty"`
 }
 
+// ScheduleRequest schedules a transfer ONCE on StartDate, or repeatedly from StartDate on.
+// DAILY and WEEKLY repeat every Interval days or weeks, WEEKLY on the RFC 5545 Weekdays
+// given (MO to SU) or the weekday of StartDate. MONTHLY repeats on DayOfMonth, -1 being the
+// last day, or the day of StartDate; a day a month does not have falls on its last day.
+// With LastBusinessDay it repeats on the last weekday of the month instead. RRULE takes the
+// rule from RRule. Count caps the number of runs of any of them.
+//
+// A run that falls on a weekend or bank holiday moves by BusinessDayPolicy: to the
+// PREVIOUS or NEXT business day, or NONE to keep it. LastBusinessDay schedules default to
+// PREVIOUS, the others to NONE.
 type ScheduleRequest struct {
-	FromAccount string `json:"fromAccount" binding:"required"`
-	ToAccount   string `json:"toAccount" binding:"required"`
-	ToBank      string `json:"toBank" binding:"required"`
-	Amount      int64  `json:"amount" binding:"required"`
-	Currency    string `json:"currency" binding:"required"`
-	Note        string `json:"note"`
-	Schedule    string `json:"schedule" binding:"required"` // "ONCE" or "MONTHLY"
-	StartDate   string `json:"startDate" binding:"required"`
-	EndDate     string `json:"endDate"`
+	FromAccount       string      `json:"fromAccount"`
+	ToAccount         string      `json:"toAccount"`
+	ToBank            string      `json:"toBank"`
+	Amount            money.Input `json:"amount"`
+	Currency          string      `json:"currency"`
+	Note              string      `json:"note"`
+	Schedule          string      `json:"schedule"` // "ONCE", "DAILY", "WEEKLY", "MONTHLY" or "RRULE"
+	StartDate         string      `json:"startDate"`
+	EndDate           string      `json:"endDate"`
+	Interval          int         `json:"interval"`
+	Weekdays          []string    `json:"weekdays"`
+	DayOfMonth        int         `json:"dayOfMonth"`
+	LastBusinessDay   bool        `json:"lastBusinessDay"`
+	Count             int         `json:"count"`
+	RRule             string      `json:"rrule"`
+	BusinessDayPolicy string      `json:"businessDayPolicy"`
 }
 
 type ScheduleResponse struct {
-	ScheduleID   string `json:"scheduleId"`
-	Status       string `json:"status"`
-	NextRunDate  string `json:"nextRunDate"`
-	EndDate      string `json:"endDate"`
-	ScheduleType string `json:"scheduleType"`
+	ScheduleID        string `json:"scheduleId"`
+	Status            string `json:"status"`
+	NextRunDate       string `json:"nextRunDate"`
+	EndDate           string `json:"endDate"`
+	ScheduleType      string `json:"scheduleType"`
+	RRule             string `json:"rrule,omitempty"`
+	BusinessDayPolicy string `json:"businessDayPolicy"`
 }
 
 type Handler struct {
 	db *sql.DB
-}
 
-// Utility function to handle errors consistently
-func handleError(c *gin.Context, err error, msg string) {
-	if err != nil {
-		log.Printf("Error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
-	}
+	// idempotencyTTL is how long a stored Idempotency-Key response is replayed, defaults to 24h
+	idempotencyTTL time.Duration
+
+	// newID generates transaction and schedule IDs, defaults to idgen.New
+	newID func(prefix string) string
+
+	// statementPDF renders PDF statements, without it Thai names can not be drawn
+	statementPDF *statement.PDF
+
+	// rates converts transfers to accounts in another currency, without it only transfers
+	// within one currency can be made
+	rates *fx.Table
+
+	// calendar holds the bank holidays schedules move off, without it only weekends are
+	// closed
+	calendar *calendar.Calendar
+
+	// tz is the business timezone, defaults to Asia/Bangkok
+	tz *time.Location
 }
 
-// Query for account details
+// getAccount loads an account, failing with errAccountNotFound when there is none.
 func (h *Handler) getAccount(accountNo string) (*Account, error) {
 	var account Account
 	err := h.db.QueryRow(`
-		SELECT branch, account_number, type, account_name, balance, available_balance, currency
-		FROM accounts
-		WHERE account_number = ?`, accountNo).Scan(
+		SELECT a.branch, a.account_number, a.type, a.account_name, a.balance, `+availableBalanceSQL+`, a.currency
+		FROM accounts a
+		WHERE a.account_number = ?`, accountNo).Scan(
 		&account.Branch, &account.AccountNumber, &account.AccountType, &account.AccountName,
-		&account.Balance, &account.AvailableBalance, &account.Currency,
+		&account.Balance.Minor, &account.AvailableBalance.Minor, &account.Currency,
 	)
-	return &account, err
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errAccountNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get account: %w", err)
+	}
+	account.Balance.Currency, account.AvailableBalance.Currency = account.Currency, account.Currency
+	return &account, nil
+}
+
+// accountExists fails with errAccountNotFound unless there is an account accountNo.
+func (h *Handler) accountExists(accountNo string) error {
+	var exists bool
+	err := h.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM accounts WHERE account_number = $1)`, accountNo).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("unable to get account: %w", err)
+	}
+	if !exists {
+		return errAccountNotFound
+	}
+	return nil
 }
 
 // GetBalance handler
@@ -118,98 +174,54 @@ func (h *Handler) GetBalance(c *gin.Context) {
 	accountNo := c.Param("accountNumber")
 	account, err := h.getAccount(accountNo)
 	if err != nil {
-		handleError(c, err, "unable to get account balance")
+		abortWithError(c, err, "unable to get account balance")
 		return
 	}
 
 	c.JSON(http.StatusOK, account)
 }
 
-// Query for all transactions
-func (h *Handler) getAllTransactions() ([]Transaction, error) {
-	rows, err := h.db.Query(`
-		SELECT transaction_id, account_number, from_account, to_account, to_account_name, to_bank,
-			type, amount, currency, note, transferred_at
-		FROM transactions ORDER BY transferred_at DESC
-	`)
+// GetAllTransactions handler
+func (h *Handler) GetAllTransactions(c *gin.Context) {
+	filter, err := parseTransactionFilter(c, h.timezone())
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var transactions []Transaction
-	for rows.Next() {
-		var txn Transaction
-		var transferredAt string
-		err := rows.Scan(&txn.TransactionID, &txn.AccountNumber, &txn.FromAccount,
-			&txn.ToAccount, &txn.ToAccountName, &txn.ToBank, &txn.Type, &txn.Amount,
-			&txn.Currency, &txn.Note, &transferredAt)
-		if err != nil {
-			return nil, err
-		}
-		at, err := time.Parse("2006-01-02 15:04:05", transferredAt)
-		if err != nil {
-			return nil, err
-		}
-		txn.TransferredAt = at
-		transactions = append(transactions, txn)
+		abortWithError(c, err, "")
+		return
 	}
-	return transactions, nil
-}
 
-// GetAllTransactions handler
-func (h *Handler) GetAllTransactions(c *gin.Context) {
-	transactions, err := h.getAllTransactions()
+	page, err := h.listTransactions(filter)
 	if err != nil {
-		handleError(c, err, "unable to get transactions")
+		abortWithError(c, err, "unable to get transactions")
 		return
 	}
 
-	c.JSON(http.StatusOK, transactions)
+	c.JSON(http.StatusOK, page)
 }
 
 func (h *Handler) GetTransactions(c *gin.Context) {
-	accountNo := c.Param("accountNumber")
-	transactions, err := h.fetchTransactions(accountNo)
+	filter, err := parseTransactionFilter(c, h.timezone())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortWithError(c, err, "")
+		return
+	}
+	filter.AccountNumber = c.Param("accountNumber")
+	if err := h.accountExists(filter.AccountNumber); err != nil {
+		abortWithError(c, err, "unable to get transactions")
 		return
 	}
 
-	c.JSON(http.StatusOK, transactions)
-}
-
-// fetchTransactions fetches the transactions from the database and parses the transferred_at time
-func (h *Handler) fetchTransactions(accountNo string) ([]Transaction, error) {
-	rows, err := h.db.Query(`
-        SELECT transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at
-        FROM transactions
-        WHERE account_number = $1
-        ORDER BY transferred_at DESC
-    `, accountNo)
+	page, err := h.listTransactions(filter)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get transactions: %w", err)
+		abortWithError(c, err, "unable to get transactions")
+		return
 	}
-	defer rows.Close()
 
-	transactions := []Transaction{}
-	for rows.Next() {
-		var txn Transaction
-		var transferredAt string
-		if err := rows.Scan(&txn.TransactionID, &txn.AccountNumber, &txn.FromAccount, &txn.ToAccount, &txn.ToAccountName, &txn.ToBank, &txn.Type, &txn.Amount, &txn.Currency, &txn.Note, &transferredAt); err != nil {
-			return nil, fmt.Errorf("unable to scan transaction: %w", err)
-		}
-		if err := parseTransferredAt(&txn, transferredAt); err != nil {
-			return nil, fmt.Errorf("unable to parse transferred_at: %w", err)
-		}
-		transactions = append(transactions, txn)
-	}
-	return transactions, nil
+	c.JSON(http.StatusOK, page)
 }
 
 // parseTransferredAt parses the transferred_at time and sets it on the transaction
 func parseTransferredAt(txn *Transaction, transferredAt string) error {
-	at, err := time.Parse("2006-01-02 15:04:05", transferredAt)
+	at, err := parseTime(transferredAt)
 	if err != nil {
 		return fmt.Errorf("invalid time format: %w", err)
 	}
@@ -217,71 +229,6 @@ func parseTransferredAt(txn *Transaction, transferredAt string) error {
 	return nil
 }
 
-func (h *Handler) GetSchedules(c *gin.Context) {
-	accountNo := c.Param("accountNumber")
-	// query only  status = 'SCHEDULED'
-	rows, err := h.db.Query(`
-        SELECT schedule_id, from_account, to_account, to_account_name, to_bank, amount, note, schedule_date
-        FROM schedules
-        WHERE from_account = $1
-        AND status = 'SCHEDULED'
-        ORDER BY schedule_date ASC
-        `, accountNo)
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to get schedules"})
-		return
-	}
-	defer rows.Close()
-
-	schedules := []Schedule{}
-	// TODO: Implement the logic to fetch schedules from the database
-	for rows.Next() {
-		var sch Schedule
-		var scheduleDate string
-		if err := rows.Scan(&sch.ScheduleID, &sch.FromAccount, &sch.ToAccount, &sch.ToAccountName, &sch.ToBank, &sch.Amount, &sch.Note, &scheduleDate); err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to get schedules"})
-			return
-		}
-
-		layout := "2006-01-02 15:04:05" // Example format (adjust to match your actual date format)
-		parsedDate, err := time.Parse(layout, scheduleDate)
-		if err != nil {
-			log.Printf("Failed to parse date %s: %v", scheduleDate, err)
-			continue
-		}
-		sch.ScheduleDate = parsedDate
-		schedules = append(schedules, sch)
-	}
-
-	c.JSON(http.StatusOK, schedules)
-}
-
-// Utility function to handle errors consistently
-func handleScheduleError(c *gin.Context, err error, msg string) {
-	if err != nil {
-		log.Printf("Error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
-	}
-}
-
-// Helper function to validate schedule dates
-func validateScheduleDates(startDate, endDate string) error {
-	format := "2006-01-02 15:04:05"
-	if _, err := time.Parse(format, startDate); err != nil {
-		return fmt.Errorf("invalid start date")
-	}
-
-	if endDate != "" {
-		if _, err := time.Parse(format, endDate); err != nil {
-			return fmt.Errorf("invalid end date")
-		}
-	}
-
-	return nil
-}
-
 // Helper function to get account name by account number
 func (h *Handler) getAccountName(accountNo string) (string, error) {
 	var accountName string
@@ -297,180 +244,391 @@ func (h *Handler) CreateSchedules(c *gin.Context) {
 	fromAccount := c.Param("accountNumber")
 	var req ScheduleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		handleScheduleError(c, err, "invalid request body")
+		abortWithError(c, badRequest("invalid request body"), "")
 		return
 	}
 
-	// schedule type must be "ONCE" or "MONTHLY" only if not return error
-	if req.Schedule != "ONCE" && req.Schedule != "MONTHLY" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule type"})
+	loc := h.timezone()
+	amount, rule, err := validateSchedule(fromAccount, req, loc)
+	if err != nil {
+		abortWithError(c, err, "")
+		return
+	}
+	// The first run is the first time on or after the start date the rule matches in the
+	// business timezone, moved to a business day by the policy
+	start, _ := parseClientTime(req.StartDate, loc)
+	first := start.In(loc)
+	var rrule string
+	if rule != nil {
+		first, _ = rule.First(first)
+		rrule = rule.String()
+	}
+	var endDate string
+	if req.EndDate != "" {
+		end, _ := parseClientTime(req.EndDate, loc)
+		endDate = formatTime(end)
+	}
+	policy := calendar.Policy(req.BusinessDayPolicy)
+	if policy == "" {
+		policy = calendar.None
+		if req.LastBusinessDay {
+			policy = calendar.Previous
+		}
+	}
+	nextRun := formatTime(h.calendar.Adjust(first, policy))
+
+	// Get sender account, remote config conditions are evaluated against it
+	account, err := h.getAccount(fromAccount)
+	if err != nil {
+		abortWithError(c, err, "unable to get account")
+		return
+	}
+	if amount.Currency != account.Currency {
+		abortWithError(c, errCurrencyMismatch, "")
+		return
+	}
+	if err := checkTransferLimit(amount, account); err != nil {
+		abortWithError(c, err, "unable to schedule transfer")
 		return
 	}
 
-	// Validate schedule dates
-	if err := validateScheduleDates(req.StartDate, req.EndDate); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// One-time and monthly schedules can be switched off in remote config
+	ft := firebase.FeaturesFor(firebase.AllConfigs(), featureContext(account))
+	if req.Schedule == "ONCE" && !ft.EnableScheduleOnce {
+		abortWithError(c, errScheduleOnceDisabled, "")
+		return
+	}
+	if req.Schedule == "MONTHLY" && !ft.EnableScheduleMonthly {
+		abortWithError(c, errScheduleMonthlyDisabled, "")
 		return
 	}
 
 	// Get recipient account name
 	toAccountName, err := h.getAccountName(req.ToAccount)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errRecipientNotFound
+	}
 	if err != nil {
-		handleScheduleError(c, err, "unable to retrieve recipient account name")
+		abortWithError(c, err, "unable to retrieve recipient account name")
 		return
 	}
 
-	// Create schedule entry in the database
-	schID := scheduleID()
-	status := "SCHEDULED"
-	_, err = h.db.Exec(`
-		   INSERT INTO schedules (schedule_id, from_account, to_account, to_account_name, to_bank, amount, currency, note, status, schedule, schedule_date, end_date)
-		   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`,
-		schID, fromAccount, req.ToAccount, toAccountName, req.ToBank, req.Amount, req.Currency, req.Note, status, req.Schedule, req.StartDate, req.EndDate)
+	tx, err := h.db.Begin()
 	if err != nil {
-		handleScheduleError(c, err, "unable to schedule transfer")
+		abortWithError(c, err, "unable to schedule transfer")
+		return
+	}
+	defer tx.Rollback()
+
+	// Create schedule entry in the database, with a fresh ID should the generated one be taken
+	var schID string
+	status := ScheduleScheduled
+	for attempt := 1; attempt <= maxIDAttempts; attempt++ {
+		schID = h.scheduleID()
+		_, err = tx.Exec(`
+		   INSERT INTO schedules (schedule_id, from_account, to_account, to_account_name, to_bank, amount, currency, note, status, schedule, schedule_date, end_date,
+		       start_date, rrule, occurrence_date, business_day_policy)
+		   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), $15, $16);`,
+			schID, fromAccount, req.ToAccount, toAccountName, bankCode(req.ToBank), amount.Minor, amount.Currency, req.Note, status, req.Schedule, nextRun, endDate,
+			formatTime(start), rrule, formatTime(first), policy)
+		if !isUniqueViolation(err) {
+			break
+		}
+	}
+	if err != nil {
+		abortWithError(c, err, "unable to schedule transfer")
+		return
+	}
+	event := ScheduleEvent{Action: ScheduleCreatedEvent, Actor: fromAccount, ToStatus: status, RequestID: requestID(c)}
+	if err := recordScheduleEvent(tx, schID, event, formatTime(time.Now())); err != nil {
+		abortWithError(c, err, "unable to schedule transfer")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		abortWithError(c, err, "unable to schedule transfer")
 		return
 	}
+
 	// Send the response with schedule details
 	resp := ScheduleResponse{
-		ScheduleID:   schID,
-		Status:       status,
-		NextRunDate:  req.StartDate,
-		EndDate:      req.EndDate,
-		ScheduleType: req.Schedule,
+		ScheduleID:        schID,
+		Status:            status,
+		NextRunDate:       nextRun,
+		EndDate:           endDate,
+		ScheduleType:      req.Schedule,
+		RRule:             rrule,
+		BusinessDayPolicy: string(policy),
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
-func transactionID() string {
-	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return fmt.Sprintf("TXN%v", rd.Intn(1000000000))
+// maxIDAttempts is how many generated IDs are tried before giving up on a unique violation.
+const maxIDAttempts = 3
+
+func (h *Handler) nextID(prefix string) string {
+	if h.newID != nil {
+		return h.newID(prefix)
+	}
+	return idgen.New(prefix)
 }
 
-// Utility function to handle errors consistently
-func handleTransferError(c *gin.Context, err error, msg string) {
-	if err != nil {
-		log.Printf("Error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+func (h *Handler) transactionID() string {
+	return h.nextID("TXN")
+}
+
+func (h *Handler) scheduleID() string {
+	return h.nextID("SCH")
+}
+
+// isUniqueViolation reports whether err is a primary key or unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
 	}
+	return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
 }
 
-// Helper function to validate account balance
-func (h *Handler) validateAccountBalance(accountNo string, amount int64) (int64, error) {
-	var balance int64
-	err := h.db.QueryRow(`
-        SELECT balance
-        FROM accounts
-        WHERE account_number = $1`, accountNo).Scan(&balance)
-	return balance, err
+// featureContext is what remote config conditions are evaluated against for account.
+func featureContext(account *Account) firebase.Context {
+	return firebase.Context{
+		AccountNumber: account.AccountNumber,
+		AccountType:   account.AccountType,
+		Branch:        account.Branch,
+	}
+}
+
+// checkTransferLimit fails with errLimitExceeded when amount is above the limit of a single
+// transfer from account, evaluated against the live remote config snapshot. A limit that
+// does not parse refuses the transfer rather than lifting the limit.
+func checkTransferLimit(amount money.Money, account *Account) error {
+	ft := firebase.FeaturesFor(firebase.AllConfigs(), featureContext(account))
+	limit, err := firebase.ParseTransferLimit(ft.TransferLimit)
+	if err != nil {
+		return fmt.Errorf("unable to check transfer limit: %w", err)
+	}
+	if l := limit.For(amount.Currency, account.AccountType); l > 0 && amount.Minor > l {
+		return errLimitExceeded
+	}
+	return nil
 }
 
-// Helper function to create a transaction
-func (h *Handler) createTransaction(tx *sql.Tx, txID, fromAccount, toAccount, toAccountName, toBank, currency, note string, amount int64, stamp string) error {
+// createTransaction writes both legs of t under the transaction ID insertTransfer gave it.
+// The recipient leg is in the recipient currency; both legs of a cross-currency transfer carry
+// the quoted rate and the converted amount.
+func (h *Handler) createTransaction(tx *sql.Tx, t *Transfer, stamp string) error {
+	credit := t.credit()
+	convertedAmount, convertedCurrency := nullableMoney(t.Converted)
 	_, err := tx.Exec(`
-        INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, amount, currency, type, note, transferred_at)
+        INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, amount, currency, type, note, transferred_at, original_transaction_id,
+            exchange_rate, converted_amount, converted_currency)
         VALUES
-            ($1, $2, $2, $3, $4, $5, $6, $7, $8, $9, $10),
-            ($1, $3, $2, $3, $4, $5, $11, $7, $12, $9, $10)
+            ($1, $2, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($13, ''), NULLIF($15, ''), $16, $17),
+            ($1, $3, $2, $3, $4, $5, $11, $14, $12, $9, $10, NULLIF($13, ''), NULLIF($15, ''), $16, $17)
         `,
-		txID, fromAccount, toAccount, toAccountName, toBank, -amount, currency, "Transfer out", note, stamp, amount, "Transfer in")
+		t.TransactionID, t.FromAccount, t.ToAccount, t.ToAccountName, t.ToBank, -t.Amount.Minor, t.Amount.Currency, "Transfer out", t.Note, stamp, credit.Minor, "Transfer in", t.ReversalOf,
+		credit.Currency, t.ExchangeRate, convertedAmount, convertedCurrency)
 	return err
 }
 
+// transfer checks both accounts, moves the balances and writes both legs of t inside tx,
+// recording t as PENDING and then COMPLETED. It fills in the transaction ID, the recipient
+// name and the status of t.
+// The amount is in the currency of the sender account; a recipient in another currency is
+// credited the amount converted at the rate quoted when the transfer is made.
+// The amount is first held on the sender, a conditional insert that checks the available
+// balance in the same statement, so concurrent transfers can never overdraw the account.
+// The hold is captured once both legs are written, in the same database transaction, so it
+// never outlives the transfer.
+// Every transfer is also posted to the journal as a balanced double-entry.
+// It is shared by CreateTransfer and the scheduler so both go through the same ledger logic.
+func (h *Handler) transfer(tx *sql.Tx, t *Transfer, stamp string) error {
+	// Get recipient account name, this also verifies the recipient exists
+	var toCurrency string
+	err := tx.QueryRow(`
+        SELECT account_name, currency
+        FROM accounts
+        WHERE account_number = $1`, t.ToAccount).Scan(&t.ToAccountName, &toCurrency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errRecipientNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("unable to retrieve recipient account name: %w", err)
+	}
+
+	// The amount is in the currency of the sender, converted when the recipient's differs
+	var fromCurrency string
+	err = tx.QueryRow(`SELECT currency FROM accounts WHERE account_number = $1`, t.FromAccount).Scan(&fromCurrency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errAccountNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("unable to retrieve sender currency: %w", err)
+	}
+	if t.Amount.Currency != fromCurrency {
+		return fmt.Errorf("%w: %s is not %s", errCurrencyMismatch, t.Amount.Currency, fromCurrency)
+	}
+	if err := h.quote(t, toCurrency, stamp); err != nil {
+		return err
+	}
+
+	if err := h.insertTransfer(tx, t, stamp); err != nil {
+		return err
+	}
+
+	// A scheduled run uses the funds reserved for it ahead of time
+	if t.ScheduleID != "" {
+		if err := h.releaseScheduleHolds(tx, t.ScheduleID, stamp); err != nil {
+			return err
+		}
+	}
+
+	// Hold the amount on the sender, this fails unless the available balance covers it
+	hold := &Hold{AccountNumber: t.FromAccount, Amount: t.Amount, TransactionID: t.TransactionID}
+	if err := h.placeHold(tx, hold, stamp); err != nil {
+		return err
+	}
+
+	// Update the balance in the recipient account
+	_, err = tx.Exec(`
+        UPDATE accounts
+        SET balance = balance + $1
+        WHERE account_number = $2`,
+		t.credit().Minor, t.ToAccount)
+	if err != nil {
+		return fmt.Errorf("unable to update recipient balance: %w", err)
+	}
+
+	// Create the transaction entries
+	if err := h.createTransaction(tx, t, stamp); err != nil {
+		return fmt.Errorf("unable to create transaction: %w", err)
+	}
+
+	// Settle the hold, debiting the sender
+	if err := h.captureHold(tx, hold, stamp); err != nil {
+		return err
+	}
+
+	// Record the movement in the journal
+	if err := h.postTransfer(tx, t, stamp); err != nil {
+		return err
+	}
+
+	return h.setTransferStatus(tx, t, TransferCompleted, "", stamp)
+}
+
 // CreateTransfer handler
 func (h *Handler) CreateTransfer(c *gin.Context) {
 	fromAccount := c.Param("accountNumber")
 	var req TransferRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithError(c, badRequest("invalid request body"), "")
 		return
 	}
-
-	// Validate account balance
-	balance, err := h.validateAccountBalance(fromAccount, req.Amount)
+	amount, err := validateTransfer(fromAccount, req)
 	if err != nil {
-		handleTransferError(c, err, "unable to check account balance")
-		return
-	}
-	if balance < req.Amount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient balance"})
+		abortWithError(c, err, "")
 		return
 	}
 
-	// Get recipient account name
-	toAccountName, err := h.getAccountName(req.ToAccount)
+	// Get sender account, its type decides which transfer limit applies
+	account, err := h.getAccount(fromAccount)
 	if err != nil {
-		handleTransferError(c, err, "unable to retrieve recipient account name")
+		abortWithError(c, err, "unable to get account")
 		return
 	}
-
-	// Begin transaction
-	tx, err := h.db.Begin()
-	if err != nil {
-		handleTransferError(c, err, "unable to create transfer")
+	if amount.Currency != account.Currency {
+		abortWithError(c, errCurrencyMismatch, "")
 		return
 	}
-
-	txID := transactionID()
-	stamp := time.Now().Format("2006-01-02 15:04:05")
-
-	// Create the transaction entries
-	if err := h.createTransaction(tx, txID, fromAccount, req.ToAccount, toAccountName, req.ToBank, req.Currency, req.Note, req.Amount, stamp); err != nil {
-		handleTransferError(c, err, "unable to create transaction")
+	if err := checkTransferLimit(amount, account); err != nil {
+		abortWithError(c, err, "unable to create transfer")
 		return
 	}
 
-	// Update the balance in the sender account
-	_, err = tx.Exec(`
-        UPDATE accounts
-        SET balance = balance - $1
-        WHERE account_number = $2`,
-		req.Amount, fromAccount)
+	// Begin transaction
+	tx, err := h.db.Begin()
 	if err != nil {
-		handleTransferError(c, err, "unable to update sender balance")
+		abortWithError(c, err, "unable to create transfer")
 		return
 	}
-
-	// Update the balance in the recipient account
-	_, err = tx.Exec(`
-        UPDATE accounts
-        SET balance = balance + $1
-        WHERE account_number = $2`,
-		req.Amount, req.ToAccount)
-	if err != nil {
-		handleTransferError(c, err, "unable to update recipient balance")
+	defer tx.Rollback()
+
+	stamp := formatTime(time.Now())
+	t := &Transfer{
+		FromAccount: fromAccount,
+		ToAccount:   req.ToAccount,
+		ToBank:      bankCode(req.ToBank),
+		Amount:      amount,
+		Note:        req.Note,
+	}
+	if err := h.transfer(tx, t, stamp); err != nil {
+		if isTransferFailure(err) {
+			err = h.failTransfer(tx, t, err, stamp)
+		}
+		abortWithError(c, err, "unable to create transfer")
 		return
 	}
 
 	// Commit the transaction
 	err = tx.Commit()
 	if err != nil {
-		handleTransferError(c, err, "unable to commit transfer")
+		abortWithError(c, err, "unable to commit transfer")
 		return
 	}
 
 	// Send the response with transaction details
 	resp := TransferResponse{
-		TransactionID: txID,
-		Status:        "TRANSFERRED",
+		TransactionID: t.TransactionID,
+		Status:        t.Status,
 		TransferredAt: stamp,
+		ExchangeRate:  t.ExchangeRate,
+		Converted:     t.Converted,
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
-func scheduleID() string {
-	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return fmt.Sprintf("SCH%v", rd.Intn(1000000000))
+// failTransfer rolls back tx, in which t failed for reason, and records t as FAILED in a
+// transaction of its own. It returns reason pointing to the recorded transfer.
+func (h *Handler) failTransfer(tx *sql.Tx, t *Transfer, reason error, stamp string) error {
+	if err := tx.Rollback(); err != nil {
+		return err
+	}
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := h.recordFailedTransfer(tx, t, reason, stamp); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return &failedTransferError{transactionID: t.TransactionID, err: reason}
 }
 
+// bankDB is the SQLite database the server runs on.
+const bankDB = "./bank.sqlite"
+
 func main() {
-	bankDB := "./bank.sqlite"
-	// reset database
-	err := os.Remove(bankDB)
-	if err != nil {
-		log.Println(err)
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	conf := config.C()
+
+	// the database is kept across restarts unless a development setup asks for a fresh one
+	if conf.ResetDB {
+		if err := os.Remove(bankDB); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Println(err)
+		}
 	}
 
 	db, err := sql.Open("sqlite", bankDB)
@@ -478,6 +636,8 @@ func main() {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	// sqlite allows a single writer; share one connection between the API and the scheduler
+	db.SetMaxOpenConns(1)
 
 	err = Migrate(db)
 	if err != nil {
@@ -489,9 +649,49 @@ func main() {
 		log.Fatal(err)
 	}
 
-	conf := config.C()
+	h := &Handler{db: db, idempotencyTTL: conf.IdempotencyTTL}
+	if h.tz, err = time.LoadLocation(conf.BusinessTimezone); err != nil {
+		log.Fatal(err)
+	}
+	if conf.FXRatesFile != "" {
+		if h.rates, err = fx.Load(conf.FXRatesFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if conf.HolidayFile != "" {
+		if h.calendar, err = calendar.Load(conf.HolidayFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := h.postOpeningBalances(formatTime(time.Now())); err != nil {
+		log.Fatal(err)
+	}
+	if report, err := h.checkLedger(); err != nil {
+		log.Printf("Error: unable to check ledger: %v", err)
+	} else if !report.OK() {
+		log.Printf("Ledger check found %d unbalanced entries and %d balance mismatches", len(report.Violations), len(report.Mismatches))
+	}
+	if h.statementPDF, err = statement.LoadPDF(conf.StatementFont, conf.StatementBoldFont); err != nil {
+		log.Printf("Thai text will be missing from PDF statements: %v", err)
+	}
 
-	h := &Handler{db: db}
+	scheduler := NewScheduler(h, time.Now, conf.SchedulerInterval)
+	scheduler.holdLead = conf.ScheduleHoldLead
+	scheduler.retries, scheduler.retryBackoff, scheduler.suspendAfter = conf.ScheduleRetries, conf.ScheduleRetryBackoff, conf.ScheduleSuspendAfter
+	go scheduler.Start(context.Background())
+
+	features, err := featureProvider(context.Background(), conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	firebase.SetProvider(features)
+
+	if conf.ProjectID != "" && conf.FeatureProvider == "firebase" {
+		// private keys in env files usually carry escaped newlines
+		privateKey := strings.ReplaceAll(conf.PrivateKey, `\n`, "\n")
+		refresher := firebase.NewRefresher(firebase.Authen(conf.Email, privateKey), conf.ProjectID, conf.RemoteConfigInterval)
+		go refresher.Run(context.Background())
+	}
 
 	port := "8080"
 	if conf.PORT != "" {
@@ -503,16 +703,50 @@ func main() {
 	router.Run(":" + port)
 }
 
+// featureProvider builds the feature flag provider selected by FEATURE_PROVIDER.
+func featureProvider(ctx context.Context, conf config.Config) (firebase.Provider, error) {
+	var file *firebase.File
+	if conf.FeatureFile != "" {
+		f, err := firebase.NewFile(conf.FeatureFile)
+		if err != nil {
+			return nil, err
+		}
+		go f.Watch(ctx, 5*time.Second)
+		file = f
+	}
+
+	switch conf.FeatureProvider {
+	case "firebase":
+		if file != nil {
+			return firebase.Layered{file, firebase.Remote()}, nil
+		}
+		return firebase.Remote(), nil
+	case "file":
+		if file == nil {
+			return nil, errors.New("FEATURE_FILE is required by the file feature provider")
+		}
+		return file, nil
+	case "memory":
+		return firebase.NewMemory(firebase.RemoteConfig{}), nil
+	}
+	return nil, fmt.Errorf("unknown feature provider %q", conf.FeatureProvider)
+}
+
 func setupRouter(h *Handler) *gin.Engine {
-	router := gin.Default()
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.Use(RequestErrors())
 	router.Use(cors.Default())
 	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	router.Use(gin.CustomRecovery(recoverWithError))
+	router.NoRoute(func(c *gin.Context) { abortWithError(c, errRouteNotFound, "") })
+	router.NoMethod(func(c *gin.Context) { abortWithError(c, errMethodNotAllowed, "") })
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Idempotency-Key, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 	})
 
 	// Health Check
@@ -524,14 +758,32 @@ func setupRouter(h *Handler) *gin.Engine {
 	router.GET("/accounts/:accountNumber/balances", h.GetBalance)
 	router.GET("/accounts/:accountNumber/transactions", h.GetTransactions)
 	router.GET("/accounts/:accountNumber/schedules", h.GetSchedules)
+	router.GET("/accounts/:accountNumber/schedules/:scheduleId", h.GetSchedule)
+	router.GET("/accounts/:accountNumber/schedules/:scheduleId/events", h.GetScheduleEvents)
+	router.GET("/accounts/:accountNumber/schedules/:scheduleId/occurrences", h.GetScheduleOccurrences)
+	router.GET("/accounts/:accountNumber/schedules/:scheduleId/runs", h.GetScheduleRuns)
+	router.GET("/accounts/:accountNumber/holds", h.GetHolds)
+	router.GET("/accounts/:accountNumber/statements", h.GetStatement)
+	router.GET("/accounts/:accountNumber/statements/:month", h.GetMonthlyStatementPDF)
 	router.GET("/transactions", h.GetAllTransactions)
+	router.GET("/transfers/:transactionId", h.GetTransfer)
+	router.POST("/transfers/:transactionId/reversals", h.Idempotency(), h.CreateReversal)
 
-	router.POST("/accounts/:accountNumber/transfers", h.CreateTransfer)
-	router.POST("/accounts/:accountNumber/schedules", h.CreateSchedules)
+	router.GET("/admin/reconciliation", h.GetReconciliation)
+
+	router.POST("/accounts/:accountNumber/transfers", h.Idempotency(), h.CreateTransfer)
+	router.POST("/accounts/:accountNumber/schedules", h.Idempotency(), h.CreateSchedules)
+	router.PATCH("/accounts/:accountNumber/schedules/:scheduleId", h.UpdateSchedule)
+	router.DELETE("/accounts/:accountNumber/schedules/:scheduleId", h.CancelSchedule)
+	router.POST("/accounts/:accountNumber/schedules/:scheduleId/pause", h.PauseSchedule)
+	router.POST("/accounts/:accountNumber/schedules/:scheduleId/resume", h.ResumeSchedule)
 
 	router.GET("/features", func(c *gin.Context) {
 		c.JSON(http.StatusOK, firebase.AllConfigs())
 	})
+	router.GET("/features/status", func(c *gin.Context) {
+		c.JSON(http.StatusOK, firebase.FetchStatus())
+	})
 
 	return router
 }
@@ -544,7 +796,6 @@ func Migrate(db *sql.DB) error {
             type TEXT NOT NULL DEFAULT '',
             account_name TEXT NOT NULL DEFAULT '',
             balance INTEGER NOT NULL DEFAULT 0,
-            available_balance INTEGER NOT NULL DEFAULT 0,
             currency TEXT NOT NULL DEFAULT 'THB'
         )`,
 		`CREATE TABLE IF NOT EXISTS transactions (
@@ -559,7 +810,11 @@ func Migrate(db *sql.DB) error {
             amount INTEGER NOT NULL,
             currency TEXT NOT NULL,
             note TEXT,
-            transferred_at TEXT NOT NULL
+            transferred_at TEXT NOT NULL,
+            original_transaction_id TEXT,
+            exchange_rate TEXT,
+            converted_amount INTEGER,
+            converted_currency TEXT
         )`,
 		`CREATE TABLE IF NOT EXISTS schedules (
             schedule_id TEXT PRIMARY KEY,
@@ -574,7 +829,108 @@ func Migrate(db *sql.DB) error {
             status TEXT DEFAULT 'scheduled',
             schedule TEXT NOT NULL,
             schedule_date TEXT NOT NULL,
-            end_date TEXT
+            end_date TEXT,
+            start_date TEXT,
+            rrule TEXT,
+            occurrence_date TEXT,
+            business_day_policy TEXT,
+            last_transaction_id TEXT,
+            last_run_at TEXT,
+            last_error TEXT,
+            attempts INTEGER NOT NULL DEFAULT 0,
+            retry_at TEXT,
+            consecutive_failures INTEGER NOT NULL DEFAULT 0
+        )`,
+		`CREATE TABLE IF NOT EXISTS schedule_events (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            schedule_id TEXT NOT NULL,
+            action TEXT NOT NULL,
+            actor TEXT NOT NULL,
+            from_status TEXT,
+            to_status TEXT NOT NULL,
+            changes TEXT,
+            request_id TEXT,
+            created_at TEXT NOT NULL
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_schedule_events_schedule ON schedule_events (schedule_id, id)`,
+		`CREATE TABLE IF NOT EXISTS schedule_runs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            schedule_id TEXT NOT NULL,
+            occurrence_date TEXT NOT NULL,
+            attempt INTEGER NOT NULL,
+            status TEXT NOT NULL,
+            transaction_id TEXT,
+            error TEXT,
+            retry_at TEXT,
+            created_at TEXT NOT NULL
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule ON schedule_runs (schedule_id, id)`,
+		`CREATE TABLE IF NOT EXISTS transfers (
+            transaction_id TEXT PRIMARY KEY,
+            from_account TEXT NOT NULL,
+            to_account TEXT NOT NULL,
+            to_account_name TEXT NOT NULL DEFAULT '',
+            to_bank TEXT,
+            amount INTEGER NOT NULL,
+            currency TEXT NOT NULL,
+            note TEXT,
+            schedule_id TEXT,
+            reversal_of TEXT,
+            refunded_amount INTEGER NOT NULL DEFAULT 0,
+            status TEXT NOT NULL,
+            failure_reason TEXT,
+            created_at TEXT NOT NULL,
+            updated_at TEXT NOT NULL,
+            completed_at TEXT,
+            failed_at TEXT,
+            reversed_at TEXT,
+            exchange_rate TEXT,
+            converted_amount INTEGER,
+            converted_currency TEXT
+        )`,
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+            idempotency_key TEXT NOT NULL,
+            scope TEXT NOT NULL,
+            request_hash TEXT NOT NULL,
+            status_code INTEGER,
+            response TEXT,
+            created_at TEXT NOT NULL,
+            expires_at TEXT NOT NULL,
+            PRIMARY KEY (idempotency_key, scope)
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_account_time ON transactions (account_number, transferred_at, id)`,
+		`CREATE TABLE IF NOT EXISTS holds (
+            hold_id TEXT PRIMARY KEY,
+            account_number TEXT NOT NULL,
+            amount INTEGER NOT NULL,
+            currency TEXT NOT NULL,
+            transaction_id TEXT,
+            schedule_id TEXT,
+            status TEXT NOT NULL,
+            created_at TEXT NOT NULL,
+            updated_at TEXT NOT NULL
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_holds_account_status ON holds (account_number, status)`,
+		`CREATE TABLE IF NOT EXISTS journal_entries (
+            entry_id TEXT PRIMARY KEY,
+            transaction_id TEXT,
+            description TEXT NOT NULL DEFAULT '',
+            posted_at TEXT NOT NULL
+        )`,
+		`CREATE TABLE IF NOT EXISTS postings (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            entry_id TEXT NOT NULL,
+            account_number TEXT NOT NULL,
+            amount INTEGER NOT NULL,
+            currency TEXT NOT NULL
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_postings_entry ON postings (entry_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_postings_account ON postings (account_number, currency)`,
+		`CREATE TABLE IF NOT EXISTS opening_balances (
+            account_number TEXT PRIMARY KEY,
+            amount INTEGER NOT NULL,
+            as_of TEXT NOT NULL DEFAULT ''
         )`,
 	}
 
@@ -585,42 +941,82 @@ func Migrate(db *sql.DB) error {
 		}
 	}
 
-	return nil
+	// A transfer has one leg per account, older databases may have more
+	dups, err := duplicateLegs(db)
+	if err != nil {
+		return err
+	}
+	if len(dups) > 0 {
+		return fmt.Errorf("%w: %s", errDuplicateLegs, strings.Join(dups, ", "))
+	}
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_leg ON transactions (transaction_id, account_number)`)
+	return err
+}
+
+// errDuplicateLegs means transactions has more than one leg of a transfer on an account,
+// which keeps Migrate from making legs unique. Everything else is migrated by then;
+// reconcile -plan proposes how to resolve them.
+var errDuplicateLegs = errors.New("duplicate transaction legs, resolve them with reconcile -plan")
+
+// duplicateLegs returns the transaction IDs with more than one leg on an account, as
+// "TXN on account (n legs)".
+func duplicateLegs(q querier) ([]string, error) {
+	rows, err := q.Query(`
+        SELECT transaction_id, account_number, COUNT(*)
+        FROM transactions
+        GROUP BY transaction_id, account_number
+        HAVING COUNT(*) > 1
+        ORDER BY transaction_id, account_number`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to check for duplicate legs: %w", err)
+	}
+	defer rows.Close()
+
+	var dups []string
+	for rows.Next() {
+		var id, account string
+		var n int
+		if err := rows.Scan(&id, &account, &n); err != nil {
+			return nil, err
+		}
+		dups = append(dups, fmt.Sprintf("%s on %s (%d legs)", id, account, n))
+	}
+	return dups, rows.Err()
 }
 
+// Seed adds the demo accounts, transactions and schedules. Rows that are there already are
+// left as they are, so seeding after a restart keeps balances and schedules.
 func Seed(db *sql.DB) error {
 	seeds := []string{
-		`INSERT INTO accounts (branch, account_number, type, account_name, balance, available_balance, currency)
+		`INSERT INTO accounts (branch, account_number, type, account_name, balance, currency)
             VALUES
-            ('Kalasin', '111-111-111', 'Savings', 'AnuchitO', 101282250, 101282250, 'THB'),
-            ('KhonKean', '222-222-222', 'Savings', 'MaiThai', 96588150, 96588150, 'THB'),
-            ('Bangkok', '333-333-333', 'Savings', 'LaumPlearn', 105500, 105500, 'THB'),
-            ('Udon', '444-444-444', 'Savings', 'Laumcing', 199800, 199800, 'THB')
-        ON CONFLICT (account_number) DO UPDATE
-        SET balance = EXCLUDED.balance,
-            available_balance = EXCLUDED.available_balance`,
+            ('Kalasin', '111-111-111', 'Savings', 'AnuchitO', 101282250, 'THB'),
+            ('KhonKean', '222-222-222', 'Savings', 'MaiThai', 96588150, 'THB'),
+            ('Bangkok', '333-333-333', 'Savings', 'LaumPlearn', 105500, 'THB'),
+            ('Udon', '444-444-444', 'Savings', 'Laumcing', 199800, 'THB')
+        ON CONFLICT DO NOTHING`,
 
 		`INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, amount, currency, type, note, transferred_at)
         VALUES
-            ('TXN123456789', '111-111-111', '111-111-111', '222-222-222', 'MaiThai', 'KTB',  98982500, 'THB', 'Transfer in', 'Lunch', '2024-11-10 14:22:00'),
-            ('TXN123456789', '222-222-222', '111-111-111', '222-222-222', 'MaiThai', 'KTB', -98982500, 'THB', 'Transfer out', 'Lunch', '2024-11-10 14:22:00'),
-            ('TXN120456799', '111-111-111', '111-111-111', '444-444-444', 'Laumcing', 'KBank', -2300000, 'THB', 'Transfer out', 'Dinner', '2024-12-10 14:22:00'),
-            ('TXN120456799', '444-444-444', '111-111-111', '444-444-444', 'Laumcing', 'KBank',  2300000, 'THB', 'Transfer in', 'Dinner', '2024-12-10 14:22:00'),
-            ('TXN987634521', '111-111-111', '111-111-111', '333-333-333', 'LaumPlearn', 'SCB',  2499850, 'THB', 'Transfer in', 'Dinner', '2025-01-13 18:00:00'),
-            ('TXN987634521', '333-333-333', '111-111-111', '333-333-333', 'LaumPlearn', 'SCB', -2499850, 'THB', 'Transfer out', 'Dinner', '2025-01-13 18:00:00'),
-            ('TXN123416629', '111-111-111', '111-111-111', '222-222-222', 'MaiThai', 'KTB', -399900, 'THB', 'Transfer out', 'Breakfast', '2025-01-14 14:22:00'),
-            ('TXN123416629', '222-222-222', '111-111-111', '222-222-222', 'MaiThai', 'KTB',  399900, 'THB', 'Transfer in', 'Breakfast', '2025-01-14 14:22:00'),
-            ('TXN987654331', '222-222-222', '222-222-222', '333-333-333', 'LaumPlearn', 'SCB', -2394350, 'THB', 'Transfer out', 'Dinner', '2021-09-01 18:00:00'),
-            ('TXN987654331', '333-333-333', '222-222-222', '333-333-333', 'LaumPlearn', 'SCB',  2394350, 'THB', 'Transfer in', 'Dinner', '2021-09-01 18:00:00'),
-            ('TXN123434267', '111-111-111', '111-111-111', '444-444-444', 'Laumcing',  'KBank', -2499800, 'THB', 'Transfer out', 'Lunch', '2025-01-10 14:22:00'),
-            ('TXN123456789', '444-444-444', '111-111-111', '444-444-444', 'Laumcing',  'KBank',  2499800, 'THB', 'Transfer in', 'Lunch', '2025-01-10 14:22:00')
+            ('TXN123456789', '111-111-111', '111-111-111', '222-222-222', 'MaiThai', 'KTB', -98982500, 'THB', 'Transfer out', 'Lunch', '2024-11-10T07:22:00Z'),
+            ('TXN123456789', '222-222-222', '111-111-111', '222-222-222', 'MaiThai', 'KTB',  98982500, 'THB', 'Transfer in', 'Lunch', '2024-11-10T07:22:00Z'),
+            ('TXN120456799', '111-111-111', '111-111-111', '444-444-444', 'Laumcing', 'KBANK', -2300000, 'THB', 'Transfer out', 'Dinner', '2024-12-10T07:22:00Z'),
+            ('TXN120456799', '444-444-444', '111-111-111', '444-444-444', 'Laumcing', 'KBANK',  2300000, 'THB', 'Transfer in', 'Dinner', '2024-12-10T07:22:00Z'),
+            ('TXN987634521', '111-111-111', '111-111-111', '333-333-333', 'LaumPlearn', 'SCB', -2499850, 'THB', 'Transfer out', 'Dinner', '2025-01-13T11:00:00Z'),
+            ('TXN987634521', '333-333-333', '111-111-111', '333-333-333', 'LaumPlearn', 'SCB',  2499850, 'THB', 'Transfer in', 'Dinner', '2025-01-13T11:00:00Z'),
+            ('TXN123416629', '111-111-111', '111-111-111', '222-222-222', 'MaiThai', 'KTB', -399900, 'THB', 'Transfer out', 'Breakfast', '2025-01-14T07:22:00Z'),
+            ('TXN123416629', '222-222-222', '111-111-111', '222-222-222', 'MaiThai', 'KTB',  399900, 'THB', 'Transfer in', 'Breakfast', '2025-01-14T07:22:00Z'),
+            ('TXN987654331', '222-222-222', '222-222-222', '333-333-333', 'LaumPlearn', 'SCB', -2394350, 'THB', 'Transfer out', 'Dinner', '2021-09-01T11:00:00Z'),
+            ('TXN987654331', '333-333-333', '222-222-222', '333-333-333', 'LaumPlearn', 'SCB',  2394350, 'THB', 'Transfer in', 'Dinner', '2021-09-01T11:00:00Z'),
+            ('TXN123434267', '111-111-111', '111-111-111', '444-444-444', 'Laumcing',  'KBANK', -2499800, 'THB', 'Transfer out', 'Lunch', '2025-01-10T07:22:00Z'),
+            ('TXN123434267', '444-444-444', '111-111-111', '444-444-444', 'Laumcing',  'KBANK',  2499800, 'THB', 'Transfer in', 'Lunch', '2025-01-10T07:22:00Z')
         ON CONFLICT DO NOTHING`,
 
 		`INSERT INTO schedules (schedule_id, from_account, to_account, to_account_name, to_bank, amount, currency, note, schedule, status, schedule_date, end_date)
         VALUES
-            ('SCH123456789', '111-111-111', '222-222-222', 'MaiThai', 'KTB', -1899900, 'THB', 'Breakfast', 'ONCE', 'SCHEDULED', '2025-09-01 12:00:00', '2030-09-01 12:00:00'),
-            ('SCH987654321', '111-111-111', '333-333-333', 'LaumPlearn', 'SCB', -2499850, 'THB', 'Lunch', 'ONCE', 'SCHEDULED', '2025-09-01 12:00:00', '2030-09-01 12:00:00'),
-            ('SCH123434267', '111-111-111', '444-444-444', 'Laumcing', 'KBank', -2398825, 'THB', 'Dinner', 'ONCE', 'SCHEDULED', '2025-09-01 12:00:00', '2030-09-01 12:00:00')
+            ('SCH123456789', '111-111-111', '222-222-222', 'MaiThai', 'KTB', -1899900, 'THB', 'Breakfast', 'ONCE', 'SCHEDULED', '2025-09-01T05:00:00Z', '2030-09-01T05:00:00Z'),
+            ('SCH987654321', '111-111-111', '333-333-333', 'LaumPlearn', 'SCB', -2499850, 'THB', 'Lunch', 'ONCE', 'SCHEDULED', '2025-09-01T05:00:00Z', '2030-09-01T05:00:00Z'),
+            ('SCH123434267', '111-111-111', '444-444-444', 'Laumcing', 'KBANK', -2398825, 'THB', 'Dinner', 'ONCE', 'SCHEDULED', '2025-09-01T05:00:00Z', '2030-09-01T05:00:00Z')
         ON CONFLICT DO NOTHING`,
 	}
 
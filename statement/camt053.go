@@ -0,0 +1,175 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+const (
+	camtNamespace  = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+	camtTimeLayout = "2006-01-02T15:04:05"
+	camtDateLayout = "2006-01-02"
+)
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      string     `xml:"Dt>Dt"`
+}
+
+type camtParty struct {
+	Name string `xml:"Nm"`
+}
+
+type camtAccount struct {
+	ID string `xml:"Id>Othr>Id"`
+}
+
+type camtRelatedParties struct {
+	Debtor          *camtParty   `xml:"Dbtr,omitempty"`
+	DebtorAccount   *camtAccount `xml:"DbtrAcct,omitempty"`
+	Creditor        *camtParty   `xml:"Cdtr,omitempty"`
+	CreditorAccount *camtAccount `xml:"CdtrAcct,omitempty"`
+}
+
+type camtRemittance struct {
+	Unstructured string `xml:"Ustrd"`
+}
+
+type camtEntry struct {
+	Reference   string     `xml:"NtryRef"`
+	Amount      camtAmount `xml:"Amt"`
+	Indicator   string     `xml:"CdtDbtInd"`
+	Status      string     `xml:"Sts"`
+	BookingDate string     `xml:"BookgDt>DtTm"`
+	ValueDate   string     `xml:"ValDt>DtTm"`
+	ServicerRef string     `xml:"AcctSvcrRef"`
+	Details     struct {
+		EndToEndID string              `xml:"Refs>EndToEndId"`
+		Parties    *camtRelatedParties `xml:"RltdPties,omitempty"`
+		Remittance *camtRemittance     `xml:"RmtInf,omitempty"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+type camtDocument struct {
+	XMLName   xml.Name `xml:"Document"`
+	Namespace string   `xml:"xmlns,attr"`
+	Header    struct {
+		MessageID string `xml:"MsgId"`
+		CreatedAt string `xml:"CreDtTm"`
+	} `xml:"BkToCstmrStmt>GrpHdr"`
+	Statement struct {
+		ID        string        `xml:"Id"`
+		CreatedAt string        `xml:"CreDtTm"`
+		From      string        `xml:"FrToDt>FrDtTm"`
+		To        string        `xml:"FrToDt>ToDtTm"`
+		AccountID string        `xml:"Acct>Id>Othr>Id"`
+		Currency  string        `xml:"Acct>Ccy"`
+		Name      string        `xml:"Acct>Nm,omitempty"`
+		Balances  []camtBalance `xml:"Bal"`
+		Entries   []camtEntry   `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// WriteCamt053 writes s as an ISO 20022 camt.053.001.02 bank to customer statement with the
+// opening booked (OPBD) and closing booked (CLBD) balances.
+func WriteCamt053(w io.Writer, s *Statement) error {
+	ccy := s.Account.Currency
+	id := s.Account.Number + "-" + s.From.Format("20060102") + "-" + s.To.Format("20060102")
+
+	doc := camtDocument{Namespace: camtNamespace}
+	doc.Header.MessageID = id
+	doc.Header.CreatedAt = s.GeneratedAt.Format(camtTimeLayout)
+
+	st := &doc.Statement
+	st.ID = id
+	st.CreatedAt = s.GeneratedAt.Format(camtTimeLayout)
+	st.From = s.From.Format(camtTimeLayout)
+	st.To = s.To.Format(camtTimeLayout)
+	st.AccountID = s.Account.Number
+	st.Currency = ccy
+	st.Name = s.Account.Name
+	st.Balances = []camtBalance{
+		camtBalanceOf("OPBD", s.OpeningBalance, ccy, s.From.Format(camtDateLayout)),
+		camtBalanceOf("CLBD", s.ClosingBalance, ccy, s.To.Format(camtDateLayout)),
+	}
+
+	for _, e := range s.Entries {
+		entry := camtEntry{
+			Reference:   e.TransactionID,
+			Amount:      camtAmount{Currency: ccy, Value: FormatAmount(abs(e.Amount), ccy)},
+			Indicator:   indicator(e.Amount),
+			Status:      "BOOK",
+			BookingDate: e.BookedAt.Format(camtTimeLayout),
+			ValueDate:   e.BookedAt.Format(camtTimeLayout),
+			ServicerRef: e.TransactionID,
+		}
+		entry.Details.EndToEndID = e.TransactionID
+		entry.Details.Parties = camtPartiesOf(e)
+		if e.Note != "" {
+			entry.Details.Remittance = &camtRemittance{Unstructured: e.Note}
+		}
+		st.Entries = append(st.Entries, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// camtPartiesOf names the counterparty of e: the creditor of money going out, the debtor of
+// money coming in.
+func camtPartiesOf(e Entry) *camtRelatedParties {
+	if e.Counterparty == "" && e.CounterpartyName == "" {
+		return nil
+	}
+	var party *camtParty
+	var account *camtAccount
+	if e.CounterpartyName != "" {
+		party = &camtParty{Name: e.CounterpartyName}
+	}
+	if e.Counterparty != "" {
+		account = &camtAccount{ID: e.Counterparty}
+	}
+	if e.Amount < 0 {
+		return &camtRelatedParties{Creditor: party, CreditorAccount: account}
+	}
+	return &camtRelatedParties{Debtor: party, DebtorAccount: account}
+}
+
+func camtBalanceOf(code string, amount int64, ccy, date string) camtBalance {
+	return camtBalance{
+		Code:      code,
+		Amount:    camtAmount{Currency: ccy, Value: FormatAmount(abs(amount), ccy)},
+		Indicator: indicator(amount),
+		Date:      date,
+	}
+}
+
+// indicator is the camt credit/debit indicator of a signed amount.
+func indicator(amount int64) string {
+	if amount < 0 {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
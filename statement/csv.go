@@ -0,0 +1,44 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+const csvTimeLayout = "2006-01-02T15:04:05"
+
+// WriteCSV writes s as CSV with a header row. The first and last rows carry the opening and
+// closing balance, every row in between is an entry with its running balance. Text a
+// spreadsheet would read as a formula is written with a leading ', see csvText.
+func WriteCSV(w io.Writer, s *Statement) error {
+	cw := csv.NewWriter(w)
+	ccy := s.Account.Currency
+
+	rows := [][]string{
+		{"Booked At", "Transaction ID", "Type", "Counterparty", "Counterparty Name", "Note", "Amount", "Balance", "Currency"},
+		{s.From.Format(csvTimeLayout), "", "Opening balance", "", "", "", "", FormatAmount(s.OpeningBalance, ccy), ccy},
+	}
+	for _, e := range s.Entries {
+		rows = append(rows, []string{
+			e.BookedAt.Format(csvTimeLayout), csvText(e.TransactionID), csvText(e.Type), csvText(e.Counterparty), csvText(e.CounterpartyName), csvText(e.Note),
+			FormatAmount(e.Amount, ccy), FormatAmount(e.Balance, ccy), ccy,
+		})
+	}
+	rows = append(rows, []string{s.To.Format(csvTimeLayout), "", "Closing balance", "", "", "", "", FormatAmount(s.ClosingBalance, ccy), ccy})
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// csvText keeps v, text taken from a customer such as a note or a name, from being read as a
+// formula by spreadsheets: one starting with =, +, -, @, a tab or a carriage return gets a
+// leading ', which spreadsheets show the text without.
+func csvText(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
@@ -0,0 +1,116 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+const ofxTimeLayout = "20060102150405"
+
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxTransaction struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	Amount string `xml:"TRNAMT"`
+	FITID  string `xml:"FITID"`
+	Name   string `xml:"NAME,omitempty"`
+	Memo   string `xml:"MEMO,omitempty"`
+}
+
+type ofxDocument struct {
+	XMLName xml.Name `xml:"OFX"`
+	SignOn  struct {
+		Status   ofxStatus `xml:"STATUS"`
+		Server   string    `xml:"DTSERVER"`
+		Language string    `xml:"LANGUAGE"`
+	} `xml:"SIGNONMSGSRSV1>SONRS"`
+	Statement struct {
+		TransactionUID string           `xml:"TRNUID"`
+		Status         ofxStatus        `xml:"STATUS"`
+		Currency       string           `xml:"STMTRS>CURDEF"`
+		BankID         string           `xml:"STMTRS>BANKACCTFROM>BANKID"`
+		AccountID      string           `xml:"STMTRS>BANKACCTFROM>ACCTID"`
+		AccountType    string           `xml:"STMTRS>BANKACCTFROM>ACCTTYPE"`
+		Start          string           `xml:"STMTRS>BANKTRANLIST>DTSTART"`
+		End            string           `xml:"STMTRS>BANKTRANLIST>DTEND"`
+		Transactions   []ofxTransaction `xml:"STMTRS>BANKTRANLIST>STMTTRN"`
+		LedgerBalance  string           `xml:"STMTRS>LEDGERBAL>BALAMT"`
+		LedgerAsOf     string           `xml:"STMTRS>LEDGERBAL>DTASOF"`
+	} `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+// WriteOFX writes s as an OFX 2.2 bank statement. OFX has no opening balance, the closing
+// balance is the ledger balance as of the end of the period.
+func WriteOFX(w io.Writer, s *Statement) error {
+	var doc ofxDocument
+	doc.SignOn.Status = ofxStatus{Code: 0, Severity: "INFO"}
+	doc.SignOn.Server = s.GeneratedAt.Format(ofxTimeLayout)
+	doc.SignOn.Language = "ENG"
+
+	st := &doc.Statement
+	st.TransactionUID = "0"
+	st.Status = ofxStatus{Code: 0, Severity: "INFO"}
+	st.Currency = s.Account.Currency
+	st.BankID = s.Account.Branch
+	st.AccountID = s.Account.Number
+	st.AccountType = "CHECKING"
+	if strings.EqualFold(s.Account.Type, "savings") {
+		st.AccountType = "SAVINGS"
+	}
+	st.Start = s.From.Format(ofxTimeLayout)
+	st.End = s.To.Format(ofxTimeLayout)
+	for _, e := range s.Entries {
+		kind := "CREDIT"
+		if e.Amount < 0 {
+			kind = "DEBIT"
+		}
+		st.Transactions = append(st.Transactions, ofxTransaction{
+			Type:   kind,
+			Posted: e.BookedAt.Format(ofxTimeLayout),
+			Amount: FormatAmount(e.Amount, s.Account.Currency),
+			FITID:  e.TransactionID,
+			Name:   truncate(firstNonEmpty(e.CounterpartyName, e.Counterparty), 32),
+			Memo:   truncate(e.Note, 255),
+		})
+	}
+	st.LedgerBalance = FormatAmount(s.ClosingBalance, s.Account.Currency)
+	st.LedgerAsOf = s.To.Format(ofxTimeLayout)
+
+	if _, err := io.WriteString(w, ofxHeader); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// truncate cuts s to at most n characters, not bytes, so Thai names stay valid UTF-8.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,316 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"unicode"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	pdfMargin    = 15.0
+	pdfRowHeight = 6.0
+	pdfDateTime  = "2006-01-02 15:04"
+)
+
+// pdfColumns are the transaction table columns, 180mm wide in total.
+var pdfColumns = []struct {
+	title string
+	width float64
+	align string
+}{
+	{"Date", 28, "L"},
+	{"Description", 52, "L"},
+	{"Note", 34, "L"},
+	{"Debit", 22, "R"},
+	{"Credit", 22, "R"},
+	{"Balance", 22, "R"},
+}
+
+// PDF renders printable statements. Latin text uses the built in Helvetica; Thai text needs
+// a TrueType font with Thai glyphs, such as Noto Sans Thai or Sarabun. Without one, Thai
+// characters can not be drawn and are replaced.
+type PDF struct {
+	thai     []byte
+	thaiBold []byte
+}
+
+// NewPDF returns a renderer using the given TrueType fonts for Thai text. bold may be nil
+// to use regular for bold text as well, and both may be nil to render without Thai glyphs.
+func NewPDF(regular, bold []byte) *PDF {
+	if bold == nil {
+		bold = regular
+	}
+	return &PDF{thai: regular, thaiBold: bold}
+}
+
+// LoadPDF returns a renderer with the Thai fonts read from the given paths. boldPath may be empty.
+func LoadPDF(regularPath, boldPath string) (*PDF, error) {
+	regular, err := os.ReadFile(regularPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read statement font: %w", err)
+	}
+	var bold []byte
+	if boldPath != "" {
+		if bold, err = os.ReadFile(boldPath); err != nil {
+			return nil, fmt.Errorf("unable to read statement bold font: %w", err)
+		}
+	}
+	return NewPDF(regular, bold), nil
+}
+
+// Write renders s as an A4 statement: the account details, a summary with the opening and
+// closing balance, the transactions with their running balance, and the totals.
+func (p *PDF) Write(w io.Writer, s *Statement) error {
+	f := fpdf.New("P", "mm", "A4", "")
+	f.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	f.SetAutoPageBreak(false, pdfMargin)
+	f.SetCreationDate(s.GeneratedAt)
+	f.SetModificationDate(s.GeneratedAt)
+	f.SetTitle("Statement "+s.Account.Number+" "+s.From.Format("January 2006"), true)
+	f.AliasNbPages("{nb}")
+
+	pw := &pdfWriter{f: f, tr: f.UnicodeTranslatorFromDescriptor("")}
+	if p != nil && p.thai != nil {
+		f.AddUTF8FontFromBytes("thai", "", p.thai)
+		f.AddUTF8FontFromBytes("thai", "B", p.thaiBold)
+		pw.hasThai = true
+	}
+	f.SetFooterFunc(func() {
+		pw.font(false, 8)
+		pw.text(pdfMargin, 297-pdfMargin/2, 180, fmt.Sprintf("%s  %s - %s", s.Account.Number, s.From.Format("2006-01-02"), s.To.Format("2006-01-02")), "L")
+		pw.text(pdfMargin, 297-pdfMargin/2, 180, fmt.Sprintf("Page %d of {nb}", f.PageNo()), "R")
+	})
+
+	f.AddPage()
+	y := pw.header(s)
+	y = pw.tableHeader(y)
+
+	ccy := s.Account.Currency
+	t := s.Totals()
+	for _, e := range s.Entries {
+		if y+pdfRowHeight > 297-pdfMargin-pdfRowHeight {
+			f.AddPage()
+			y = pw.tableHeader(pdfMargin)
+		}
+		debit, credit := "", ""
+		if e.Amount < 0 {
+			debit = FormatAmount(-e.Amount, ccy)
+		} else {
+			credit = FormatAmount(e.Amount, ccy)
+		}
+		description := e.Type
+		if name := firstNonEmpty(e.CounterpartyName, e.Counterparty); name != "" {
+			description += " " + name
+		}
+		pw.row(y, false, e.BookedAt.Format(pdfDateTime), description, e.Note, debit, credit, FormatAmount(e.Balance, ccy))
+		y += pdfRowHeight
+	}
+
+	if y+2*pdfRowHeight > 297-pdfMargin-pdfRowHeight {
+		f.AddPage()
+		y = pdfMargin
+	}
+	f.Line(pdfMargin, y, pdfMargin+180, y)
+	pw.row(y, true, "Total", fmt.Sprintf("%d transactions", len(s.Entries)), "",
+		FormatAmount(t.Debits, ccy), FormatAmount(t.Credits, ccy), FormatAmount(s.ClosingBalance, ccy))
+
+	if err := f.Output(w); err != nil {
+		return err
+	}
+	return f.Error()
+}
+
+// Totals sums up the money in and out of a statement.
+type Totals struct {
+	Credits     int64
+	Debits      int64
+	CreditCount int
+	DebitCount  int
+}
+
+// Totals returns the sum of the credits and of the debits of s, both positive.
+func (s *Statement) Totals() Totals {
+	var t Totals
+	for _, e := range s.Entries {
+		if e.Amount < 0 {
+			t.Debits -= e.Amount
+			t.DebitCount++
+		} else {
+			t.Credits += e.Amount
+			t.CreditCount++
+		}
+	}
+	return t
+}
+
+type pdfWriter struct {
+	f       *fpdf.Fpdf
+	tr      func(string) string
+	hasThai bool
+	bold    bool
+	size    float64
+}
+
+// header draws the title, the account details and the balance summary, returning where
+// the transaction table starts.
+func (pw *pdfWriter) header(s *Statement) float64 {
+	ccy := s.Account.Currency
+	y := pdfMargin + 6
+
+	pw.font(true, 16)
+	pw.text(pdfMargin, y, 180, "Account Statement", "L")
+	pw.font(false, 11)
+	pw.text(pdfMargin, y, 180, s.From.Format("January 2006"), "R")
+	y += 10
+
+	details := [][2]string{
+		{"Account name", s.Account.Name},
+		{"Account number", s.Account.Number},
+		{"Branch", s.Account.Branch},
+		{"Currency", ccy},
+		{"Period", s.From.Format(pdfDateTime) + " to " + s.To.Format(pdfDateTime)},
+	}
+	for _, d := range details {
+		pw.font(true, 10)
+		pw.text(pdfMargin, y, 40, d[0], "L")
+		pw.font(false, 10)
+		pw.text(pdfMargin+40, y, 140, d[1], "L")
+		y += 5.5
+	}
+	y += 3
+
+	t := s.Totals()
+	summary := [][2]string{
+		{"Opening balance", FormatAmount(s.OpeningBalance, ccy)},
+		{fmt.Sprintf("Total credits (%d)", t.CreditCount), FormatAmount(t.Credits, ccy)},
+		{fmt.Sprintf("Total debits (%d)", t.DebitCount), FormatAmount(t.Debits, ccy)},
+		{"Closing balance", FormatAmount(s.ClosingBalance, ccy)},
+	}
+	pw.f.SetFillColor(240, 240, 240)
+	pw.f.Rect(pdfMargin, y-4.5, 180, float64(len(summary))*5.5+2, "F")
+	for i, line := range summary {
+		bold := i == 0 || i == len(summary)-1
+		pw.font(bold, 10)
+		pw.text(pdfMargin+2, y, 80, line[0], "L")
+		pw.text(pdfMargin+100, y, 76, line[1]+" "+ccy, "R")
+		y += 5.5
+	}
+	return y + 6
+}
+
+func (pw *pdfWriter) tableHeader(y float64) float64 {
+	titles := make([]string, len(pdfColumns))
+	for i, c := range pdfColumns {
+		titles[i] = c.title
+	}
+	pw.f.SetFillColor(220, 220, 220)
+	pw.f.Rect(pdfMargin, y, 180, pdfRowHeight, "F")
+	pw.row(y, true, titles...)
+	return y + pdfRowHeight
+}
+
+// row draws one table row with its top at y, cutting cells that do not fit their column.
+func (pw *pdfWriter) row(y float64, bold bool, cells ...string) {
+	pw.font(bold, 8.5)
+	x := pdfMargin
+	for i, c := range pdfColumns {
+		pw.text(x+1, y+4.2, c.width-2, pw.fit(cells[i], c.width-2), c.align)
+		x += c.width
+	}
+}
+
+func (pw *pdfWriter) font(bold bool, size float64) {
+	pw.bold, pw.size = bold, size
+}
+
+// use selects the font for a run of thai or other text in the current style.
+func (pw *pdfWriter) use(thai bool) {
+	style := ""
+	if pw.bold {
+		style = "B"
+	}
+	if thai && pw.hasThai {
+		pw.f.SetFont("thai", style, pw.size)
+		return
+	}
+	pw.f.SetFont("Helvetica", style, pw.size)
+}
+
+// text draws s on the baseline y within the box starting at x that is width wide.
+func (pw *pdfWriter) text(x, y, width float64, s, align string) {
+	switch align {
+	case "R":
+		x += width - pw.width(s)
+	case "C":
+		x += (width - pw.width(s)) / 2
+	}
+	for _, r := range scriptRuns(s) {
+		pw.use(r.thai)
+		text := pw.encode(r)
+		pw.f.Text(x, y, text)
+		x += pw.f.GetStringWidth(text)
+	}
+}
+
+func (pw *pdfWriter) width(s string) float64 {
+	var w float64
+	for _, r := range scriptRuns(s) {
+		pw.use(r.thai)
+		w += pw.f.GetStringWidth(pw.encode(r))
+	}
+	return w
+}
+
+// encode converts a run for its font: the Thai font takes UTF-8, Helvetica takes cp1252.
+func (pw *pdfWriter) encode(r run) string {
+	if r.thai && pw.hasThai {
+		return r.text
+	}
+	return pw.tr(r.text)
+}
+
+// fit shortens s with an ellipsis until it is at most width wide.
+func (pw *pdfWriter) fit(s string, width float64) string {
+	if pw.width(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for n := len(runes) - 1; n >= 0; n-- {
+		// never separate a Thai vowel or tone mark from its consonant
+		if unicode.Is(unicode.Mn, runes[n]) {
+			continue
+		}
+		if cut := string(runes[:n]) + "..."; pw.width(cut) <= width {
+			return cut
+		}
+	}
+	return ""
+}
+
+// run is a piece of text in a single script.
+type run struct {
+	text string
+	thai bool
+}
+
+func isThai(r rune) bool {
+	return r >= 0x0E00 && r <= 0x0E7F
+}
+
+// scriptRuns splits s into runs of Thai and other text, so each run can be drawn with a font
+// that has its glyphs.
+func scriptRuns(s string) []run {
+	var runs []run
+	for _, r := range s {
+		thai := isThai(r)
+		if n := len(runs); n > 0 && runs[n-1].thai == thai {
+			runs[n-1].text += string(r)
+			continue
+		}
+		runs = append(runs, run{text: string(r), thai: thai})
+	}
+	return runs
+}
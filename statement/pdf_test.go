@@ -0,0 +1,93 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/stretchr/testify/assert"
+)
+
+// thaiFont returns a TrueType font with Thai glyphs from STATEMENT_TEST_FONT or a few
+// common install locations, skipping the test when there is none.
+func thaiFont(t *testing.T) []byte {
+	for _, path := range []string{
+		os.Getenv("STATEMENT_TEST_FONT"),
+		"/usr/share/fonts/noto/NotoSansThai-Regular.ttf",
+		"/usr/share/fonts/truetype/noto/NotoSansThai-Regular.ttf",
+		"/usr/share/fonts/truetype/tlwg/Loma.ttf",
+	} {
+		if path == "" {
+			continue
+		}
+		if b, err := os.ReadFile(path); err == nil {
+			return b
+		}
+	}
+	t.Skip("no Thai font installed, set STATEMENT_TEST_FONT")
+	return nil
+}
+
+func TestScriptRuns(t *testing.T) {
+	assert.Equal(t, []run{
+		{"ละมุนซิง", true},
+		{" (Laumcing) ", false},
+		{"ธ", true},
+		{".KTB", false},
+	}, scriptRuns("ละมุนซิง (Laumcing) ธ.KTB"))
+	assert.Nil(t, scriptRuns(""))
+}
+
+func TestTotals(t *testing.T) {
+	assert.Equal(t, Totals{Credits: 5, Debits: 2899700, CreditCount: 1, DebitCount: 2}, testStatement().Totals())
+}
+
+func TestPDFFitKeepsMarksWithTheirConsonant(t *testing.T) {
+	pw := &pdfWriter{f: fpdf.New("P", "mm", "A4", ""), size: 10}
+	pw.tr = pw.f.UnicodeTranslatorFromDescriptor("")
+
+	name := strings.Repeat("กิ่ง", 20)
+	for _, width := range []float64{10, 15, 20, 30} {
+		cut := strings.TrimSuffix(pw.fit(name, width), "...")
+		assert.LessOrEqual(t, pw.width(cut+"..."), width)
+		next, _ := utf8.DecodeRuneInString(name[len(cut):])
+		assert.False(t, unicode.Is(unicode.Mn, next), "cut before a mark at width %v", width)
+	}
+	assert.Equal(t, "short", pw.fit("short", 30))
+}
+
+func TestPDFWithoutThaiFont(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, NewPDF(nil, nil).Write(&buf, testStatement()))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+	assert.Contains(t, buf.String(), "%%EOF")
+	assert.NotContains(t, buf.String(), "/FontFile2")
+}
+
+func TestPDFWithThaiFont(t *testing.T) {
+	font := thaiFont(t)
+
+	var buf bytes.Buffer
+	assert.NoError(t, NewPDF(font, nil).Write(&buf, testStatement()))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+	// the Thai font is embedded
+	assert.Contains(t, buf.String(), "/FontFile2")
+}
+
+func TestPDFManyPages(t *testing.T) {
+	s := testStatement()
+	for i := 0; i < 150; i++ {
+		s.Entries = append(s.Entries, Entry{TransactionID: fmt.Sprintf("TXN%d", i), BookedAt: s.To, Type: "Transfer in", Amount: 100, Note: "Salary"})
+	}
+
+	var one, many bytes.Buffer
+	assert.NoError(t, NewPDF(nil, nil).Write(&one, testStatement()))
+	assert.NoError(t, NewPDF(nil, nil).Write(&many, s))
+	assert.Equal(t, 1, strings.Count(one.String(), "/Type /Page\n"))
+	assert.Greater(t, strings.Count(many.String(), "/Type /Page\n"), 2)
+}
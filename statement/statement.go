@@ -0,0 +1,98 @@
+// Package statement renders account statements for accounting tools.
+//
+// A Statement is built by the caller from its own ledger; this package only knows how to
+// write it out as CSV, OFX or ISO 20022 camt.053. Amounts are integer minor units of the
+// statement currency and are rendered as decimals with the currency's ISO 4217 exponent.
+package statement
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"demo/money"
+)
+
+// Account is the account a statement is for.
+type Account struct {
+	Number   string
+	Name     string
+	Type     string
+	Branch   string
+	Currency string
+}
+
+// Entry is a single booked transaction leg. Amount is negative for money leaving the
+// account and Balance is the running balance after the entry.
+type Entry struct {
+	TransactionID    string
+	BookedAt         time.Time
+	Type             string
+	Amount           int64
+	Balance          int64
+	Counterparty     string
+	CounterpartyName string
+	Note             string
+}
+
+// Statement is the activity of an account between From and To, inclusive.
+type Statement struct {
+	Account        Account
+	From           time.Time
+	To             time.Time
+	OpeningBalance int64
+	ClosingBalance int64
+	Entries        []Entry
+	GeneratedAt    time.Time
+}
+
+// New returns the statement of account from its opening balance and the entries booked
+// in the period, filling in the running balance of each entry and the closing balance.
+// Entries are sorted by booking time, keeping the given order for equal times.
+func New(account Account, from, to time.Time, opening int64, entries []Entry) *Statement {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].BookedAt.Before(entries[j].BookedAt) })
+
+	balance := opening
+	for i := range entries {
+		balance += entries[i].Amount
+		entries[i].Balance = balance
+	}
+	return &Statement{
+		Account:        account,
+		From:           from,
+		To:             to,
+		OpeningBalance: opening,
+		ClosingBalance: balance,
+		Entries:        entries,
+		GeneratedAt:    time.Now(),
+	}
+}
+
+// Format is a statement file format.
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	Write       func(w io.Writer, s *Statement) error
+}
+
+// Formats are the supported formats by name.
+var Formats = map[string]Format{
+	"csv":     {Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv", Write: WriteCSV},
+	"ofx":     {Name: "ofx", ContentType: "application/x-ofx", Extension: "ofx", Write: WriteOFX},
+	"camt053": {Name: "camt053", ContentType: "application/xml", Extension: "xml", Write: WriteCamt053},
+}
+
+// MinorUnits returns the number of decimals of currency, 2 unless ISO 4217 says otherwise.
+func MinorUnits(currency string) int {
+	if n, ok := money.MinorUnits(strings.ToUpper(currency)); ok {
+		return n
+	}
+	return 2
+}
+
+// FormatAmount renders amount, in minor units of currency, as a decimal: 123456 THB is "1234.56".
+func FormatAmount(amount int64, currency string) string {
+	return money.New(amount, strings.ToUpper(currency)).String()
+}
@@ -0,0 +1,112 @@
+package statement
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func at(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04:05", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func testStatement() *Statement {
+	s := New(
+		Account{Number: "111-111-111", Name: "AnuchitO", Type: "Savings", Branch: "Kalasin", Currency: "THB"},
+		at("2025-01-01 00:00:00"), at("2025-01-31 23:59:59"),
+		100000050,
+		[]Entry{
+			{TransactionID: "TXN3", BookedAt: at("2025-01-14 14:22:00"), Type: "Transfer out", Amount: -399900, Counterparty: "222-222-222", CounterpartyName: "MaiThai", Note: "Breakfast"},
+			{TransactionID: "TXN1", BookedAt: at("2025-01-10 14:22:00"), Type: "Transfer out", Amount: -2499800, Counterparty: "444-444-444", CounterpartyName: "ละมุนซิง", Note: "Lunch, with \"friends\""},
+			{TransactionID: "TXN2", BookedAt: at("2025-01-13 18:00:00"), Type: "Transfer in", Amount: 5, Counterparty: "333-333-333", CounterpartyName: "LaumPlearn", Note: "Dinner & drinks"},
+		},
+	)
+	s.GeneratedAt = at("2025-02-01 08:00:00")
+	return s
+}
+
+func TestNew(t *testing.T) {
+	s := testStatement()
+
+	assert.Equal(t, []string{"TXN1", "TXN2", "TXN3"}, []string{s.Entries[0].TransactionID, s.Entries[1].TransactionID, s.Entries[2].TransactionID})
+	assert.Equal(t, int64(97500250), s.Entries[0].Balance)
+	assert.Equal(t, int64(97500255), s.Entries[1].Balance)
+	assert.Equal(t, int64(97100355), s.Entries[2].Balance)
+	assert.Equal(t, int64(97100355), s.ClosingBalance)
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{123456, "THB", "1234.56"},
+		{-123456, "THB", "-1234.56"},
+		{5, "USD", "0.05"},
+		{-5, "usd", "-0.05"},
+		{0, "THB", "0.00"},
+		{1500, "JPY", "1500"},
+		{-1500, "JPY", "-1500"},
+		{1234, "KWD", "1.234"},
+		{7, "BHD", "0.007"},
+		{math.MinInt64, "THB", "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, FormatAmount(tt.amount, tt.currency), "%d %s", tt.amount, tt.currency)
+	}
+}
+
+func TestFormatsGolden(t *testing.T) {
+	for name, format := range Formats {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, format.Write(&buf, testStatement()))
+
+			golden := filepath.Join("testdata", "statement."+name+".golden")
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, buf.Bytes(), 0o644))
+			}
+			want, err := os.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, string(want), buf.String())
+		})
+	}
+}
+
+func TestCSVFormulas(t *testing.T) {
+	s := New(Account{Number: "111-111-111", Currency: "THB"}, at("2025-01-01 00:00:00"), at("2025-01-31 23:59:59"), 0, []Entry{
+		{TransactionID: "TXN1", BookedAt: at("2025-01-10 14:22:00"), Type: "Transfer in", Amount: 100, Counterparty: "@SUM(A1)", CounterpartyName: "+66 81 234 5678", Note: `=HYPERLINK("http://example.com")`},
+		{TransactionID: "TXN2", BookedAt: at("2025-01-11 14:22:00"), Type: "Transfer out", Amount: -100, Counterparty: "222-222-222", CounterpartyName: "\tTab", Note: "-1+1"},
+	})
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteCSV(&buf, s))
+	out := buf.String()
+	assert.Contains(t, out, `,'@SUM(A1),'+66 81 234 5678,"'=HYPERLINK(""http://example.com"")",1.00,`)
+	assert.Contains(t, out, ",222-222-222,'\tTab,'-1+1,-1.00,")
+}
+
+func TestEmptyStatement(t *testing.T) {
+	s := New(Account{Number: "222-222-222", Currency: "USD"}, at("2025-01-01 00:00:00"), at("2025-01-31 23:59:59"), -1050, nil)
+
+	assert.Equal(t, int64(-1050), s.ClosingBalance)
+	for name, format := range Formats {
+		var buf bytes.Buffer
+		assert.NoError(t, format.Write(&buf, s), name)
+		assert.Contains(t, buf.String(), "10.50", name)
+	}
+}
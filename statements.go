@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"demo/statement"
+
+	"github.com/gin-gonic/gin"
+)
+
+// buildStatement reads the legs of account booked between from and to, both in the
+// transferred_at format. The opening balance is worked back from the current balance and
+// every leg booked since from. Everything is read in one database transaction so a transfer
+// made meanwhile can not skew the balances. Times on the statement are in the business
+// timezone.
+func (h *Handler) buildStatement(account *Account, from, to string) (*statement.Statement, error) {
+	loc := h.timezone()
+	fromAt, err := parseTime(from)
+	if err != nil {
+		return nil, err
+	}
+	toAt, err := parseTime(to)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var balance, since int64
+	err = tx.QueryRow(`
+        SELECT a.balance, COALESCE((
+            SELECT SUM(t.amount) FROM transactions t
+            WHERE t.account_number = a.account_number
+            AND t.transferred_at >= $2), 0)
+        FROM accounts a
+        WHERE a.account_number = $1`, account.AccountNumber, from).Scan(&balance, &since)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get opening balance: %w", err)
+	}
+
+	rows, err := tx.Query(`
+        SELECT t.transaction_id, t.transferred_at, t.type, t.amount,
+            CASE WHEN t.account_number = t.from_account THEN t.to_account ELSE t.from_account END,
+            CASE WHEN t.account_number = t.from_account THEN t.to_account_name ELSE COALESCE(s.account_name, '') END,
+            COALESCE(t.note, '')
+        FROM transactions t
+        LEFT JOIN accounts s ON s.account_number = t.from_account
+        WHERE t.account_number = $1
+        AND t.transferred_at >= $2
+        AND t.transferred_at <= $3
+        ORDER BY t.transferred_at ASC, t.id ASC`, account.AccountNumber, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get transactions: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []statement.Entry{}
+	for rows.Next() {
+		var e statement.Entry
+		var bookedAt string
+		if err := rows.Scan(&e.TransactionID, &bookedAt, &e.Type, &e.Amount, &e.Counterparty, &e.CounterpartyName, &e.Note); err != nil {
+			return nil, fmt.Errorf("unable to scan transaction: %w", err)
+		}
+		if e.BookedAt, err = parseTime(bookedAt); err != nil {
+			return nil, fmt.Errorf("invalid transferred_at: %w", err)
+		}
+		e.BookedAt = e.BookedAt.In(loc)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to get transactions: %w", err)
+	}
+
+	s := statement.New(statement.Account{
+		Number:   account.AccountNumber,
+		Name:     account.AccountName,
+		Type:     account.AccountType,
+		Branch:   account.Branch,
+		Currency: account.Currency,
+	}, fromAt.In(loc), toAt.In(loc), balance-since, entries)
+	s.GeneratedAt = s.GeneratedAt.In(loc)
+	return s, nil
+}
+
+// GetStatement handler
+func (h *Handler) GetStatement(c *gin.Context) {
+	format, ok := statement.Formats[c.DefaultQuery("format", "csv")]
+	if !ok {
+		abortWithError(c, badRequest("format must be csv, ofx or camt053"), "")
+		return
+	}
+	if c.Query("from") == "" || c.Query("to") == "" {
+		abortWithError(c, badRequest("from and to are required"), "")
+		return
+	}
+	from, err := parseBound(c.Query("from"), false, h.timezone())
+	if err != nil {
+		abortWithError(c, badRequest("invalid from: %v", err), "")
+		return
+	}
+	to, err := parseBound(c.Query("to"), true, h.timezone())
+	if err != nil {
+		abortWithError(c, badRequest("invalid to: %v", err), "")
+		return
+	}
+	if from > to {
+		abortWithError(c, badRequest("from must not be after to"), "")
+		return
+	}
+
+	account, err := h.getAccount(c.Param("accountNumber"))
+	if err != nil {
+		abortWithError(c, err, "unable to get statement")
+		return
+	}
+
+	s, err := h.buildStatement(account, from, to)
+	if err != nil {
+		abortWithError(c, err, "unable to get statement")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := format.Write(&buf, s); err != nil {
+		abortWithError(c, err, "unable to render statement")
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.%s", account.AccountNumber, s.From.Format("20060102"), s.To.Format("20060102"), format.Extension)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, format.ContentType, buf.Bytes())
+}
+
+// GetMonthlyStatementPDF handler, serves /accounts/:accountNumber/statements/:yyyy-mm.pdf
+func (h *Handler) GetMonthlyStatementPDF(c *gin.Context) {
+	month, ok := strings.CutSuffix(c.Param("month"), ".pdf")
+	if !ok {
+		abortWithError(c, errStatementNotFound, "")
+		return
+	}
+	start, err := time.ParseInLocation("2006-01", month, h.timezone())
+	if err != nil {
+		abortWithError(c, badRequest("month must be YYYY-MM"), "")
+		return
+	}
+	end := start.AddDate(0, 1, 0).Add(-time.Second)
+
+	account, err := h.getAccount(c.Param("accountNumber"))
+	if err != nil {
+		abortWithError(c, err, "unable to get statement")
+		return
+	}
+
+	s, err := h.buildStatement(account, formatTime(start), formatTime(end))
+	if err != nil {
+		abortWithError(c, err, "unable to get statement")
+		return
+	}
+
+	pdf := h.statementPDF
+	if pdf == nil {
+		pdf = statement.NewPDF(nil, nil)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Write(&buf, s); err != nil {
+		abortWithError(c, err, "unable to render statement")
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s.pdf", account.AccountNumber, month)
+	c.Header("Content-Disposition", `inline; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
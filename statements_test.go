@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupStatementRouter(t *testing.T, dbName string) (*gin.Engine, func()) {
+	db, cleanup, err := setupTestDBTransfers(dbName)
+	assert.NoError(t, err)
+
+	_, err = db.Exec(`
+		INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at)
+		VALUES
+			('TXN1', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer out', -200, 'USD', 'Rent', '2025-01-10T02:00:00Z'),
+			('TXN1', '54321', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer in', 200, 'USD', 'Rent', '2025-01-10T02:00:00Z'),
+			('TXN2', '12345', '54321', '12345', 'John Doe', 'Bank A', 'Transfer in', 50, 'USD', 'Refund', '2025-01-31T16:00:00Z'),
+			('TXN2', '54321', '54321', '12345', 'John Doe', 'Bank A', 'Transfer out', -50, 'USD', 'Refund', '2025-01-31T16:00:00Z'),
+			('TXN3', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer out', -1, 'USD', 'Fee', '2025-02-02T03:00:00Z'),
+			('TXN3', '54321', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer in', 1, 'USD', 'Fee', '2025-02-02T03:00:00Z');
+	`)
+	assert.NoError(t, err)
+
+	handler := &Handler{db: db}
+	r := gin.Default()
+	r.GET("/accounts/:accountNumber/statements", handler.GetStatement)
+	r.GET("/accounts/:accountNumber/statements/:month", handler.GetMonthlyStatementPDF)
+	return r, cleanup
+}
+
+func getStatement(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetStatement(t *testing.T) {
+	t.Run("CSV", func(t *testing.T) {
+		r, cleanup := setupStatementRouter(t, "statement_csv_db")
+		defer cleanup()
+
+		w := getStatement(r, "/accounts/12345/statements?from=2025-01-01&to=2025-01-31&format=csv")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="statement-12345-20250101-20250131.csv"`, w.Header().Get("Content-Disposition"))
+
+		// the balance is 1000 now, after -200 and +50 in January and -1 in February
+		expected := "Booked At,Transaction ID,Type,Counterparty,Counterparty Name,Note,Amount,Balance,Currency\n" +
+			"2025-01-01T00:00:00,,Opening balance,,,,,11.51,USD\n" +
+			"2025-01-10T09:00:00,TXN1,Transfer out,54321,Jane Doe,Rent,-2.00,9.51,USD\n" +
+			"2025-01-31T23:00:00,TXN2,Transfer in,54321,Jane Doe,Refund,0.50,10.01,USD\n" +
+			"2025-01-31T23:59:59,,Closing balance,,,,,10.01,USD\n"
+		assert.Equal(t, expected, w.Body.String())
+	})
+
+	t.Run("DefaultsToCSV", func(t *testing.T) {
+		r, cleanup := setupStatementRouter(t, "statement_default_db")
+		defer cleanup()
+
+		w := getStatement(r, "/accounts/54321/statements?from=2025-02-01&to=2025-02-28")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "2025-02-02T10:00:00,TXN3,Transfer in,12345,John Doe,Fee,0.01,5.00,USD\n")
+	})
+
+	t.Run("OFXAndCamt053", func(t *testing.T) {
+		r, cleanup := setupStatementRouter(t, "statement_xml_db")
+		defer cleanup()
+
+		w := getStatement(r, "/accounts/12345/statements?from=2025-01-01&to=2025-01-31&format=ofx")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ofx", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "<TRNAMT>-2.00</TRNAMT>")
+		assert.Contains(t, w.Body.String(), "<BALAMT>10.01</BALAMT>")
+
+		w = getStatement(r, "/accounts/12345/statements?from=2025-01-01&to=2025-01-31&format=camt053")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `<Cd>OPBD</Cd>`)
+		assert.Contains(t, w.Body.String(), `<Amt Ccy="USD">11.51</Amt>`)
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		r, cleanup := setupStatementRouter(t, "statement_invalid_db")
+		defer cleanup()
+
+		tests := map[string]int{
+			"/accounts/12345/statements?from=2025-01-01&to=2025-01-31&format=pdf": http.StatusBadRequest,
+			"/accounts/12345/statements?from=2025-01-01":                          http.StatusBadRequest,
+			"/accounts/12345/statements?from=2025-02-01&to=2025-01-01":            http.StatusBadRequest,
+			"/accounts/12345/statements?from=01/01/2025&to=2025-01-31":            http.StatusBadRequest,
+			"/accounts/99999/statements?from=2025-01-01&to=2025-01-31":            http.StatusNotFound,
+		}
+		for path, code := range tests {
+			assert.Equal(t, code, getStatement(r, path).Code, path)
+		}
+	})
+}
+
+func TestGetMonthlyStatementPDF(t *testing.T) {
+	r, cleanup := setupStatementRouter(t, "statement_pdf_db")
+	defer cleanup()
+
+	w := getStatement(r, "/accounts/12345/statements/2025-01.pdf")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, `inline; filename="statement-12345-2025-01.pdf"`, w.Header().Get("Content-Disposition"))
+	assert.True(t, strings.HasPrefix(w.Body.String(), "%PDF-"))
+
+	tests := map[string]int{
+		"/accounts/12345/statements/2025-13.pdf": http.StatusBadRequest,
+		"/accounts/12345/statements/2025-01.csv": http.StatusNotFound,
+		"/accounts/99999/statements/2025-01.pdf": http.StatusNotFound,
+	}
+	for path, code := range tests {
+		assert.Equal(t, code, getStatement(r, path).Code, path)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	// the business timezone must load on images without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// Timestamps are stored as RFC 3339 in UTC, without fractions of a second, so they compare
+// in time order as text. The API reads and writes RFC 3339 as well.
+
+// defaultTimezone is the business timezone when none is configured.
+const defaultTimezone = "Asia/Bangkok"
+
+var bangkok = mustLoadLocation(defaultTimezone)
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// formatTime renders t the way timestamps are stored.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseTime reads a stored timestamp.
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339, s)
+}
+
+// localLayout is a time without an offset, as timestamps were stored before they were kept
+// in UTC and as clients may still send them.
+const localLayout = "2006-01-02 15:04:05"
+
+// parseClientTime reads a time sent by a client: RFC 3339, or a time without an offset in
+// the business timezone loc.
+func parseClientTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.ParseInLocation(localLayout, s, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// timezone is the business timezone schedules, business days and statement periods are
+// reckoned in.
+func (h *Handler) timezone() *time.Location {
+	if h.tz == nil {
+		return bangkok
+	}
+	return h.tz
+}
+
+// timestampColumns are the columns that hold a timestamp, by table.
+var timestampColumns = map[string][]string{
+	"transactions":     {"transferred_at"},
+	"schedules":        {"schedule_date", "end_date", "start_date", "occurrence_date", "last_run_at", "retry_at"},
+	"schedule_events":  {"created_at"},
+	"schedule_runs":    {"occurrence_date", "retry_at", "created_at"},
+	"transfers":        {"created_at", "updated_at", "completed_at", "failed_at", "reversed_at"},
+	"idempotency_keys": {"created_at", "expires_at"},
+	"holds":            {"created_at", "updated_at"},
+	"journal_entries":  {"posted_at"},
+	"opening_balances": {"as_of"},
+}
+
+// migrateTimestamps rewrites timestamps stored without an offset, as they were before
+// timestamps were kept in UTC, reading them in loc: the timezone of the server that wrote
+// them. Timestamps already in RFC 3339 are left alone, so it can be run again. It returns
+// how many were converted.
+func migrateTimestamps(db *sql.DB, loc *time.Location) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	converted := 0
+	for table, columns := range timestampColumns {
+		existing, err := columnsOf(tx, table)
+		if err != nil {
+			return 0, err
+		}
+		for _, column := range columns {
+			// databases older than a column do not have it to convert
+			if !existing[column] {
+				continue
+			}
+			n, err := migrateColumn(tx, table, column, loc)
+			if err != nil {
+				return 0, fmt.Errorf("unable to migrate %s.%s: %w", table, column, err)
+			}
+			converted += n
+		}
+	}
+	return converted, tx.Commit()
+}
+
+// columnsOf returns the columns table has.
+func columnsOf(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info($1)`, table)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+func migrateColumn(tx *sql.Tx, table, column string, loc *time.Location) (int, error) {
+	// timestamps with a T are RFC 3339 already, empty ones mean none
+	rows, err := tx.Query(fmt.Sprintf(`SELECT DISTINCT %[1]s FROM %[2]s WHERE %[1]s <> '' AND %[1]s NOT LIKE '%%T%%'`, column, table))
+	if err != nil {
+		return 0, err
+	}
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		values = append(values, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	converted := 0
+	for _, v := range values {
+		t, err := time.ParseInLocation(localLayout, strings.TrimSpace(v), loc)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a timestamp: %w", v, err)
+		}
+		res, err := tx.Exec(fmt.Sprintf(`UPDATE %[1]s SET %[2]s = $1 WHERE %[2]s = $2`, table, column), formatTime(t), v)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		converted += int(n)
+	}
+	return converted, nil
+}
+
+// addMissingColumns adds the columns the tables of db lack next to the schema Migrate creates,
+// which leaves tables that exist already as they are. Tables db does not have are left to
+// Migrate. It returns the columns it added as table.column.
+func addMissingColumns(db *sql.DB) ([]string, error) {
+	// the schema is read from a scratch database, an in-memory one lives on a single connection
+	schema, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer schema.Close()
+	schema.SetMaxOpenConns(1)
+	if err := Migrate(schema); err != nil {
+		return nil, fmt.Errorf("unable to create schema: %w", err)
+	}
+	want, err := schemaColumns(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var added []string
+	for _, table := range want {
+		existing, err := columnsOf(tx, table.name)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) == 0 {
+			continue
+		}
+		for _, column := range table.columns {
+			if existing[column.name] {
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s`, table.name, column.definition())); err != nil {
+				return nil, fmt.Errorf("unable to add %s.%s: %w", table.name, column.name, err)
+			}
+			added = append(added, table.name+"."+column.name)
+		}
+	}
+	return added, tx.Commit()
+}
+
+// droppedColumns are columns the schema had once and no longer does, as table.column.
+var droppedColumns = []string{
+	// the available balance is computed from the holds, see availableBalanceSQL
+	"accounts.available_balance",
+}
+
+// dropColumns drops the droppedColumns db still has. It returns the columns it dropped.
+func dropColumns(db *sql.DB) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var dropped []string
+	for _, c := range droppedColumns {
+		table, column, _ := strings.Cut(c, ".")
+		existing, err := columnsOf(tx, table)
+		if err != nil {
+			return nil, err
+		}
+		if !existing[column] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s DROP COLUMN %s`, table, column)); err != nil {
+			return nil, fmt.Errorf("unable to drop %s: %w", c, err)
+		}
+		dropped = append(dropped, c)
+	}
+	return dropped, tx.Commit()
+}
+
+type schemaTable struct {
+	name    string
+	columns []schemaColumn
+}
+
+type schemaColumn struct {
+	name, typ  string
+	notNull    bool
+	defaultSQL sql.NullString
+}
+
+// definition is the column as ALTER TABLE ADD COLUMN takes it.
+func (c schemaColumn) definition() string {
+	def := c.name + " " + c.typ
+	if c.notNull {
+		def += " NOT NULL"
+	}
+	if c.defaultSQL.Valid {
+		def += " DEFAULT " + c.defaultSQL.String
+	}
+	return def
+}
+
+// schemaColumns returns the tables of db with their columns, in the order they were created.
+func schemaColumns(db *sql.DB) ([]schemaTable, error) {
+	rows, err := db.Query(`
+        SELECT m.name, c.name, c.type, c."notnull", c.dflt_value
+        FROM sqlite_master m, pragma_table_info(m.name) c
+        WHERE m.type = 'table'
+        AND m.name NOT LIKE 'sqlite_%'
+        ORDER BY m.rowid, c.cid`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get schema: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []schemaTable
+	for rows.Next() {
+		var table string
+		var c schemaColumn
+		if err := rows.Scan(&table, &c.name, &c.typ, &c.notNull, &c.defaultSQL); err != nil {
+			return nil, err
+		}
+		if len(tables) == 0 || tables[len(tables)-1].name != table {
+			tables = append(tables, schemaTable{name: table})
+		}
+		tables[len(tables)-1].columns = append(tables[len(tables)-1].columns, c)
+	}
+	return tables, rows.Err()
+}
+
+// runMigrate is the migrate subcommand. It brings the tables of an existing database up to
+// the current schema, adding the tables and columns it is missing and dropping the columns
+// the schema no longer has, and converts its timestamps to UTC. It returns 0 on success,
+// 1 when duplicate legs have to be resolved before legs can be made unique and 2 otherwise.
+func runMigrate(args []string, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	path := flags.String("db", bankDB, "SQLite database to migrate")
+	tz := flags.String("timezone", "Local", "timezone the existing timestamps were written in")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	db, err := sql.Open("sqlite", *path)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	defer db.Close()
+	// columns go first, the indexes Migrate creates may cover them
+	added, err := addMissingColumns(db)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	// duplicate legs leave legs without their unique index, the rest is migrated anyway
+	migrateErr := Migrate(db)
+	if migrateErr != nil && !errors.Is(migrateErr, errDuplicateLegs) {
+		fmt.Fprintln(errOut, migrateErr)
+		return 2
+	}
+	dropped, err := dropColumns(db)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	for _, column := range added {
+		fmt.Fprintf(out, "added column %s\n", column)
+	}
+	for _, column := range dropped {
+		fmt.Fprintf(out, "dropped column %s\n", column)
+	}
+
+	converted, err := migrateTimestamps(db, loc)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 2
+	}
+	fmt.Fprintf(out, "converted %d timestamps from %s to UTC\n", converted, loc)
+	if migrateErr != nil {
+		fmt.Fprintln(errOut, migrateErr)
+		return 1
+	}
+	return 0
+}
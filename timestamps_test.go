@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClientTime(t *testing.T) {
+	at, err := parseClientTime("2025-02-01T09:00:00+07:00", time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, "2025-02-01T02:00:00Z", formatTime(at))
+
+	// without an offset the time is in the business timezone
+	at, err = parseClientTime("2025-02-01 09:00:00", bangkok)
+	assert.NoError(t, err)
+	assert.Equal(t, "2025-02-01T02:00:00Z", formatTime(at))
+
+	_, err = parseClientTime("01/02/2025 09:00", bangkok)
+	assert.Error(t, err)
+}
+
+func TestMigrateTimestamps(t *testing.T) {
+	db, cleanup, err := setupTestDBTransfers("migrate_timestamps_db")
+	assert.NoError(t, err)
+	defer cleanup()
+
+	_, err = db.Exec(`
+		INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at)
+		VALUES
+			('TXN1', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer out', -100, 'USD', 'Written in Bangkok', '2025-01-01 06:30:00'),
+			('TXN2', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer out', -100, 'USD', 'Already UTC', '2025-01-02T09:00:00Z');
+		INSERT INTO schedules (schedule_id, from_account, to_account, to_bank, amount, currency, schedule, schedule_date, status)
+		VALUES ('SCH1', '12345', '54321', 'KTB', 100, 'USD', 'ONCE', '2025-02-01 09:00:00', 'SCHEDULED');
+		INSERT INTO opening_balances (account_number, amount, as_of) VALUES ('12345', 1000, '');`)
+	assert.NoError(t, err)
+
+	converted, err := migrateTimestamps(db, bangkok)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, converted)
+
+	var transferredAt, scheduleDate, asOf string
+	var endDate sql.NullString
+	assert.NoError(t, db.QueryRow(`SELECT transferred_at FROM transactions WHERE transaction_id = 'TXN1'`).Scan(&transferredAt))
+	assert.Equal(t, "2024-12-31T23:30:00Z", transferredAt)
+	assert.NoError(t, db.QueryRow(`SELECT schedule_date, end_date FROM schedules WHERE schedule_id = 'SCH1'`).Scan(&scheduleDate, &endDate))
+	assert.Equal(t, "2025-02-01T02:00:00Z", scheduleDate)
+	assert.False(t, endDate.Valid)
+	assert.NoError(t, db.QueryRow(`SELECT as_of FROM opening_balances WHERE account_number = '12345'`).Scan(&asOf))
+	assert.Empty(t, asOf)
+
+	// converted timestamps are not converted again
+	converted, err = migrateTimestamps(db, bangkok)
+	assert.NoError(t, err)
+	assert.Zero(t, converted)
+}
+
+func TestMigrateCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bank.sqlite")
+	db, err := sql.Open("sqlite", path)
+	assert.NoError(t, err)
+	assert.NoError(t, Migrate(db))
+	_, err = db.Exec(`INSERT INTO transactions (transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at)
+		VALUES ('TXN1', '12345', '12345', '54321', 'Jane Doe', 'Bank B', 'Transfer out', -100, 'USD', 'Rent', '2025-01-01 09:00:00')`)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 0, runMigrate([]string{"-db", path, "-timezone", "Asia/Bangkok"}, &out, &errOut))
+	assert.Empty(t, errOut.String())
+	assert.Equal(t, "converted 1 timestamps from Asia/Bangkok to UTC\n", out.String())
+
+	out.Reset()
+	errOut.Reset()
+	assert.Equal(t, 2, runMigrate([]string{"-db", path, "-timezone", "Mars/Olympus"}, &out, &errOut))
+	assert.NotEmpty(t, errOut.String())
+	assert.Equal(t, 2, runMigrate([]string{"-db", filepath.Join(t.TempDir(), "missing.sqlite")}, &out, &errOut))
+	assert.Empty(t, out.String())
+}
+
+func TestBusinessTimezone(t *testing.T) {
+	// 01:00 on a Monday in Bangkok is still Sunday in UTC
+	tests := []struct {
+		name string
+		tz   *time.Location
+		want []string
+	}{
+		{"Bangkok", nil, []string{"2030-02-03T18:00:00Z", "2030-02-10T18:00:00Z", "2030-02-17T18:00:00Z"}},
+		{"UTC", time.UTC, []string{"2030-02-04T18:00:00Z", "2030-02-11T18:00:00Z", "2030-02-18T18:00:00Z"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, r, cleanup := setupScheduleRouter(t, "business_timezone_"+tt.name+"_db")
+			defer cleanup()
+			handler.tz = tt.tz
+			withRemoteConfig(t, map[string]string{"enable_schedule_monthly": "true"})
+
+			w := postWithKey(r, "/accounts/12345/schedules", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD","schedule":"WEEKLY","weekdays":["MO"],"startDate":"2030-02-04T01:00:00+07:00"}`)
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var created ScheduleResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+			var resp ScheduleOccurrences
+			w = sendJSON(r, http.MethodGet, "/accounts/12345/schedules/"+created.ScheduleID+"/occurrences?n=3", "")
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			dates := make([]string, len(resp.Occurrences))
+			for i, o := range resp.Occurrences {
+				dates[i] = formatTime(o.Date)
+			}
+			assert.Equal(t, tt.want, dates)
+		})
+	}
+}
+
+func TestMigrateCommandAddsColumns(t *testing.T) {
+	// the schema of a database from before transfers were tracked
+	path := filepath.Join(t.TempDir(), "bank.sqlite")
+	db, err := sql.Open("sqlite", path)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE accounts (
+			branch TEXT NOT NULL DEFAULT '',
+			account_number TEXT PRIMARY KEY,
+			type TEXT NOT NULL DEFAULT '',
+			account_name TEXT NOT NULL DEFAULT '',
+			balance INTEGER NOT NULL DEFAULT 0,
+			available_balance INTEGER NOT NULL DEFAULT 0,
+			currency TEXT NOT NULL DEFAULT 'THB'
+		);
+		CREATE TABLE transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			transaction_id TEXT NOT NULL,
+			account_number TEXT NOT NULL,
+			from_account TEXT NOT NULL,
+			to_account TEXT NOT NULL,
+			to_account_name TEXT NOT NULL DEFAULT '',
+			to_bank TEXT,
+			type TEXT NOT NULL DEFAULT '',
+			amount INTEGER NOT NULL,
+			currency TEXT NOT NULL,
+			note TEXT,
+			transferred_at TEXT NOT NULL
+		);
+		CREATE TABLE schedules (
+			schedule_id TEXT PRIMARY KEY,
+			from_account TEXT NOT NULL,
+			to_account TEXT NOT NULL,
+			to_account_name TEXT NOT NULL DEFAULT '',
+			to_bank TEXT,
+			type TEXT NOT NULL DEFAULT '',
+			amount INTEGER NOT NULL,
+			currency TEXT NOT NULL,
+			note TEXT,
+			status TEXT DEFAULT 'scheduled',
+			schedule TEXT NOT NULL,
+			schedule_date TEXT NOT NULL,
+			end_date TEXT
+		);
+		INSERT INTO accounts (account_number, account_name, balance, available_balance, currency)
+		VALUES ('12345', 'John Doe', 1000, 1000, 'USD'), ('54321', 'Jane Doe', 500, 500, 'USD');
+		INSERT INTO schedules (schedule_id, from_account, to_account, to_account_name, to_bank, amount, currency, note, status, schedule, schedule_date)
+		VALUES ('SCH1', '12345', '54321', 'Jane Doe', 'KTB', 100, 'USD', 'Rent', 'SCHEDULED', 'MONTHLY', '2025-02-01 09:00:00');`)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 0, runMigrate([]string{"-db", path, "-timezone", "Asia/Bangkok"}, &out, &errOut))
+	assert.Empty(t, errOut.String())
+	assert.Contains(t, out.String(), "added column schedules.retry_at\n")
+	assert.Contains(t, out.String(), "added column transactions.exchange_rate\n")
+	assert.Contains(t, out.String(), "dropped column accounts.available_balance\n")
+	assert.Contains(t, out.String(), "converted 1 timestamps from Asia/Bangkok to UTC\n")
+
+	// the scheduler runs on the migrated database
+	db, err = sql.Open("sqlite", path)
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	executed, err := NewScheduler(&Handler{db: db}, fixedClock("2025-02-01T02:00:00Z"), time.Minute).RunDue()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, executed)
+
+	var status, date string
+	assert.NoError(t, db.QueryRow(`SELECT status, schedule_date FROM schedules WHERE schedule_id = 'SCH1'`).Scan(&status, &date))
+	assert.Equal(t, ScheduleScheduled, status)
+	assert.Equal(t, "2025-03-01T02:00:00Z", date)
+
+	// a migrated database has nothing left to add
+	out.Reset()
+	assert.Equal(t, 0, runMigrate([]string{"-db", path}, &out, &errOut))
+	assert.Equal(t, "converted 0 timestamps from Local to UTC\n", out.String())
+}
+
+func TestMigrateCommandDuplicateLegs(t *testing.T) {
+	// a database from before legs were unique, with a leg written twice
+	path := filepath.Join(t.TempDir(), "bank.sqlite")
+	db, err := sql.Open("sqlite", path)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE accounts (
+			branch TEXT NOT NULL DEFAULT '',
+			account_number TEXT PRIMARY KEY,
+			type TEXT NOT NULL DEFAULT '',
+			account_name TEXT NOT NULL DEFAULT '',
+			balance INTEGER NOT NULL DEFAULT 0,
+			currency TEXT NOT NULL DEFAULT 'THB'
+		);
+		CREATE TABLE transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			transaction_id TEXT NOT NULL,
+			account_number TEXT NOT NULL,
+			from_account TEXT NOT NULL,
+			to_account TEXT NOT NULL,
+			to_account_name TEXT NOT NULL DEFAULT '',
+			to_bank TEXT,
+			type TEXT NOT NULL DEFAULT '',
+			amount INTEGER NOT NULL,
+			currency TEXT NOT NULL,
+			note TEXT,
+			transferred_at TEXT NOT NULL
+		);
+		INSERT INTO accounts (account_number, account_name, balance, currency)
+		VALUES ('12345', 'John Doe', 800, 'USD'), ('54321', 'Jane Doe', 700, 'USD');
+		INSERT INTO transactions (transaction_id, account_number, from_account, to_account, type, amount, currency, transferred_at)
+		VALUES
+			('TXN1', '12345', '12345', '54321', 'Transfer out', -200, 'USD', '2025-01-10 09:00:00'),
+			('TXN1', '54321', '12345', '54321', 'Transfer in', 200, 'USD', '2025-01-10 09:00:00'),
+			('TXN1', '54321', '12345', '54321', 'Transfer in', 200, 'USD', '2025-01-10 09:00:00');`)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 1, runMigrate([]string{"-db", path, "-timezone", "UTC"}, &out, &errOut))
+	assert.Contains(t, errOut.String(), "TXN1 on 54321 (2 legs)")
+	assert.Contains(t, out.String(), "converted 3 timestamps from UTC to UTC\n")
+
+	// everything but the unique legs is migrated, so the duplicate can be reconciled
+	out.Reset()
+	errOut.Reset()
+	assert.Equal(t, 1, runReconcile([]string{"-db", path}, &out, &errOut))
+	assert.Empty(t, errOut.String())
+	var report ReconciliationReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	if assert.Len(t, report.Duplicates, 1) {
+		assert.Equal(t, "TXN1", report.Duplicates[0].TransactionID)
+	}
+
+	db, err = sql.Open("sqlite", path)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`DELETE FROM transactions WHERE id = 3`)
+	assert.NoError(t, err)
+
+	out.Reset()
+	errOut.Reset()
+	assert.Equal(t, 0, runMigrate([]string{"-db", path}, &out, &errOut))
+	assert.Empty(t, errOut.String())
+	_, err = db.Exec(`
+		INSERT INTO transactions (transaction_id, account_number, from_account, to_account, amount, currency, transferred_at)
+		VALUES ('TXN1', '54321', '12345', '54321', 200, 'USD', '2025-01-10T09:00:00Z')`)
+	assert.True(t, isUniqueViolation(err))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTransactionLimit = 50
+	maxTransactionLimit     = 500
+)
+
+// TransactionFilter narrows down a transaction history query. Zero values match everything.
+type TransactionFilter struct {
+	AccountNumber string
+	Limit         int
+	After         *transactionCursor
+	From          string
+	To            string
+	Type          string
+	MinAmount     *int64
+	MaxAmount     *int64
+	Counterparty  string
+	Note          string
+}
+
+// TransactionPage is one page of transaction history. NextCursor is empty on the last page.
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
+}
+
+// transactionCursor is the position of the last row of a page. Rows are ordered by
+// transferred_at and then id, so rows sharing a transferred_at second keep their order.
+type transactionCursor struct {
+	TransferredAt string `json:"t"`
+	ID            int64  `json:"id"`
+}
+
+func (c transactionCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*transactionCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c transactionCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.TransferredAt == "" {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+// parseTransactionFilter reads the limit, cursor, from, to, type, minAmount, maxAmount,
+// counterparty and note query parameters.
+func parseTransactionFilter(c *gin.Context, loc *time.Location) (TransactionFilter, error) {
+	f := TransactionFilter{
+		Limit:        defaultTransactionLimit,
+		Type:         c.Query("type"),
+		Counterparty: c.Query("counterparty"),
+		Note:         c.Query("note"),
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxTransactionLimit {
+			return f, badRequest("limit must be between 1 and %d", maxTransactionLimit)
+		}
+		f.Limit = limit
+	}
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return f, err
+		}
+		f.After = cursor
+	}
+
+	var err error
+	if f.From, err = parseBound(c.Query("from"), false, loc); err != nil {
+		return f, badRequest("invalid from: %v", err)
+	}
+	if f.To, err = parseBound(c.Query("to"), true, loc); err != nil {
+		return f, badRequest("invalid to: %v", err)
+	}
+
+	switch f.Type {
+	case "", "Transfer in", "Transfer out":
+	default:
+		return f, badRequest("type must be Transfer in or Transfer out")
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **int64
+	}{{"minAmount", &f.MinAmount}, {"maxAmount", &f.MaxAmount}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		amount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || amount < 0 {
+			return f, badRequest("invalid %s", p.name)
+		}
+		*p.dst = &amount
+	}
+	return f, nil
+}
+
+// parseBound parses a from or to query parameter given as a date or an RFC3339 time into
+// the transferred_at format. A date is a day in the business timezone loc; as the upper
+// bound it covers the whole day.
+func parseBound(v string, upper bool, loc *time.Location) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	if day, err := time.ParseInLocation(time.DateOnly, v, loc); err == nil {
+		if upper {
+			return formatTime(day.AddDate(0, 0, 1).Add(-time.Second)), nil
+		}
+		return formatTime(day), nil
+	}
+	at, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return "", errors.New("expected YYYY-MM-DD or RFC3339")
+	}
+	return formatTime(at), nil
+}
+
+// listTransactions returns a page of transactions matching f, newest first.
+func (h *Handler) listTransactions(f TransactionFilter) (TransactionPage, error) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.AccountNumber != "" {
+		where = append(where, "account_number = "+arg(f.AccountNumber))
+	}
+	if f.After != nil {
+		t, id := arg(f.After.TransferredAt), arg(f.After.ID)
+		where = append(where, fmt.Sprintf("(transferred_at < %s OR (transferred_at = %s AND id < %s))", t, t, id))
+	}
+	if f.From != "" {
+		where = append(where, "transferred_at >= "+arg(f.From))
+	}
+	if f.To != "" {
+		where = append(where, "transferred_at <= "+arg(f.To))
+	}
+	if f.Type != "" {
+		where = append(where, "type = "+arg(f.Type))
+	}
+	if f.MinAmount != nil {
+		where = append(where, "ABS(amount) >= "+arg(*f.MinAmount))
+	}
+	if f.MaxAmount != nil {
+		where = append(where, "ABS(amount) <= "+arg(*f.MaxAmount))
+	}
+	if f.Counterparty != "" {
+		where = append(where, "(CASE WHEN account_number = from_account THEN to_account ELSE from_account END) = "+arg(f.Counterparty))
+	}
+	if f.Note != "" {
+		where = append(where, `note LIKE `+arg("%"+escapeLike(f.Note)+"%")+` ESCAPE '\'`)
+	}
+
+	query := `
+        SELECT id, transaction_id, account_number, from_account, to_account, to_account_name, to_bank, type, amount, currency, note, transferred_at,
+            COALESCE(original_transaction_id, ''), COALESCE(exchange_rate, ''), converted_amount, converted_currency
+        FROM transactions`
+	if len(where) > 0 {
+		query += "\n        WHERE " + strings.Join(where, "\n        AND ")
+	}
+	// one extra row tells whether there is a next page
+	query += "\n        ORDER BY transferred_at DESC, id DESC\n        LIMIT " + arg(f.Limit+1)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return TransactionPage{}, fmt.Errorf("unable to get transactions: %w", err)
+	}
+	defer rows.Close()
+
+	page := TransactionPage{Transactions: []Transaction{}}
+	var last transactionCursor
+	for rows.Next() {
+		if len(page.Transactions) == f.Limit {
+			page.NextCursor = last.encode()
+			break
+		}
+		var txn Transaction
+		var transferredAt string
+		var convertedAmount sql.NullInt64
+		var convertedCurrency sql.NullString
+		if err := rows.Scan(&last.ID, &txn.TransactionID, &txn.AccountNumber, &txn.FromAccount, &txn.ToAccount, &txn.ToAccountName, &txn.ToBank, &txn.Type, &txn.Amount.Minor, &txn.Amount.Currency, &txn.Note, &transferredAt, &txn.OriginalTransactionID,
+			&txn.ExchangeRate, &convertedAmount, &convertedCurrency); err != nil {
+			return TransactionPage{}, fmt.Errorf("unable to scan transaction: %w", err)
+		}
+		txn.Converted = scanMoney(convertedAmount, convertedCurrency)
+		if err := parseTransferredAt(&txn, transferredAt); err != nil {
+			return TransactionPage{}, fmt.Errorf("unable to parse transferred_at: %w", err)
+		}
+		last.TransferredAt = transferredAt
+		page.Transactions = append(page.Transactions, txn)
+	}
+	if err := rows.Err(); err != nil {
+		return TransactionPage{}, fmt.Errorf("unable to get transactions: %w", err)
+	}
+	return page, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
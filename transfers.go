@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Transfer statuses. A transfer starts PENDING and settles as COMPLETED or FAILED;
+// a COMPLETED transfer can later be REVERSED.
+const (
+	TransferPending   = "PENDING"
+	TransferCompleted = "COMPLETED"
+	TransferFailed    = "FAILED"
+	TransferReversed  = "REVERSED"
+)
+
+var transferTransitions = map[string][]string{
+	TransferPending:   {TransferCompleted, TransferFailed},
+	TransferCompleted: {TransferReversed},
+}
+
+var (
+	errInvalidStatus      = errors.New("invalid transfer status change")
+	errTransactionIDTaken = errors.New("transaction ID already taken")
+)
+
+// Transfer is a money movement between two accounts and where it is in its lifecycle.
+type Transfer struct {
+	TransactionID string      `json:"transactionId"`
+	FromAccount   string      `json:"fromAccount"`
+	ToAccount     string      `json:"toAccount"`
+	ToAccountName string      `json:"toAccountName"`
+	ToBank        string      `json:"toBank"`
+	Amount        money.Money `json:"amount"`
+	// ExchangeRate and Converted are set when the recipient account is in another currency:
+	// the recipient is credited Converted at the quoted rate.
+	ExchangeRate   string       `json:"exchangeRate,omitempty"`
+	Converted      *money.Money `json:"converted,omitempty"`
+	Note           string       `json:"note"`
+	ScheduleID     string       `json:"scheduleId,omitempty"`
+	ReversalOf     string       `json:"reversalOf,omitempty"`
+	RefundedAmount money.Money  `json:"refundedAmount"`
+	Status         string       `json:"status"`
+	FailureReason  string       `json:"failureReason,omitempty"`
+	CreatedAt      time.Time    `json:"createdAt"`
+	UpdatedAt      time.Time    `json:"updatedAt"`
+	CompletedAt    *time.Time   `json:"completedAt,omitempty"`
+	FailedAt       *time.Time   `json:"failedAt,omitempty"`
+	ReversedAt     *time.Time   `json:"reversedAt,omitempty"`
+}
+
+// credit returns what the recipient of t is credited.
+func (t *Transfer) credit() money.Money {
+	if t.Converted != nil {
+		return *t.Converted
+	}
+	return t.Amount
+}
+
+// nullableMoney splits m into nullable amount and currency columns, both NULL when m is nil.
+func nullableMoney(m *money.Money) (sql.NullInt64, sql.NullString) {
+	if m == nil {
+		return sql.NullInt64{}, sql.NullString{}
+	}
+	return sql.NullInt64{Int64: m.Minor, Valid: true}, sql.NullString{String: m.Currency, Valid: true}
+}
+
+// scanMoney is the reverse of nullableMoney.
+func scanMoney(amount sql.NullInt64, currency sql.NullString) *money.Money {
+	if !amount.Valid || !currency.Valid {
+		return nil
+	}
+	m := money.New(amount.Int64, currency.String)
+	return &m
+}
+
+// canTransition reports whether a transfer may move from status from to status to.
+func canTransition(from, to string) bool {
+	for _, next := range transferTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// insertTransfer gives t a new transaction ID and records it as PENDING. A generated ID that
+// is already taken, by a transfer or by legs written before transfers were recorded, is
+// replaced by a fresh one, so the legs of t can be written under the ID it is given here.
+func (h *Handler) insertTransfer(tx *sql.Tx, t *Transfer, stamp string) error {
+	var err error
+	for attempt := 1; attempt <= maxIDAttempts; attempt++ {
+		t.TransactionID = h.transactionID()
+		convertedAmount, convertedCurrency := nullableMoney(t.Converted)
+		var res sql.Result
+		res, err = tx.Exec(`
+        INSERT INTO transfers (transaction_id, from_account, to_account, to_account_name, to_bank, amount, currency, note, schedule_id, reversal_of, status, created_at, updated_at,
+            exchange_rate, converted_amount, converted_currency)
+        SELECT $1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), $11, $12, $12, NULLIF($13, ''), $14, $15
+        WHERE NOT EXISTS (SELECT 1 FROM transactions WHERE transaction_id = $1)`,
+			t.TransactionID, t.FromAccount, t.ToAccount, t.ToAccountName, t.ToBank, t.Amount.Minor, t.Amount.Currency, t.Note, t.ScheduleID, t.ReversalOf, TransferPending, stamp,
+			t.ExchangeRate, convertedAmount, convertedCurrency)
+		if err == nil {
+			var n int64
+			if n, err = res.RowsAffected(); err == nil && n == 0 {
+				err = errTransactionIDTaken
+				continue
+			}
+		}
+		if !isUniqueViolation(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create transfer: %w", err)
+	}
+	t.Status = TransferPending
+	return nil
+}
+
+// setTransferStatus moves t to status, stamping the matching timestamp column.
+// It fails with errInvalidStatus when the state machine does not allow the change.
+func (h *Handler) setTransferStatus(tx *sql.Tx, t *Transfer, status, reason, stamp string) error {
+	var column string
+	switch status {
+	case TransferCompleted:
+		column = "completed_at"
+	case TransferFailed:
+		column = "failed_at"
+	case TransferReversed:
+		column = "reversed_at"
+	default:
+		return errInvalidStatus
+	}
+
+	var current string
+	err := tx.QueryRow(`SELECT status FROM transfers WHERE transaction_id = $1`, t.TransactionID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errTransferNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get transfer: %w", err)
+	}
+	if !canTransition(current, status) {
+		return fmt.Errorf("%w: %s to %s", errInvalidStatus, current, status)
+	}
+
+	_, err = tx.Exec(`
+        UPDATE transfers
+        SET status = $1, failure_reason = NULLIF($2, ''), updated_at = $3, `+column+` = $3
+        WHERE transaction_id = $4`,
+		status, reason, stamp, t.TransactionID)
+	if err != nil {
+		return fmt.Errorf("unable to update transfer status: %w", err)
+	}
+	t.Status = status
+	t.FailureReason = reason
+	return nil
+}
+
+// recordFailedTransfer records t, which could not be made for reason, as FAILED inside tx so
+// callers can point to it. Nothing is posted to the accounts.
+func (h *Handler) recordFailedTransfer(tx *sql.Tx, t *Transfer, reason error, stamp string) error {
+	if err := h.insertTransfer(tx, t, stamp); err != nil {
+		return err
+	}
+	return h.setTransferStatus(tx, t, TransferFailed, reason.Error(), stamp)
+}
+
+// isTransferFailure reports whether err means the transfer itself can not be made, as
+// opposed to the server failing to make it.
+func isTransferFailure(err error) bool {
+	return errors.Is(err, errInvalidAmount) || errors.Is(err, errInsufficientBalance) ||
+		errors.Is(err, errAccountNotFound) || errors.Is(err, errRecipientNotFound) || isCurrencyError(err)
+}
+
+// failedTransferError is a transfer failure whose transfer was recorded as FAILED under
+// transactionID.
+type failedTransferError struct {
+	transactionID string
+	err           error
+}
+
+func (e *failedTransferError) Error() string { return e.err.Error() }
+
+func (e *failedTransferError) Unwrap() error { return e.err }
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// getTransfer loads a transfer by its transaction ID.
+func (h *Handler) getTransfer(q queryRower, transactionID string) (*Transfer, error) {
+	var t Transfer
+	var toBank, note, scheduleID, reversalOf, reason, completedAt, failedAt, reversedAt sql.NullString
+	var exchangeRate, convertedCurrency sql.NullString
+	var convertedAmount sql.NullInt64
+	var createdAt, updatedAt string
+	err := q.QueryRow(`
+        SELECT transaction_id, from_account, to_account, to_account_name, to_bank, amount, currency, note, schedule_id,
+            reversal_of, refunded_amount, status, failure_reason, created_at, updated_at, completed_at, failed_at, reversed_at,
+            exchange_rate, converted_amount, converted_currency
+        FROM transfers
+        WHERE transaction_id = $1`, transactionID).Scan(
+		&t.TransactionID, &t.FromAccount, &t.ToAccount, &t.ToAccountName, &toBank, &t.Amount.Minor, &t.Amount.Currency, &note, &scheduleID,
+		&reversalOf, &t.RefundedAmount.Minor, &t.Status, &reason, &createdAt, &updatedAt, &completedAt, &failedAt, &reversedAt,
+		&exchangeRate, &convertedAmount, &convertedCurrency,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errTransferNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get transfer: %w", err)
+	}
+	t.ToBank, t.Note, t.ScheduleID, t.ReversalOf, t.FailureReason = toBank.String, note.String, scheduleID.String, reversalOf.String, reason.String
+	t.RefundedAmount.Currency = t.Amount.Currency
+	t.ExchangeRate, t.Converted = exchangeRate.String, scanMoney(convertedAmount, convertedCurrency)
+
+	if t.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("invalid created_at: %w", err)
+	}
+	if t.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return nil, fmt.Errorf("invalid updated_at: %w", err)
+	}
+	for _, ts := range []struct {
+		value sql.NullString
+		dst   **time.Time
+	}{{completedAt, &t.CompletedAt}, {failedAt, &t.FailedAt}, {reversedAt, &t.ReversedAt}} {
+		if !ts.value.Valid {
+			continue
+		}
+		at, err := parseTime(ts.value.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status timestamp: %w", err)
+		}
+		*ts.dst = &at
+	}
+	return &t, nil
+}
+
+// GetTransfer handler
+func (h *Handler) GetTransfer(c *gin.Context) {
+	t, err := h.getTransfer(h.db, c.Param("transactionId"))
+	if err != nil {
+		abortWithError(c, err, "unable to get transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{TransferPending, TransferCompleted, true},
+		{TransferPending, TransferFailed, true},
+		{TransferCompleted, TransferReversed, true},
+		{TransferPending, TransferReversed, false},
+		{TransferCompleted, TransferFailed, false},
+		{TransferFailed, TransferCompleted, false},
+		{TransferReversed, TransferCompleted, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			assert.Equal(t, tt.want, canTransition(tt.from, tt.to))
+		})
+	}
+}
+
+func TestGetTransfer(t *testing.T) {
+	t.Run("CompletedTransfer", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("get_transfer_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+		r.GET("/transfers/:transactionId", handler.GetTransfer)
+
+		w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":200,"currency":"USD","note":"Rent"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		created := TransferResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+		req, err := http.NewRequest(http.MethodGet, "/transfers/"+created.TransactionID, nil)
+		assert.NoError(t, err)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var got Transfer
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.Equal(t, created.TransactionID, got.TransactionID)
+		assert.Equal(t, TransferCompleted, got.Status)
+		assert.Equal(t, "Jane Doe", got.ToAccountName)
+		assert.Equal(t, money.New(200, "USD"), got.Amount)
+		assert.NotNil(t, got.CompletedAt)
+		assert.Nil(t, got.FailedAt)
+		assert.Empty(t, got.FailureReason)
+	})
+
+	t.Run("FailedTransfer", func(t *testing.T) {
+		tests := []struct {
+			name, body, code, reason string
+		}{
+			{"InsufficientBalance", `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":100000000,"currency":"USD"}`,
+				codeInsufficientFunds, "insufficient balance"},
+			{"RecipientNotFound", `{"fromAccount":"12345","toAccount":"99999","toBank":"KTB","amount":200,"currency":"USD"}`,
+				codeRecipientNotFound, "recipient account not found"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				db, cleanup, err := setupTestDBTransfers("get_transfer_failed_" + tt.name + "_db")
+				assert.NoError(t, err)
+				defer cleanup()
+
+				handler := &Handler{db: db}
+				r := gin.New()
+				r.Use(RequestErrors())
+				r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+
+				before := balanceOf(t, db, "12345")
+				w := postWithKey(r, "/accounts/12345/transfers", "", tt.body)
+				body := assertError(t, w, http.StatusUnprocessableEntity, tt.code, tt.reason)
+				assert.NotEmpty(t, body.TransactionID)
+				assert.Equal(t, before, balanceOf(t, db, "12345"))
+
+				got, err := handler.getTransfer(db, body.TransactionID)
+				assert.NoError(t, err)
+				assert.Equal(t, TransferFailed, got.Status)
+				assert.Equal(t, tt.reason, got.FailureReason)
+				assert.NotNil(t, got.FailedAt)
+				assert.Nil(t, got.CompletedAt)
+			})
+		}
+	})
+
+	t.Run("UnknownTransfer", func(t *testing.T) {
+		db, cleanup, err := setupTestDBTransfers("get_transfer_unknown_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		handler := &Handler{db: db}
+		r := gin.Default()
+		r.GET("/transfers/:transactionId", handler.GetTransfer)
+
+		req, err := http.NewRequest(http.MethodGet, "/transfers/TXN0", nil)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assertError(t, w, http.StatusNotFound, codeTransferNotFound, "transfer not found")
+	})
+
+	t.Run("FailedScheduledTransfer", func(t *testing.T) {
+		db, cleanup, err := setupTestDBScheduler("get_transfer_failed_db")
+		assert.NoError(t, err)
+		defer cleanup()
+
+		insertSchedule(t, db, "SCH1", "99999", 100, "ONCE", "2025-02-01T09:00:00Z", "")
+		handler := &Handler{db: db}
+		s := NewScheduler(handler, fixedClock("2025-02-01T09:00:00Z"), time.Minute)
+		_, err = s.RunDue()
+		assert.NoError(t, err)
+
+		var txID string
+		err = db.QueryRow("SELECT last_transaction_id FROM schedules WHERE schedule_id = 'SCH1'").Scan(&txID)
+		assert.NoError(t, err)
+
+		got, err := handler.getTransfer(db, txID)
+		assert.NoError(t, err)
+		assert.Equal(t, TransferFailed, got.Status)
+		assert.Equal(t, "recipient account not found", got.FailureReason)
+		assert.Equal(t, "SCH1", got.ScheduleID)
+		assert.NotNil(t, got.FailedAt)
+
+		// a failed transfer can not be completed afterwards
+		tx, err := db.Begin()
+		assert.NoError(t, err)
+		defer tx.Rollback()
+		err = handler.setTransferStatus(tx, got, TransferCompleted, "", "2025-02-01T09:01:00Z")
+		assert.ErrorIs(t, err, errInvalidStatus)
+	})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"demo/calendar"
+	"demo/money"
+	"demo/recurrence"
+)
+
+// Field error codes, one per rule a request field breaks.
+const (
+	fieldRequired        = "REQUIRED"
+	fieldInvalidAmount   = "INVALID_AMOUNT"
+	fieldNotPositive     = "NOT_POSITIVE"
+	fieldInvalidCurrency = "INVALID_CURRENCY"
+	fieldAccountMismatch = "ACCOUNT_MISMATCH"
+	fieldSelfTransfer    = "SELF_TRANSFER"
+	fieldUnknownBank     = "UNKNOWN_BANK"
+	fieldTooLong         = "TOO_LONG"
+	fieldInvalidSchedule = "INVALID_SCHEDULE"
+	fieldInvalidDate     = "INVALID_DATE"
+	fieldEndBeforeStart  = "END_BEFORE_START"
+	fieldInvalidRule     = "INVALID_RECURRENCE"
+	fieldInvalidPolicy   = "INVALID_BUSINESS_DAY_POLICY"
+)
+
+// maxNoteLength is the longest note a transfer can carry, in characters.
+const maxNoteLength = 140
+
+// bankCodes are the banks transfers can be sent to, by their short code. Codes are looked up
+// as bankCode has them.
+var bankCodes = map[string]bool{
+	"BAAC":  true,
+	"BAY":   true,
+	"BBL":   true,
+	"CIMBT": true,
+	"GHB":   true,
+	"GSB":   true,
+	"ICBCT": true,
+	"KBANK": true,
+	"KKP":   true,
+	"KTB":   true,
+	"LHFG":  true,
+	"SCB":   true,
+	"TISCO": true,
+	"TTB":   true,
+	"UOB":   true,
+}
+
+// bankCode returns the short code of bank as it is kept, upper case, so "KBank" is KBANK.
+func bankCode(bank string) string {
+	return strings.ToUpper(strings.TrimSpace(bank))
+}
+
+// FieldError is a request field that breaks a rule.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every field of a request that breaks a rule.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "invalid request: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// err returns e, or nil when no field broke a rule.
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// transferFields are the fields TransferRequest and ScheduleRequest share.
+type transferFields struct {
+	FromAccount string
+	ToAccount   string
+	ToBank      string
+	Amount      money.Input
+	Currency    string
+	Note        string
+}
+
+// validate checks f, sent to the account in the path, adds the rules it breaks to v and
+// returns its amount.
+func (f transferFields) validate(pathAccount string, v *ValidationError) money.Money {
+	switch {
+	case f.FromAccount == "":
+		v.add("fromAccount", fieldRequired, "fromAccount is required")
+	case f.FromAccount != pathAccount:
+		v.add("fromAccount", fieldAccountMismatch, "fromAccount does not match the account in the path")
+	}
+	switch {
+	case f.ToAccount == "":
+		v.add("toAccount", fieldRequired, "toAccount is required")
+	case f.ToAccount == pathAccount:
+		v.add("toAccount", fieldSelfTransfer, "toAccount can not be the sending account")
+	}
+	switch {
+	case f.ToBank == "":
+		v.add("toBank", fieldRequired, "toBank is required")
+	case !bankCodes[bankCode(f.ToBank)]:
+		v.add("toBank", fieldUnknownBank, "toBank is not a known bank code")
+	}
+	if utf8.RuneCountInString(f.Note) > maxNoteLength {
+		v.add("note", fieldTooLong, "note is longer than 140 characters")
+	}
+
+	if !f.Amount.IsSet() {
+		v.add("amount", fieldRequired, "amount is required")
+		return money.Money{}
+	}
+	amount, err := f.Amount.Resolve(f.Currency)
+	switch {
+	case errors.Is(err, money.ErrNoCurrency):
+		v.add("currency", fieldRequired, "currency is required")
+	case errors.Is(err, money.ErrUnknownCurrency):
+		v.add("currency", fieldInvalidCurrency, errInvalidCurrency.Error())
+	case err != nil:
+		v.add("amount", fieldInvalidAmount, err.Error())
+	case amount.Minor <= 0:
+		v.add("amount", fieldNotPositive, "amount must be positive")
+	}
+	return amount
+}
+
+// validateTransfer checks req, sent to fromAccount, and returns its amount. It fails with a
+// ValidationError listing every field at fault.
+func validateTransfer(fromAccount string, req TransferRequest) (money.Money, error) {
+	var v ValidationError
+	amount := transferFields(req).validate(fromAccount, &v)
+	return amount, v.err()
+}
+
+// validateSchedule checks req like validateTransfer, along with its schedule and dates, and
+// returns its recurrence rule too, nil for a ONCE schedule. Dates without an offset are read
+// in the business timezone loc, where the rule is evaluated as well.
+func validateSchedule(fromAccount string, req ScheduleRequest, loc *time.Location) (money.Money, *recurrence.Rule, error) {
+	var v ValidationError
+	amount := transferFields{
+		FromAccount: req.FromAccount,
+		ToAccount:   req.ToAccount,
+		ToBank:      req.ToBank,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Note:        req.Note,
+	}.validate(fromAccount, &v)
+
+	switch req.Schedule {
+	case "ONCE", "DAILY", "WEEKLY", "MONTHLY", "RRULE":
+	case "":
+		v.add("schedule", fieldRequired, "schedule is required")
+	default:
+		v.add("schedule", fieldInvalidSchedule, "schedule must be ONCE, DAILY, WEEKLY, MONTHLY or RRULE")
+	}
+
+	var start, end time.Time
+	var err error
+	if req.StartDate == "" {
+		v.add("startDate", fieldRequired, "startDate is required")
+	} else if start, err = parseClientTime(req.StartDate, loc); err != nil {
+		v.add("startDate", fieldInvalidDate, "invalid start date")
+	}
+	if req.EndDate != "" {
+		end, err = parseClientTime(req.EndDate, loc)
+		switch {
+		case err != nil:
+			v.add("endDate", fieldInvalidDate, "invalid end date")
+		case !start.IsZero() && end.Before(start):
+			v.add("endDate", fieldEndBeforeStart, "endDate is before startDate")
+		}
+	}
+
+	if req.BusinessDayPolicy != "" {
+		if _, err := calendar.ParsePolicy(req.BusinessDayPolicy); err != nil {
+			v.add("businessDayPolicy", fieldInvalidPolicy, "businessDayPolicy must be PREVIOUS, NEXT or NONE")
+		}
+	}
+
+	start = start.In(loc)
+	rule := scheduleRule(req, start, &v)
+	if rule != nil && len(v.Fields) == 0 {
+		first, ok := rule.First(start)
+		switch {
+		case !ok:
+			v.add("schedule", fieldInvalidRule, "the schedule never runs")
+		case !end.IsZero() && end.Before(first):
+			v.add("endDate", fieldEndBeforeStart, "endDate is before the first run")
+		}
+	}
+	return amount, rule, v.err()
+}
+
+// scheduleRule builds the recurrence rule of req, which starts at start, and adds the
+// fields at fault to v. A ONCE schedule has none.
+func scheduleRule(req ScheduleRequest, start time.Time, v *ValidationError) *recurrence.Rule {
+	onlyFor := func(field string, set bool, schedules string) {
+		if set {
+			v.add(field, fieldInvalidRule, field+" only applies to "+schedules+" schedules")
+		}
+	}
+	if req.Schedule != "WEEKLY" {
+		onlyFor("weekdays", len(req.Weekdays) > 0, "WEEKLY")
+	}
+	if req.Schedule != "MONTHLY" {
+		onlyFor("dayOfMonth", req.DayOfMonth != 0, "MONTHLY")
+		onlyFor("lastBusinessDay", req.LastBusinessDay, "MONTHLY")
+	}
+	if req.Schedule != "RRULE" {
+		onlyFor("rrule", req.RRule != "", "RRULE")
+	}
+	if req.Schedule == "ONCE" || req.Schedule == "RRULE" {
+		onlyFor("interval", req.Interval != 0, "DAILY, WEEKLY and MONTHLY")
+		onlyFor("count", req.Count != 0, "DAILY, WEEKLY and MONTHLY")
+	}
+	if req.Interval < 0 {
+		v.add("interval", fieldInvalidRule, "interval must be positive")
+	}
+	if req.Count < 0 {
+		v.add("count", fieldInvalidRule, "count must be positive")
+	}
+
+	rule := recurrence.Rule{Interval: req.Interval, Count: req.Count}
+	switch req.Schedule {
+	case "DAILY":
+		rule.Freq = recurrence.Daily
+	case "WEEKLY":
+		rule.Freq = recurrence.Weekly
+		for _, code := range req.Weekdays {
+			day, err := recurrence.ParseWeekday(code)
+			if err != nil {
+				v.add("weekdays", fieldInvalidRule, "weekdays must be MO, TU, WE, TH, FR, SA or SU")
+				break
+			}
+			rule.ByDay = append(rule.ByDay, day)
+		}
+	case "MONTHLY":
+		rule.Freq = recurrence.Monthly
+		switch {
+		case req.LastBusinessDay && req.DayOfMonth != 0:
+			v.add("dayOfMonth", fieldInvalidRule, "dayOfMonth and lastBusinessDay can not both be given")
+		case req.LastBusinessDay:
+			rule.ByDay, rule.BySetPos = recurrence.Weekdays, -1
+		case req.DayOfMonth == -1 || (req.DayOfMonth >= 1 && req.DayOfMonth <= 31):
+			rule.ByMonthDay = []int{req.DayOfMonth}
+		case req.DayOfMonth != 0:
+			v.add("dayOfMonth", fieldInvalidRule, "dayOfMonth must be between 1 and 31, or -1 for the last day")
+		case !start.IsZero():
+			rule.ByMonthDay = []int{start.Day()}
+		}
+	case "RRULE":
+		if req.RRule == "" {
+			v.add("rrule", fieldRequired, "rrule is required")
+			break
+		}
+		parsed, err := recurrence.Parse(req.RRule)
+		if err != nil {
+			v.add("rrule", fieldInvalidRule, err.Error())
+		}
+		rule = parsed
+	default:
+		return nil
+	}
+	return &rule
+}
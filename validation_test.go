@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"demo/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTransfer(t *testing.T) {
+	valid := TransferRequest{FromAccount: "12345", ToAccount: "54321", ToBank: "KTB", Amount: money.Minor(200), Currency: "USD", Note: "Rent"}
+
+	tests := []struct {
+		name   string
+		modify func(*TransferRequest)
+		want   []FieldError
+	}{
+		{"Valid", func(*TransferRequest) {}, nil},
+		{"NegativeAmount", func(r *TransferRequest) { r.Amount = money.Minor(-200) },
+			[]FieldError{{"amount", fieldNotPositive, "amount must be positive"}}},
+		{"ZeroAmount", func(r *TransferRequest) { r.Amount = money.Minor(0) },
+			[]FieldError{{"amount", fieldNotPositive, "amount must be positive"}}},
+		{"SelfTransfer", func(r *TransferRequest) { r.ToAccount = "12345" },
+			[]FieldError{{"toAccount", fieldSelfTransfer, "toAccount can not be the sending account"}}},
+		{"FromAccountNotPath", func(r *TransferRequest) { r.FromAccount = "54321" },
+			[]FieldError{{"fromAccount", fieldAccountMismatch, "fromAccount does not match the account in the path"}}},
+		{"UnknownBank", func(r *TransferRequest) { r.ToBank = "Bank B" },
+			[]FieldError{{"toBank", fieldUnknownBank, "toBank is not a known bank code"}}},
+		{"BankCodeInAnyCase", func(r *TransferRequest) { r.ToBank = "KBank" }, nil},
+		{"NoteAtLimit", func(r *TransferRequest) { r.Note = strings.Repeat("ค", maxNoteLength) }, nil},
+		{"NoteTooLong", func(r *TransferRequest) { r.Note = strings.Repeat("ค", maxNoteLength+1) },
+			[]FieldError{{"note", fieldTooLong, "note is longer than 140 characters"}}},
+		{"UnknownCurrency", func(r *TransferRequest) { r.Currency = "ABC" },
+			[]FieldError{{"currency", fieldInvalidCurrency, "invalid currency"}}},
+		{"Missing", func(r *TransferRequest) { *r = TransferRequest{Currency: "USD"} },
+			[]FieldError{
+				{"fromAccount", fieldRequired, "fromAccount is required"},
+				{"toAccount", fieldRequired, "toAccount is required"},
+				{"toBank", fieldRequired, "toBank is required"},
+				{"amount", fieldRequired, "amount is required"},
+			}},
+		{"EveryFieldAtFault", func(r *TransferRequest) {
+			r.FromAccount, r.ToAccount, r.ToBank, r.Amount = "54321", "12345", "XYZ", money.Minor(-1)
+		}, []FieldError{
+			{"fromAccount", fieldAccountMismatch, "fromAccount does not match the account in the path"},
+			{"toAccount", fieldSelfTransfer, "toAccount can not be the sending account"},
+			{"toBank", fieldUnknownBank, "toBank is not a known bank code"},
+			{"amount", fieldNotPositive, "amount must be positive"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+			amount, err := validateTransfer("12345", req)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, money.New(200, "USD"), amount)
+				return
+			}
+			var v *ValidationError
+			if assert.ErrorAs(t, err, &v) {
+				assert.Equal(t, tt.want, v.Fields)
+			}
+		})
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	valid := ScheduleRequest{FromAccount: "12345", ToAccount: "54321", ToBank: "KTB", Amount: money.Minor(200), Currency: "USD",
+		Schedule: "MONTHLY", StartDate: "2030-01-01 09:00:00", EndDate: "2030-12-01 09:00:00"}
+
+	tests := []struct {
+		name   string
+		modify func(*ScheduleRequest)
+		field  string
+		code   string
+	}{
+		{"Valid", func(*ScheduleRequest) {}, "", ""},
+		{"NegativeAmount", func(r *ScheduleRequest) { r.Amount = money.Minor(-200) }, "amount", fieldNotPositive},
+		{"SelfTransfer", func(r *ScheduleRequest) { r.ToAccount = "12345" }, "toAccount", fieldSelfTransfer},
+		{"FromAccountNotPath", func(r *ScheduleRequest) { r.FromAccount = "54321" }, "fromAccount", fieldAccountMismatch},
+		{"UnknownBank", func(r *ScheduleRequest) { r.ToBank = "Bank B" }, "toBank", fieldUnknownBank},
+		{"NoteTooLong", func(r *ScheduleRequest) { r.Note = strings.Repeat("a", maxNoteLength+1) }, "note", fieldTooLong},
+		{"NoSchedule", func(r *ScheduleRequest) { r.Schedule = "" }, "schedule", fieldRequired},
+		{"UnknownSchedule", func(r *ScheduleRequest) { r.Schedule = "YEARLY" }, "schedule", fieldInvalidSchedule},
+		{"NoStartDate", func(r *ScheduleRequest) { r.StartDate = "" }, "startDate", fieldRequired},
+		{"InvalidStartDate", func(r *ScheduleRequest) { r.StartDate = "01/01/2030" }, "startDate", fieldInvalidDate},
+		{"InvalidEndDate", func(r *ScheduleRequest) { r.EndDate = "2030-13-01 09:00:00" }, "endDate", fieldInvalidDate},
+		{"EndBeforeStart", func(r *ScheduleRequest) { r.EndDate = "2029-12-31 09:00:00" }, "endDate", fieldEndBeforeStart},
+		{"Weekly", func(r *ScheduleRequest) { r.Schedule, r.Weekdays = "WEEKLY", []string{"MO", "TH"} }, "", ""},
+		{"UnknownWeekday", func(r *ScheduleRequest) { r.Schedule, r.Weekdays = "WEEKLY", []string{"MON"} }, "weekdays", fieldInvalidRule},
+		{"WeekdaysOnMonthly", func(r *ScheduleRequest) { r.Weekdays = []string{"MO"} }, "weekdays", fieldInvalidRule},
+		{"DayOfMonthOutOfRange", func(r *ScheduleRequest) { r.DayOfMonth = 32 }, "dayOfMonth", fieldInvalidRule},
+		{"DayOfMonthAndLastBusinessDay", func(r *ScheduleRequest) { r.DayOfMonth, r.LastBusinessDay = 15, true }, "dayOfMonth", fieldInvalidRule},
+		{"NegativeInterval", func(r *ScheduleRequest) { r.Interval = -1 }, "interval", fieldInvalidRule},
+		{"CountOnOnce", func(r *ScheduleRequest) { r.Schedule, r.EndDate, r.Count = "ONCE", "", 3 }, "count", fieldInvalidRule},
+		{"RRule", func(r *ScheduleRequest) { r.Schedule, r.RRule = "RRULE", "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR" }, "", ""},
+		{"NoRRule", func(r *ScheduleRequest) { r.Schedule = "RRULE" }, "rrule", fieldRequired},
+		{"InvalidRRule", func(r *ScheduleRequest) { r.Schedule, r.RRule = "RRULE", "FREQ=YEARLY" }, "rrule", fieldInvalidRule},
+		{"UnknownPolicy", func(r *ScheduleRequest) { r.BusinessDayPolicy = "LATER" }, "businessDayPolicy", fieldInvalidPolicy},
+		{"EndBeforeFirstRun", func(r *ScheduleRequest) { r.DayOfMonth, r.EndDate = 20, "2030-01-10 09:00:00" }, "endDate", fieldEndBeforeStart},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+			_, _, err := validateSchedule("12345", req, bangkok)
+			if tt.code == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var v *ValidationError
+			if assert.ErrorAs(t, err, &v) && assert.Len(t, v.Fields, 1) {
+				assert.Equal(t, tt.field, v.Fields[0].Field)
+				assert.Equal(t, tt.code, v.Fields[0].Code)
+			}
+		})
+	}
+}
+
+func TestInvalidRequestsAreRejected(t *testing.T) {
+	db, cleanup, err := setupTestDBTransfers("validation_db")
+	assert.NoError(t, err)
+	defer cleanup()
+	withRemoteConfig(t, map[string]string{"enable_schedule_once": "true"})
+
+	handler := &Handler{db: db}
+	r := gin.Default()
+	r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+	r.POST("/accounts/:accountNumber/schedules", handler.CreateSchedules)
+
+	for path, body := range map[string]string{
+		// a negative amount would otherwise pull money from the recipient
+		"/accounts/12345/transfers": `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":-200,"currency":"USD"}`,
+		"/accounts/12345/schedules": `{"fromAccount":"12345","toAccount":"54321","toBank":"KTB","amount":-200,"currency":"USD","schedule":"ONCE","startDate":"2030-01-01 09:00:00"}`,
+	} {
+		w := postWithKey(r, path, "", body)
+		resp := assertError(t, w, http.StatusUnprocessableEntity, codeValidationFailed, "invalid request")
+		assert.Equal(t, []FieldError{{"amount", fieldNotPositive, "amount must be positive"}}, resp.Fields, path)
+	}
+
+	// malformed JSON is still a bad request
+	w := postWithKey(r, "/accounts/12345/transfers", "", `{"amount":`)
+	assertError(t, w, http.StatusBadRequest, codeBadRequest, "invalid request body")
+
+	assert.Equal(t, int64(1000), balanceOf(t, db, "12345"))
+	assert.Equal(t, int64(500), balanceOf(t, db, "54321"))
+	var schedules int
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM schedules").Scan(&schedules))
+	assert.Equal(t, 0, schedules)
+
+	w = postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"12345","toBank":"KTB","amount":"2.00","currency":"USD"}`)
+	resp := assertError(t, w, http.StatusUnprocessableEntity, codeValidationFailed, "invalid request")
+	assert.Equal(t, []FieldError{{"toAccount", fieldSelfTransfer, "toAccount can not be the sending account"}}, resp.Fields)
+}
+
+func TestBankCodeFromHistory(t *testing.T) {
+	db, cleanup, err := setupTestDBTransfers("validation_bank_code_db")
+	assert.NoError(t, err)
+	defer cleanup()
+
+	handler := &Handler{db: db}
+	r := gin.Default()
+	r.POST("/accounts/:accountNumber/transfers", handler.CreateTransfer)
+
+	// the bank as older rows spell it is kept by its code
+	w := postWithKey(r, "/accounts/12345/transfers", "", `{"fromAccount":"12345","toAccount":"54321","toBank":"KBank","amount":100,"currency":"USD"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var toBank string
+	assert.NoError(t, db.QueryRow(`SELECT DISTINCT to_bank FROM transactions`).Scan(&toBank))
+	assert.Equal(t, "KBANK", toBank)
+}